@@ -182,6 +182,8 @@ static bool flag_coverage_filter;
 
 // If true, then executor should write the comparisons data to fuzzer.
 static bool flag_comparisons;
+// If true, then comparisons are also written (and deduplicated) with their PCs.
+static bool flag_comparisons_pc;
 
 // Tunable timeouts, received with execute_req.
 static uint64 syscall_timeout_ms;
@@ -678,6 +680,7 @@ void receive_execute()
 	flag_comparisons = req.exec_flags & (1 << 3);
 	flag_threaded = req.exec_flags & (1 << 4);
 	flag_coverage_filter = req.exec_flags & (1 << 5);
+	flag_comparisons_pc = req.exec_flags & (1 << 6);
 
 	debug("[%llums] exec opts: procid=%llu threaded=%d cover=%d comps=%d dedup=%d signal=%d"
 	      " timeouts=%llu/%llu/%llu prog=%llu filter=%d\n",
@@ -1585,6 +1588,10 @@ void kcov_comparison_t::write()
 		write_output_64(arg1);
 		write_output_64(arg2);
 	}
+	// PCs are used only to tell comparisons apart (value profile signal),
+	// so the lower 32 bits are enough.
+	if (flag_comparisons_pc)
+		write_output((uint32)pc);
 }
 
 bool kcov_comparison_t::ignore() const
@@ -1623,8 +1630,9 @@ bool kcov_comparison_t::ignore() const
 
 bool kcov_comparison_t::operator==(const struct kcov_comparison_t& other) const
 {
-	// We don't check for PC equality now, because it is not used.
-	return type == other.type && arg1 == other.arg1 && arg2 == other.arg2;
+	// PCs are checked only if they are written out, hints don't use them.
+	return type == other.type && arg1 == other.arg1 && arg2 == other.arg2 &&
+	       (!flag_comparisons_pc || pc == other.pc);
 }
 
 bool kcov_comparison_t::operator<(const struct kcov_comparison_t& other) const
@@ -1633,8 +1641,9 @@ bool kcov_comparison_t::operator<(const struct kcov_comparison_t& other) const
 		return type < other.type;
 	if (arg1 != other.arg1)
 		return arg1 < other.arg1;
-	// We don't check for PC equality now, because it is not used.
-	return arg2 < other.arg2;
+	if (arg2 != other.arg2 || !flag_comparisons_pc)
+		return arg2 < other.arg2;
+	return pc < other.pc;
 }
 #endif // if SYZ_EXECUTOR_USES_SHMEM
 
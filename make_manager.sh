@@ -2,10 +2,9 @@
 set -x
 
 # Prerequisites : currently in a syzkaller repo
+# Profiling does not need a special build anymore,
+# it's enabled with "profiling": true in the manager config.
 
-TAGS="profiling"
-GOTAGS="GOTAGS=\"${TAGS}\""
-
-eval "make clean ${GOTAGS}"
-eval "make generate ${GOTAGS}"
-eval "make ${GOTAGS}"
+make clean
+make generate
+make
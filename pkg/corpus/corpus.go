@@ -1,5 +1,3 @@
-//go:build !profiling
-
 // Copyright 2024 syzkaller project authors. All rights reserved.
 // Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
 
@@ -7,7 +5,9 @@ package corpus
 
 import (
 	"context"
+	"fmt"
 	"sync"
+	"time"
 
 	"github.com/google/syzkaller/pkg/cover"
 	"github.com/google/syzkaller/pkg/hash"
@@ -26,6 +26,15 @@ type Corpus struct {
 	cover   cover.Cover   // total coverage of all items
 	updates chan<- NewItemEvent
 	ProgramsList
+	sigs        map[*prog.Prog]string // sigs of the programs saved to ProgramsList
+	restored    map[string]ItemMeta   // see RestoreMeta
+	ancestors   map[string]ItemMeta   // see Ancestors
+	metaUpdates map[*prog.Prog]*rpctype.ProgMeta
+	// Protects metaUpdates: Fuzzed is called for every execution, so it doesn't take mu,
+	// and the updates are resolved to the program sigs only in GrabMetaUpdates.
+	metaMu sync.Mutex
+	// total value profile signal of all items (see signal.ValueProfile)
+	valueProfile signal.Signal
 }
 
 func NewCorpus(ctx context.Context) *Corpus {
@@ -33,11 +42,34 @@ func NewCorpus(ctx context.Context) *Corpus {
 }
 
 func NewMonitoredCorpus(ctx context.Context, updates chan<- NewItemEvent) *Corpus {
-	return &Corpus{
-		ctx:     ctx,
-		progs:   make(map[string]*Item),
-		updates: updates,
+	corpus := &Corpus{
+		ctx:         ctx,
+		progs:       make(map[string]*Item),
+		updates:     updates,
+		sigs:        make(map[*prog.Prog]string),
+		metaUpdates: make(map[*prog.Prog]*rpctype.ProgMeta),
+	}
+	if err := corpus.reset(DefaultSeedSchedule); err != nil {
+		panic(err)
+	}
+	return corpus
+}
+
+// SetSeedSchedule selects the seed scheduler (see SeedScheduler) by its name.
+// It must be called before any programs are saved.
+func (corpus *Corpus) SetSeedSchedule(name string) error {
+	corpus.mu.Lock()
+	defer corpus.mu.Unlock()
+	if len(corpus.progs) != 0 {
+		return fmt.Errorf("the seed schedule can't be changed for a non-empty corpus")
 	}
+	return corpus.reset(name)
+}
+
+func (c *Corpus) Len() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return uint64(len(c.progs))
 }
 
 // It may happen that a single program is relevant because of several
@@ -59,6 +91,9 @@ type Item struct {
 	Signal   signal.Signal
 	Cover    []uint32
 	Updates  []ItemUpdate
+	Meta     ItemMeta
+	// Value profile signal the item was saved for (see signal.ValueProfile).
+	ValueProfile signal.Signal
 }
 
 func (item Item) StringCall() string {
@@ -87,6 +122,11 @@ type NewInput struct {
 	Signal   signal.Signal
 	Cover    []uint32
 	RawCover []uint32
+	Lineage  Lineage
+	// Value profile signal (see signal.ValueProfile), it's kept apart from the coverage signal.
+	ValueProfile signal.Signal
+	// How long the program took to execute during triage (zero if unknown).
+	ExecTime time.Duration
 }
 
 func (item NewInput) StringCall() string {
@@ -100,6 +140,11 @@ func (item NewInput) RPCInput() rpctype.Input {
 		Signal:   item.Signal.Serialize(),
 		Cover:    item.Cover,
 		RawCover: item.RawCover,
+		Parent:   item.Lineage.Parent,
+		Mutators: item.Lineage.Mutators,
+
+		ValueProfile: item.ValueProfile.Serialize(),
+		ExecTime:     item.ExecTime,
 	}
 }
 
@@ -108,9 +153,11 @@ type NewItemEvent struct {
 	Exists   bool
 	ProgData []byte
 	NewCover []uint32
+	Signal   signal.Signal
 }
 
-func (corpus *Corpus) Save(inp NewInput) {
+// Save adds the input to the corpus and returns the PCs it newly covered.
+func (corpus *Corpus) Save(inp NewInput) []uint32 {
 	progData := inp.Prog.Serialize()
 	sig := hash.String(progData)
 
@@ -129,6 +176,11 @@ func (corpus *Corpus) Save(inp NewInput) {
 		var newCover cover.Cover
 		newCover.Merge(old.Cover)
 		newCover.Merge(inp.Cover)
+		newValueProfile := old.ValueProfile
+		if !inp.ValueProfile.Empty() {
+			newValueProfile = old.ValueProfile.Copy()
+			newValueProfile.Merge(inp.ValueProfile)
+		}
 		newItem := &Item{
 			Sig:      sig,
 			Prog:     old.Prog,
@@ -138,6 +190,12 @@ func (corpus *Corpus) Save(inp NewInput) {
 			Signal:   newSignal,
 			Cover:    newCover.Serialize(),
 			Updates:  append([]ItemUpdate{}, old.Updates...),
+			Meta:     old.Meta,
+
+			ValueProfile: newValueProfile,
+		}
+		if newItem.Meta.ExecTime == 0 {
+			newItem.Meta.ExecTime = inp.ExecTime
 		}
 		const maxUpdates = 32
 		if len(newItem.Updates) < maxUpdates {
@@ -154,10 +212,15 @@ func (corpus *Corpus) Save(inp NewInput) {
 			Signal:   inp.Signal,
 			Cover:    inp.Cover,
 			Updates:  []ItemUpdate{update},
+			Meta:     corpus.newItemMeta(sig, inp.Lineage, inp.ExecTime),
+
+			ValueProfile: inp.ValueProfile,
 		}
 		corpus.saveProgram(inp.Prog, inp.Signal)
+		corpus.sigs[inp.Prog] = sig
 	}
 	corpus.signal.Merge(inp.Signal)
+	corpus.valueProfile.Merge(inp.ValueProfile)
 	newCover := corpus.cover.MergeDiff(inp.Cover)
 	if corpus.updates != nil {
 		select {
@@ -167,9 +230,11 @@ func (corpus *Corpus) Save(inp NewInput) {
 			Exists:   exists,
 			ProgData: progData,
 			NewCover: newCover,
+			Signal:   corpus.progs[sig].Signal,
 		}:
 		}
 	}
+	return newCover
 }
 
 func (corpus *Corpus) DiffSignal(s signal.Signal) signal.Signal {
@@ -184,6 +249,13 @@ func (corpus *Corpus) Signal() signal.Signal {
 	return corpus.signal.Copy()
 }
 
+// DiffValueProfile returns the value profile signal that is not yet in the corpus.
+func (corpus *Corpus) DiffValueProfile(s signal.Signal) signal.Signal {
+	corpus.mu.RLock()
+	defer corpus.mu.RUnlock()
+	return corpus.valueProfile.Diff(s)
+}
+
 func (corpus *Corpus) Items() []*Item {
 	corpus.mu.RLock()
 	defer corpus.mu.RUnlock()
@@ -194,6 +266,17 @@ func (corpus *Corpus) Items() []*Item {
 	return ret
 }
 
+// Energies returns the current seed scheduler energies of the corpus programs by their sigs.
+func (corpus *Corpus) Energies() map[string]float64 {
+	corpus.mu.RLock()
+	defer corpus.mu.RUnlock()
+	ret := make(map[string]float64, len(corpus.progs))
+	for sig, item := range corpus.progs {
+		ret[sig] = corpus.energy(item.Prog)
+	}
+	return ret
+}
+
 func (corpus *Corpus) Item(sig string) *Item {
 	corpus.mu.RLock()
 	defer corpus.mu.RUnlock()
@@ -202,18 +285,20 @@ func (corpus *Corpus) Item(sig string) *Item {
 
 // Stats is a snapshot of the relevant current state figures.
 type Stats struct {
-	Progs  int
-	Signal int
-	Cover  int
+	Progs        int
+	Signal       int
+	Cover        int
+	ValueProfile int
 }
 
 func (corpus *Corpus) Stats() Stats {
 	corpus.mu.RLock()
 	defer corpus.mu.RUnlock()
 	return Stats{
-		Progs:  len(corpus.progs),
-		Signal: len(corpus.signal),
-		Cover:  len(corpus.cover),
+		Progs:        len(corpus.progs),
+		Signal:       len(corpus.signal),
+		Cover:        len(corpus.cover),
+		ValueProfile: len(corpus.valueProfile),
 	}
 }
 
@@ -7,7 +7,9 @@ import (
 	"context"
 	"math/rand"
 	"testing"
+	"time"
 
+	"github.com/google/syzkaller/pkg/hash"
 	"github.com/google/syzkaller/pkg/signal"
 	"github.com/google/syzkaller/prog"
 	"github.com/google/syzkaller/sys/targets"
@@ -80,6 +82,43 @@ func TestCorpusCoverage(t *testing.T) {
 	assert.Equal(t, corpus.Stats().Cover, 3)
 }
 
+func TestCorpusValueProfile(t *testing.T) {
+	target := getTarget(t, targets.TestOS, targets.TestArch64)
+	corpus := NewCorpus(context.Background())
+	rs := rand.NewSource(0)
+
+	// inp2 gives no new coverage signal, but it's kept for its value profile signal.
+	// inp1 has the higher priority signal, so that minimization deterministically prefers it to inp3.
+	inp1 := generateInput(target, rs, 5, 5)
+	inp1.Signal = signal.FromRaw([]uint32{1, 2, 3, 4, 5}, 1)
+	inp1.ValueProfile = signal.FromRaw([]uint32{1, 2}, 0)
+	corpus.Save(inp1)
+	inp2 := generateInput(target, rs, 5, 3)
+	inp2.ValueProfile = signal.FromRaw([]uint32{2, 3}, 0)
+	corpus.Save(inp2)
+	inp3 := generateInput(target, rs, 5, 2)
+	corpus.Save(inp3)
+	assert.Equal(t, Stats{
+		Progs:        3,
+		Signal:       5,
+		ValueProfile: 3,
+	}, corpus.Stats())
+	assert.Equal(t, 1, corpus.DiffValueProfile(signal.FromRaw([]uint32{3, 4}, 0)).Len())
+
+	inp2.ValueProfile = signal.FromRaw([]uint32{4}, 0)
+	corpus.Save(inp2)
+	sig2 := hash.String(inp2.Prog.Serialize())
+	assert.Equal(t, 3, corpus.Item(sig2).ValueProfile.Len())
+
+	corpus.Minimize(true)
+	var progs []*prog.Prog
+	for _, item := range corpus.Items() {
+		progs = append(progs, item.Prog)
+	}
+	assert.ElementsMatch(t, []*prog.Prog{inp1.Prog, inp2.Prog}, progs)
+	assert.Len(t, corpus.Programs(), 2)
+}
+
 func TestCorpusSaveConcurrency(t *testing.T) {
 	target := getTarget(t, targets.TestOS, targets.TestArch64)
 	corpus := NewCorpus(context.Background())
@@ -123,3 +162,37 @@ func getTarget(t *testing.T, os, arch string) *prog.Target {
 	}
 	return target
 }
+
+func TestCorpusDistill(t *testing.T) {
+	target := getTarget(t, targets.TestOS, targets.TestArch64)
+	corpus := NewCorpus(context.Background())
+	save := func(text string, execTime time.Duration) *prog.Prog {
+		p, err := target.Deserialize([]byte(text), prog.Strict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		corpus.Save(NewInput{
+			Prog:     p,
+			Signal:   signal.FromRaw([]uint32{1, 2, 3}, 0),
+			ExecTime: execTime,
+		})
+		return p
+	}
+	save("mutate0()\nmutate1()\nmutate2()\n", 0)
+	slow := save("mutate0()\n", 10*time.Millisecond)
+	fast := save("mutate1()\n", time.Millisecond)
+	items := func() []*prog.Prog {
+		var progs []*prog.Prog
+		for _, item := range corpus.Items() {
+			progs = append(progs, item.Prog)
+		}
+		return progs
+	}
+
+	// The long program is the most expensive one even though its execution time is unknown.
+	corpus.Distill(signal.DistillConfig{Redundancy: 2})
+	assert.ElementsMatch(t, []*prog.Prog{slow, fast}, items())
+	corpus.Distill(signal.DistillConfig{Redundancy: 1})
+	assert.ElementsMatch(t, []*prog.Prog{fast}, items())
+	assert.Len(t, corpus.Programs(), 1)
+}
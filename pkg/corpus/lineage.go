@@ -0,0 +1,204 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package corpus
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/google/syzkaller/pkg/signal"
+)
+
+// HintsMutator is the lineage mutator name of the programs obtained by mutation with hints.
+const HintsMutator = "hints"
+
+// Lineage describes how a corpus program was derived.
+type Lineage struct {
+	// Sig of the corpus program this one was derived from
+	// (empty for generated programs and programs that came from elsewhere).
+	Parent string `json:"parent,omitempty"`
+	// Names of the applied mutators (see prog.MutatorIndex and HintsMutator), sorted.
+	Mutators []string `json:"mutators,omitempty"`
+}
+
+// LineageNode is a corpus program in the derivation graph.
+type LineageNode struct {
+	Sig string `json:"sig"`
+	// Label is a short description of the program (e.g. the call it was saved for).
+	Label string `json:"label,omitempty"`
+	Lineage
+	Children []string `json:"children,omitempty"`
+	// Missing is set for the ancestors that are no longer in the corpus.
+	Missing bool `json:"missing,omitempty"`
+}
+
+// LineageGraph is the derivation DAG of the corpus programs:
+// every program has an edge from the program it was derived from.
+type LineageGraph struct {
+	nodes map[string]*LineageNode
+}
+
+func NewLineageGraph() *LineageGraph {
+	return &LineageGraph{nodes: make(map[string]*LineageNode)}
+}
+
+// Add adds a corpus program to the graph.
+func (g *LineageGraph) Add(sig, label string, lineage Lineage) {
+	node := g.node(sig)
+	node.Label = label
+	node.Lineage = lineage
+	node.Missing = false
+	if lineage.Parent != "" && lineage.Parent != sig {
+		parent := g.node(lineage.Parent)
+		parent.Children = append(parent.Children, sig)
+	}
+}
+
+// AddMissing adds a program that is no longer in the corpus, but is an ancestor of the corpus programs.
+func (g *LineageGraph) AddMissing(sig string, lineage Lineage) {
+	g.Add(sig, "", lineage)
+	g.nodes[sig].Missing = true
+}
+
+func (g *LineageGraph) node(sig string) *LineageNode {
+	node := g.nodes[sig]
+	if node == nil {
+		node = &LineageNode{Sig: sig, Missing: true}
+		g.nodes[sig] = node
+	}
+	return node
+}
+
+// Node returns the program node (nil if the graph does not have it).
+func (g *LineageGraph) Node(sig string) *LineageNode {
+	return g.nodes[sig]
+}
+
+// Nodes returns all nodes sorted by sig.
+func (g *LineageGraph) Nodes() []*LineageNode {
+	ret := make([]*LineageNode, 0, len(g.nodes))
+	for _, node := range g.nodes {
+		sort.Strings(node.Children)
+		ret = append(ret, node)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Sig < ret[j].Sig
+	})
+	return ret
+}
+
+// Ancestry returns the chain of the program ancestors starting from the program itself
+// and ending with the root of its derivation tree.
+func (g *LineageGraph) Ancestry(sig string) []*LineageNode {
+	var ret []*LineageNode
+	seen := make(map[string]bool)
+	for node := g.nodes[sig]; node != nil && !seen[node.Sig]; node = g.nodes[node.Parent] {
+		seen[node.Sig] = true
+		ret = append(ret, node)
+	}
+	return ret
+}
+
+// Depth returns the number of derivation steps from the root of the program derivation tree.
+func (g *LineageGraph) Depth(sig string) int {
+	if ancestry := g.Ancestry(sig); len(ancestry) != 0 {
+		return len(ancestry) - 1
+	}
+	return 0
+}
+
+// WriteJSON writes the graph as a JSON array of nodes.
+func (g *LineageGraph) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(g.Nodes())
+}
+
+// WriteDOT writes the graph in the Graphviz DOT format.
+// The edges go from parents to children and are labeled with the applied mutators.
+func (g *LineageGraph) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph corpus {\n")
+	nodes := g.Nodes()
+	for _, node := range nodes {
+		label := node.Sig
+		if node.Label != "" {
+			label += "\\n" + node.Label
+		}
+		attrs := fmt.Sprintf("label=%q", label)
+		if node.Missing {
+			attrs += " style=dashed"
+		}
+		fmt.Fprintf(&b, "\t%q [%v];\n", node.Sig, attrs)
+	}
+	for _, node := range nodes {
+		if node.Parent == "" || node.Parent == node.Sig {
+			continue
+		}
+		fmt.Fprintf(&b, "\t%q -> %q [label=%q];\n", node.Parent, node.Sig, strings.Join(node.Mutators, ","))
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// LineageGraph returns the derivation graph of the corpus programs,
+// including the removed ancestors (see Ancestors).
+func (corpus *Corpus) LineageGraph() *LineageGraph {
+	corpus.mu.RLock()
+	defer corpus.mu.RUnlock()
+	graph := NewLineageGraph()
+	for sig, item := range corpus.progs {
+		graph.Add(sig, item.StringCall(), item.Meta.Lineage)
+	}
+	for sig, meta := range corpus.collectAncestors(nil) {
+		graph.AddMissing(sig, meta.Lineage)
+	}
+	return graph
+}
+
+// Ancestors returns the metadata (without the signal) of the programs that are no longer
+// in the corpus, but are ancestors of the corpus programs. It's kept so that the ancestries
+// of the corpus programs don't break when their ancestors are minimized out of the corpus.
+func (corpus *Corpus) Ancestors() map[string]ItemMeta {
+	corpus.mu.RLock()
+	defer corpus.mu.RUnlock()
+	return corpus.collectAncestors(nil)
+}
+
+// collectAncestors walks the ancestries of the corpus programs beyond the corpus:
+// removed are the programs that have just left the corpus, the other ancestors are looked up
+// among the previously collected ones and the ones restored after a restart.
+// collectAncestors must be called with corpus.mu held.
+func (corpus *Corpus) collectAncestors(removed map[string]*Item) map[string]ItemMeta {
+	lookup := func(sig string) (ItemMeta, bool) {
+		if item := removed[sig]; item != nil {
+			return item.Meta, true
+		}
+		if meta, ok := corpus.ancestors[sig]; ok {
+			return meta, true
+		}
+		meta, ok := corpus.restored[sig]
+		return meta, ok
+	}
+	ancestors := make(map[string]ItemMeta)
+	for _, item := range corpus.progs {
+		for sig := item.Meta.Lineage.Parent; sig != "" && corpus.progs[sig] == nil; {
+			if _, ok := ancestors[sig]; ok {
+				break
+			}
+			meta, ok := lookup(sig)
+			if !ok {
+				break
+			}
+			meta.Signal, meta.ValueProfile = signal.Serial{}, signal.Serial{}
+			ancestors[sig] = meta
+			sig = meta.Lineage.Parent
+		}
+	}
+	return ancestors
+}
@@ -0,0 +1,114 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package corpus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/rand"
+	"testing"
+
+	"github.com/google/syzkaller/pkg/hash"
+	"github.com/google/syzkaller/pkg/signal"
+	"github.com/google/syzkaller/sys/targets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLineageGraph(t *testing.T) {
+	graph := NewLineageGraph()
+	graph.Add("c", "call2", Lineage{Parent: "b", Mutators: []string{"insert", "splice"}})
+	graph.Add("a", "call0", Lineage{})
+	graph.Add("b", "call1", Lineage{Parent: "a", Mutators: []string{HintsMutator}})
+	graph.Add("e", "call4", Lineage{Parent: "d", Mutators: []string{"squash"}})
+
+	var sigs []string
+	for _, node := range graph.Ancestry("c") {
+		sigs = append(sigs, node.Sig)
+	}
+	assert.Equal(t, []string{"c", "b", "a"}, sigs)
+	assert.Equal(t, 2, graph.Depth("c"))
+	assert.Equal(t, []string{"b"}, graph.Node("a").Children)
+	assert.True(t, graph.Node("d").Missing)
+	assert.False(t, graph.Node("b").Missing)
+	assert.Empty(t, graph.Ancestry("unknown"))
+
+	var dot bytes.Buffer
+	assert.NoError(t, graph.WriteDOT(&dot))
+	assert.Equal(t, `digraph corpus {
+	"a" [label="a\\ncall0"];
+	"b" [label="b\\ncall1"];
+	"c" [label="c\\ncall2"];
+	"d" [label="d" style=dashed];
+	"e" [label="e\\ncall4"];
+	"a" -> "b" [label="hints"];
+	"b" -> "c" [label="insert,splice"];
+	"d" -> "e" [label="squash"];
+}
+`, dot.String())
+
+	var js bytes.Buffer
+	assert.NoError(t, graph.WriteJSON(&js))
+	var nodes []*LineageNode
+	assert.NoError(t, json.Unmarshal(js.Bytes(), &nodes))
+	assert.Equal(t, graph.Nodes(), nodes)
+}
+
+func TestSaveLineage(t *testing.T) {
+	target := getTarget(t, targets.TestOS, targets.TestArch64)
+	rs := rand.NewSource(0)
+	corpus := NewCorpus(context.Background())
+	parent := generateInput(target, rs, 5, 5)
+	corpus.Save(parent)
+	parentSig := hash.String(parent.Prog.Serialize())
+	assert.Equal(t, Lineage{}, corpus.Item(parentSig).Meta.Lineage)
+
+	child := generateInput(target, rs, 5, 5)
+	child.Lineage = Lineage{Parent: parentSig, Mutators: []string{"splice"}}
+	corpus.Save(child)
+	childSig := hash.String(child.Prog.Serialize())
+	assert.Equal(t, child.Lineage, corpus.Item(childSig).Meta.Lineage)
+
+	// The lineage of the first discovery is kept.
+	child.Lineage = Lineage{}
+	corpus.Save(child)
+	assert.Equal(t, parentSig, corpus.Item(childSig).Meta.Lineage.Parent)
+}
+
+func TestMinimizedAncestors(t *testing.T) {
+	target := getTarget(t, targets.TestOS, targets.TestArch64)
+	rs := rand.NewSource(0)
+	corpus := NewCorpus(context.Background())
+	save := func(parent string, prio uint8) string {
+		inp := generateInput(target, rs, 5, 0)
+		inp.Signal = signal.FromRaw([]uint32{1, 2, 3}, prio)
+		inp.Lineage = Lineage{Parent: parent, Mutators: []string{"insert"}}
+		corpus.Save(inp)
+		return hash.String(inp.Prog.Serialize())
+	}
+	// c has the same signal with a higher priority, so only c survives minimization.
+	a := save("", 0)
+	b := save(a, 0)
+	c := save(b, 1)
+	corpus.Minimize(false)
+	assert.Len(t, corpus.Items(), 1)
+
+	ancestors := corpus.Ancestors()
+	assert.Len(t, ancestors, 2)
+	assert.Equal(t, a, ancestors[b].Lineage.Parent)
+	assert.Empty(t, ancestors[b].Signal.Elems)
+
+	graph := corpus.LineageGraph()
+	var sigs []string
+	for _, node := range graph.Ancestry(c) {
+		sigs = append(sigs, node.Sig)
+	}
+	assert.Equal(t, []string{c, b, a}, sigs)
+	assert.True(t, graph.Node(b).Missing)
+	assert.False(t, graph.Node(c).Missing)
+
+	// The ancestors survive further minimizations.
+	corpus.Minimize(false)
+	assert.Len(t, corpus.Ancestors(), 2)
+}
@@ -0,0 +1,135 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package corpus
+
+import (
+	"time"
+
+	"github.com/google/syzkaller/pkg/ipc"
+	"github.com/google/syzkaller/pkg/rpctype"
+	"github.com/google/syzkaller/pkg/signal"
+	"github.com/google/syzkaller/prog"
+)
+
+// ItemMeta is the fuzzing history of a corpus program.
+// syz-manager persists it across restarts.
+type ItemMeta struct {
+	// When the program was first added to the corpus.
+	Added time.Time `json:"added"`
+	// How many times the program was mutated.
+	Mutated uint64 `json:"mutated,omitempty"`
+	// How many mutants of the program have given new signal, by the applied mutators.
+	Mutators map[string]uint64 `json:"mutators,omitempty"`
+	// How the program was derived.
+	Lineage Lineage `json:"lineage"`
+	// Signal the program owned when the metadata was persisted.
+	// syz-manager sets it on every save (syz-db distill relies on it),
+	// the corpus items don't keep it in memory.
+	Signal signal.Serial `json:"signal"`
+	// How long the program took to execute during triage (zero if unknown).
+	ExecTime time.Duration `json:"exec_time,omitempty"`
+	// Value profile signal the program owned when the metadata was persisted
+	// (not kept in memory either). Such programs are re-triaged for the value profile after a restart,
+	// otherwise the ones that don't give new coverage would be lost.
+	ValueProfile signal.Serial `json:"value_profile,omitempty"`
+}
+
+func (meta ItemMeta) merge(delta rpctype.ProgMeta) ItemMeta {
+	meta.Mutated += delta.Mutated
+	if len(delta.Mutators) != 0 {
+		mutators := make(map[string]uint64, len(meta.Mutators))
+		for name, count := range meta.Mutators {
+			mutators[name] = count
+		}
+		for name, count := range delta.Mutators {
+			mutators[name] += count
+		}
+		meta.Mutators = mutators
+	}
+	return meta
+}
+
+// RestoreMeta sets the metadata the items will get once they are saved
+// (the programs are re-triaged after a restart, so they can't be restored right away).
+func (corpus *Corpus) RestoreMeta(metas map[string]ItemMeta) {
+	corpus.mu.Lock()
+	defer corpus.mu.Unlock()
+	corpus.restored = metas
+}
+
+// newItemMeta must be called with corpus.mu held.
+func (corpus *Corpus) newItemMeta(sig string, lineage Lineage, execTime time.Duration) ItemMeta {
+	if meta, ok := corpus.restored[sig]; ok {
+		delete(corpus.restored, sig)
+		// The item has its own live signal.
+		meta.Signal, meta.ValueProfile = signal.Serial{}, signal.Serial{}
+		if execTime != 0 {
+			meta.ExecTime = execTime
+		}
+		return meta
+	}
+	return ItemMeta{Added: time.Now(), Lineage: lineage, ExecTime: execTime}
+}
+
+// UpdateMeta merges the metadata changes reported by a fuzzer and returns the updated item
+// (nil if there is no such item).
+func (corpus *Corpus) UpdateMeta(sig string, delta rpctype.ProgMeta) *Item {
+	corpus.mu.Lock()
+	defer corpus.mu.Unlock()
+	old := corpus.progs[sig]
+	if old == nil {
+		return nil
+	}
+	item := *old
+	item.Meta = old.Meta.merge(delta)
+	corpus.progs[sig] = &item
+	return &item
+}
+
+// Fuzzed accounts an execution of a mutant of the corpus program p: it updates the seed
+// scheduler and the metadata of the program (see GrabMetaUpdates).
+func (corpus *Corpus) Fuzzed(p *prog.Prog, info *ipc.ProgInfo, mutators map[prog.MutatorIndex]int,
+	newSignal bool) {
+	corpus.fuzzed(p, info)
+	corpus.metaMu.Lock()
+	defer corpus.metaMu.Unlock()
+	delta := corpus.metaUpdates[p]
+	if delta == nil {
+		delta = &rpctype.ProgMeta{}
+		corpus.metaUpdates[p] = delta
+	}
+	delta.Mutated++
+	if newSignal && len(mutators) != 0 {
+		if delta.Mutators == nil {
+			delta.Mutators = make(map[string]uint64)
+		}
+		for idx := range mutators {
+			delta.Mutators[idx.String()]++
+		}
+	}
+}
+
+// GrabMetaUpdates returns the metadata changes accumulated since the previous call.
+// The changes of the programs that are no longer in the corpus are dropped.
+func (corpus *Corpus) GrabMetaUpdates() map[string]rpctype.ProgMeta {
+	corpus.metaMu.Lock()
+	updates := corpus.metaUpdates
+	corpus.metaUpdates = make(map[*prog.Prog]*rpctype.ProgMeta)
+	corpus.metaMu.Unlock()
+
+	corpus.mu.RLock()
+	defer corpus.mu.RUnlock()
+	var ret map[string]rpctype.ProgMeta
+	for p, delta := range updates {
+		sig, ok := corpus.sigs[p]
+		if !ok {
+			continue
+		}
+		if ret == nil {
+			ret = make(map[string]rpctype.ProgMeta, len(updates))
+		}
+		ret[sig] = *delta
+	}
+	return ret
+}
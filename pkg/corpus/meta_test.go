@@ -0,0 +1,71 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package corpus
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/pkg/hash"
+	"github.com/google/syzkaller/pkg/ipc"
+	"github.com/google/syzkaller/pkg/rpctype"
+	"github.com/google/syzkaller/prog"
+	"github.com/google/syzkaller/sys/targets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestItemMeta(t *testing.T) {
+	target := getTarget(t, targets.TestOS, targets.TestArch64)
+	rs := rand.NewSource(0)
+	fuzzerCorpus := NewCorpus(context.Background())
+	inp := generateInput(target, rs, 5, 5)
+	fuzzerCorpus.Save(inp)
+	sig := hash.String(inp.Prog.Serialize())
+	assert.WithinDuration(t, time.Now(), fuzzerCorpus.Item(sig).Meta.Added, time.Minute)
+
+	assert.Nil(t, fuzzerCorpus.GrabMetaUpdates())
+	splice := map[prog.MutatorIndex]int{prog.MutatorIndexSplice: 1}
+	insert := map[prog.MutatorIndex]int{prog.MutatorIndexInsertCall: 2}
+	fuzzerCorpus.Fuzzed(inp.Prog, &ipc.ProgInfo{}, splice, true)
+	fuzzerCorpus.Fuzzed(inp.Prog, &ipc.ProgInfo{}, insert, false)
+	fuzzerCorpus.Fuzzed(inp.Prog, &ipc.ProgInfo{}, splice, true)
+	// The updates of programs that are not in the corpus are dropped.
+	fuzzerCorpus.Fuzzed(generateInput(target, rs, 5, 5).Prog, &ipc.ProgInfo{}, splice, true)
+	updates := fuzzerCorpus.GrabMetaUpdates()
+	assert.Equal(t, map[string]rpctype.ProgMeta{
+		sig: {
+			Mutated:  3,
+			Mutators: map[string]uint64{prog.MutatorIndexSplice.String(): 2},
+		},
+	}, updates)
+	assert.Nil(t, fuzzerCorpus.GrabMetaUpdates())
+
+	// The manager restores the metadata, gets the program after triage and the updates.
+	added := time.Now().Add(-time.Hour)
+	managerCorpus := NewCorpus(context.Background())
+	managerCorpus.RestoreMeta(map[string]ItemMeta{
+		sig: {
+			Added:    added,
+			Mutated:  10,
+			Mutators: map[string]uint64{prog.MutatorIndexSplice.String(): 1},
+		},
+	})
+	assert.Nil(t, managerCorpus.UpdateMeta(sig, updates[sig]))
+	managerCorpus.Save(inp)
+	restored := managerCorpus.Item(sig)
+	item := managerCorpus.UpdateMeta(sig, updates[sig])
+	assert.Equal(t, ItemMeta{
+		Added:    added,
+		Mutated:  13,
+		Mutators: map[string]uint64{prog.MutatorIndexSplice.String(): 3},
+	}, item.Meta)
+	assert.Equal(t, item, managerCorpus.Item(sig))
+	assert.Equal(t, uint64(10), restored.Meta.Mutated, "items are immutable")
+
+	inp.Call = 0
+	managerCorpus.Save(inp)
+	assert.Equal(t, item.Meta, managerCorpus.Item(sig).Meta)
+}
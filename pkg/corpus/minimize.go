@@ -5,8 +5,10 @@ package corpus
 
 import (
 	"sort"
+	"time"
 
 	"github.com/google/syzkaller/pkg/signal"
+	"github.com/google/syzkaller/prog"
 )
 
 func (corpus *Corpus) Minimize(cover bool) {
@@ -20,22 +22,128 @@ func (corpus *Corpus) Minimize(cover bool) {
 			Context: inp,
 		})
 	}
+	vpInputs := corpus.valueProfileInputs()
 
 	// Note: inputs are unsorted (based on map iteration).
 	// This gives some intentional non-determinism during minimization.
 	// However, we want to give preference to non-squashed inputs,
 	// so let's sort by this criteria.
-	sort.SliceStable(inputs, func(i, j int) bool {
-		firstAny := inputs[i].Context.(*Item).HasAny
-		secondAny := inputs[j].Context.(*Item).HasAny
-		return !firstAny && secondAny
+	preferNonSquashed := func(inputs []signal.Context) {
+		sort.SliceStable(inputs, func(i, j int) bool {
+			firstAny := inputs[i].Context.(*Item).HasAny
+			secondAny := inputs[j].Context.(*Item).HasAny
+			return !firstAny && secondAny
+		})
+	}
+	preferNonSquashed(inputs)
+	preferNonSquashed(vpInputs)
+
+	// The value profile signal is a separate namespace, so the inputs needed
+	// to keep it are added to the inputs needed to keep the coverage signal.
+	corpus.keep(append(signal.Minimize(inputs), signal.Minimize(vpInputs)...))
+}
+
+// Distill is an alternative to Minimize that prefers short and fast programs,
+// keeps several programs for the rare signal and can bound the corpus size (see DistillItems).
+// Programs kept for the value profile signal are not accounted in cfg.Budget.
+// Here the signal is rare if few corpus programs cover it: distillation runs in syz-manager
+// and syz-db, which don't execute programs and so don't have the fuzzers' signal.HitCounts.
+func (corpus *Corpus) Distill(cfg signal.DistillConfig) {
+	corpus.mu.Lock()
+	defer corpus.mu.Unlock()
+
+	items := make([]DistillItem, 0, len(corpus.progs))
+	for _, inp := range corpus.progs {
+		items = append(items, DistillItem{
+			Signal:   inp.Signal,
+			Calls:    len(inp.Prog.Calls),
+			ExecTime: inp.Meta.ExecTime,
+			Squashed: inp.HasAny,
+			Context:  inp,
+		})
+	}
+	// Unlike Minimize, make the result depend only on the corpus contents.
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Context.(*Item).Sig < items[j].Context.(*Item).Sig
 	})
+	corpus.keep(append(DistillItems(items, cfg), signal.Minimize(corpus.valueProfileInputs())...))
+}
 
+// DistillItem is a program considered by DistillItems.
+type DistillItem struct {
+	Signal signal.Signal
+	Calls  int
+	// Zero if unknown.
+	ExecTime time.Duration
+	// Whether the program contains squashed arguments.
+	Squashed bool
+	Context  interface{}
+}
+
+// DistillItems selects the programs to keep with signal.Distill.
+// The cost of a program is the number of its calls scaled by its execution time relative
+// to the average one (programs with unknown execution time are considered average),
+// squashed programs cost twice as much since they are harder to mutate.
+func DistillItems(items []DistillItem, cfg signal.DistillConfig) []interface{} {
+	var total time.Duration
+	known := 0
+	for _, item := range items {
+		if item.ExecTime > 0 {
+			total += item.ExecTime
+			known++
+		}
+	}
+	inputs := make([]signal.DistillInput, len(items))
+	for i, item := range items {
+		cost := float64(item.Calls)
+		if cost < 1 {
+			cost = 1
+		}
+		if item.ExecTime > 0 {
+			cost *= float64(item.ExecTime) * float64(known) / float64(total)
+		}
+		if item.Squashed {
+			cost *= 2
+		}
+		inputs[i] = signal.DistillInput{
+			Signal:  item.Signal,
+			Cost:    cost,
+			Context: item.Context,
+		}
+	}
+	return signal.Distill(inputs, cfg)
+}
+
+// valueProfileInputs must be called with corpus.mu held.
+func (corpus *Corpus) valueProfileInputs() []signal.Context {
+	var vpInputs []signal.Context
+	for _, inp := range corpus.progs {
+		if !inp.ValueProfile.Empty() {
+			vpInputs = append(vpInputs, signal.Context{
+				Signal:  inp.ValueProfile,
+				Context: inp,
+			})
+		}
+	}
+	return vpInputs
+}
+
+// keep replaces the corpus contents with the items, it must be called with corpus.mu held.
+func (corpus *Corpus) keep(items []interface{}) {
+	removed := corpus.progs
 	corpus.progs = make(map[string]*Item)
-	corpus.ProgramsList = ProgramsList{}
-	for _, ctx := range signal.Minimize(inputs) {
+	if err := corpus.reset(corpus.schedule); err != nil {
+		panic(err)
+	}
+	corpus.sigs = make(map[*prog.Prog]string)
+	for _, ctx := range items {
 		inp := ctx.(*Item)
+		if corpus.progs[inp.Sig] != nil {
+			continue
+		}
 		corpus.progs[inp.Sig] = inp
 		corpus.saveProgram(inp.Prog, inp.Signal)
+		corpus.sigs[inp.Prog] = inp.Sig
 	}
+	corpus.ancestors = corpus.collectAncestors(removed)
 }
@@ -5,9 +5,10 @@ package corpus
 
 import (
 	"math/rand"
-	"sort"
 	"sync"
+	"sync/atomic"
 
+	"github.com/google/syzkaller/pkg/ipc"
 	"github.com/google/syzkaller/pkg/signal"
 	"github.com/google/syzkaller/prog"
 )
@@ -15,33 +16,70 @@ import (
 type ProgramsList struct {
 	mu       sync.RWMutex
 	progs    []*prog.Prog
-	sumPrios int64
-	accPrios []int64
+	schedule string
+	sched    SeedScheduler
+	// Whether sched needs Fuzzed calls, it's read without the lock.
+	feedback atomic.Bool
+	hits     *signal.HitCounts // see SetHitCounts
+	// Incremented whenever programs are dropped from the list.
+	gen uint64
 }
 
-func (pl *ProgramsList) saveProgram(p *prog.Prog, signal signal.Signal) {
+// reset drops all programs and starts over with the given seed schedule.
+func (pl *ProgramsList) reset(schedule string) error {
+	sched, err := NewSeedScheduler(schedule)
+	if err != nil {
+		return err
+	}
 	pl.mu.Lock()
 	defer pl.mu.Unlock()
-	prio := int64(len(signal))
-	if prio == 0 {
-		prio = 1
+	pl.progs = nil
+	pl.gen++
+	pl.schedule = schedule
+	pl.sched = sched
+	pl.feedback.Store(sched.NeedsFeedback())
+	pl.useHitCounts()
+	return nil
+}
+
+// SetHitCounts makes the seed schedulers that depend on how rare the signal is (see "fast")
+// use the shared table instead of counting the hits of the fuzzed programs themselves.
+// The owner of the table must record all executions in it before calling Fuzzed.
+func (pl *ProgramsList) SetHitCounts(hits *signal.HitCounts) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	pl.hits = hits
+	pl.useHitCounts()
+}
+
+// useHitCounts must be called with pl.mu held.
+func (pl *ProgramsList) useHitCounts() {
+	if sched, ok := pl.sched.(interface{ useHitCounts(*signal.HitCounts) }); ok && pl.hits != nil {
+		sched.useHitCounts(pl.hits)
 	}
-	pl.sumPrios += prio
-	pl.accPrios = append(pl.accPrios, pl.sumPrios)
+}
+
+func (pl *ProgramsList) saveProgram(p *prog.Prog, signal signal.Signal) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	pl.sched.Save(p, signal)
 	pl.progs = append(pl.progs, p)
 }
 
 func (pl *ProgramsList) ChooseProgram(r *rand.Rand) *prog.Prog {
 	pl.mu.RLock()
 	defer pl.mu.RUnlock()
-	if len(pl.progs) == 0 {
-		return nil
+	return pl.sched.Choose(r)
+}
+
+// fuzzed updates the energy of the corpus program p after its mutant has been executed.
+func (pl *ProgramsList) fuzzed(p *prog.Prog, info *ipc.ProgInfo) {
+	if !pl.feedback.Load() {
+		return
 	}
-	randVal := r.Int63n(pl.sumPrios + 1)
-	idx := sort.Search(len(pl.accPrios), func(i int) bool {
-		return pl.accPrios[i] >= randVal
-	})
-	return pl.progs[idx]
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	pl.sched.Fuzzed(p, info)
 }
 
 func (pl *ProgramsList) Programs() []*prog.Prog {
@@ -49,3 +87,18 @@ func (pl *ProgramsList) Programs() []*prog.Prog {
 	defer pl.mu.RUnlock()
 	return pl.progs
 }
+
+// ProgramsGen returns the programs together with the generation of the list.
+// The generation changes whenever programs are dropped (e.g. on minimization),
+// so within one generation the list only grows.
+func (pl *ProgramsList) ProgramsGen() ([]*prog.Prog, uint64) {
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+	return pl.progs, pl.gen
+}
+
+func (pl *ProgramsList) energy(p *prog.Prog) float64 {
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+	return pl.sched.Energy(p)
+}
@@ -0,0 +1,351 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package corpus
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"math/rand"
+	"sort"
+
+	"github.com/google/syzkaller/pkg/ipc"
+	"github.com/google/syzkaller/pkg/signal"
+	"github.com/google/syzkaller/prog"
+)
+
+// SeedScheduler decides how often each corpus program is chosen for mutation.
+// Each program gets an energy, and programs are chosen with probability proportional to it.
+// The implementations are not synchronized, ProgramsList serializes accesses to them.
+type SeedScheduler interface {
+	// Save adds a new corpus program.
+	Save(p *prog.Prog, signal signal.Signal)
+	// Choose returns a corpus program, or nil if there are none.
+	Choose(r *rand.Rand) *prog.Prog
+	// Fuzzed is called after a mutant of the corpus program p has been executed.
+	Fuzzed(p *prog.Prog, info *ipc.ProgInfo)
+	// NeedsFeedback says whether Fuzzed changes anything. If it does not,
+	// the calls are skipped to not serialize the executions on the scheduler lock.
+	NeedsFeedback() bool
+	// Energy returns the current energy of the program (0 if it's not in the corpus).
+	Energy(p *prog.Prog) float64
+}
+
+const DefaultSeedSchedule = "signal"
+
+var seedSchedules = map[string]func() SeedScheduler{
+	// The probability is proportional to the signal of the program at the time it was saved.
+	"signal": func() SeedScheduler { return &signalScheduler{} },
+	// AFLFast FAST schedule: the energy grows with the number of times the program
+	// was fuzzed and is inversely proportional to the number of executions
+	// that have hit the rarest signal of the program.
+	"fast": func() SeedScheduler { return newRareScheduler(false) },
+	// AFLFast COE schedule: like FAST, but the programs whose rarest signal was hit more
+	// often than on average are not fuzzed at all.
+	"coe": func() SeedScheduler { return newRareScheduler(true) },
+	// The energy of a program halves each time ageHalfLife newer programs are added.
+	"age": func() SeedScheduler { return &ageScheduler{} },
+	// The energy of a program is inversely proportional to the number of times it was fuzzed.
+	"fuzz-count": func() SeedScheduler { return &fuzzCountScheduler{} },
+}
+
+// SeedSchedules returns the names of the supported seed schedules.
+func SeedSchedules() []string {
+	var names []string
+	for name := range seedSchedules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewSeedScheduler creates a seed scheduler by its name (DefaultSeedSchedule if name is empty).
+func NewSeedScheduler(name string) (SeedScheduler, error) {
+	if name == "" {
+		name = DefaultSeedSchedule
+	}
+	ctor := seedSchedules[name]
+	if ctor == nil {
+		return nil, fmt.Errorf("unknown seed schedule %q, supported: %q", name, SeedSchedules())
+	}
+	return ctor(), nil
+}
+
+// weightedSeeds allows to choose programs with probability proportional to their weights
+// and to change the weights in O(log n).
+type weightedSeeds struct {
+	progs   []*prog.Prog
+	index   map[*prog.Prog]int
+	weights []float64
+	tree    []float64 // Fenwick tree over weights
+}
+
+func (ws *weightedSeeds) add(p *prog.Prog, weight float64) int {
+	if ws.index == nil {
+		ws.index = make(map[*prog.Prog]int)
+	}
+	idx := len(ws.progs)
+	ws.index[p] = idx
+	ws.progs = append(ws.progs, p)
+	ws.weights = append(ws.weights, 0)
+	// The new node covers the range [idx&(idx+1), idx], sum the covered nodes up.
+	node := 0.0
+	for i := idx - 1; i >= idx&(idx+1); i = i&(i+1) - 1 {
+		node += ws.tree[i]
+	}
+	ws.tree = append(ws.tree, node)
+	ws.set(idx, weight)
+	return idx
+}
+
+func (ws *weightedSeeds) set(idx int, weight float64) {
+	delta := weight - ws.weights[idx]
+	ws.weights[idx] = weight
+	for i := idx; i < len(ws.tree); i |= i + 1 {
+		ws.tree[i] += delta
+	}
+}
+
+func (ws *weightedSeeds) total() float64 {
+	sum := 0.0
+	for i := len(ws.tree) - 1; i >= 0; i = i&(i+1) - 1 {
+		sum += ws.tree[i]
+	}
+	return sum
+}
+
+func (ws *weightedSeeds) choose(r *rand.Rand) *prog.Prog {
+	if len(ws.progs) == 0 {
+		return nil
+	}
+	total := ws.total()
+	if total <= 0 {
+		return ws.progs[r.Intn(len(ws.progs))]
+	}
+	val := r.Float64() * total
+	// Descend the Fenwick tree looking for the first prefix sum that exceeds val.
+	pos := 0
+	step := 1
+	for step*2 <= len(ws.tree) {
+		step *= 2
+	}
+	for ; step > 0; step /= 2 {
+		if next := pos + step; next <= len(ws.tree) && ws.tree[next-1] <= val {
+			pos = next
+			val -= ws.tree[next-1]
+		}
+	}
+	if pos >= len(ws.progs) {
+		// Possible due to floating point rounding.
+		pos = len(ws.progs) - 1
+	}
+	return ws.progs[pos]
+}
+
+func (ws *weightedSeeds) Choose(r *rand.Rand) *prog.Prog {
+	return ws.choose(r)
+}
+
+func (ws *weightedSeeds) Energy(p *prog.Prog) float64 {
+	idx, ok := ws.index[p]
+	if !ok {
+		return 0
+	}
+	return ws.weights[idx]
+}
+
+func signalWeight(signal signal.Signal) float64 {
+	return math.Max(float64(len(signal)), 1)
+}
+
+type signalScheduler struct {
+	weightedSeeds
+}
+
+func (sched *signalScheduler) Save(p *prog.Prog, signal signal.Signal) {
+	sched.add(p, signalWeight(signal))
+}
+
+func (sched *signalScheduler) Fuzzed(p *prog.Prog, info *ipc.ProgInfo) {}
+
+func (sched *signalScheduler) NeedsFeedback() bool {
+	return false
+}
+
+type fuzzCountScheduler struct {
+	weightedSeeds
+	base  []float64
+	count []int
+}
+
+func (sched *fuzzCountScheduler) Save(p *prog.Prog, signal signal.Signal) {
+	sched.add(p, signalWeight(signal))
+	sched.base = append(sched.base, signalWeight(signal))
+	sched.count = append(sched.count, 0)
+}
+
+func (sched *fuzzCountScheduler) Fuzzed(p *prog.Prog, info *ipc.ProgInfo) {
+	idx, ok := sched.index[p]
+	if !ok {
+		return
+	}
+	sched.count[idx]++
+	sched.set(idx, sched.base[idx]/float64(1+sched.count[idx]))
+}
+
+func (sched *fuzzCountScheduler) NeedsFeedback() bool {
+	return true
+}
+
+// ageHalfLife is the number of newer programs after which the energy of a program halves.
+const ageHalfLife = 1000
+
+type ageScheduler struct {
+	weightedSeeds
+	base  []float64
+	saved []int // the value of the saves counter when the program was saved
+	saves int
+	// Instead of decaying the weights of all older programs on each save,
+	// the weights of newer programs are scaled up by 2^((saved-epoch)/ageHalfLife).
+	epoch int
+}
+
+func (sched *ageScheduler) Save(p *prog.Prog, signal signal.Signal) {
+	if sched.saves-sched.epoch >= 256*ageHalfLife {
+		// Rescale all weights before they overflow.
+		sched.epoch = sched.saves
+		for idx := range sched.progs {
+			sched.set(idx, sched.scaled(idx))
+		}
+	}
+	sched.base = append(sched.base, signalWeight(signal))
+	sched.saved = append(sched.saved, sched.saves)
+	sched.add(p, sched.scaled(len(sched.progs)))
+	sched.saves++
+}
+
+func (sched *ageScheduler) scaled(idx int) float64 {
+	return sched.base[idx] * math.Exp2(float64(sched.saved[idx]-sched.epoch)/ageHalfLife)
+}
+
+func (sched *ageScheduler) Fuzzed(p *prog.Prog, info *ipc.ProgInfo) {}
+
+func (sched *ageScheduler) NeedsFeedback() bool {
+	return false
+}
+
+func (sched *ageScheduler) Energy(p *prog.Prog) float64 {
+	idx, ok := sched.index[p]
+	if !ok {
+		return 0
+	}
+	return sched.base[idx] * math.Exp2(float64(sched.saved[idx]-sched.saves+1)/ageHalfLife)
+}
+
+const (
+	// The energy of the FAST/COE schedules is capped at rareMaxEnergy.
+	rareMaxEnergy = 1 << 10
+	// Hit counts of the signal change the energy of many programs at once,
+	// so all energies are recalculated every rareRecalcPeriod fuzzed programs.
+	rareRecalcPeriod = 1000
+)
+
+type rareScheduler struct {
+	weightedSeeds
+	coe     bool
+	signals []signal.Signal
+	count   []int
+	// The number of executions that have hit each signal element. Unless the scheduler
+	// was given a shared table (see ProgramsList.SetHitCounts), it counts the executions
+	// of the fuzzed programs itself.
+	hits     *signal.HitCounts
+	ownHits  bool
+	meanHits float64
+	fuzzed   int
+}
+
+func newRareScheduler(coe bool) *rareScheduler {
+	return &rareScheduler{
+		coe:     coe,
+		hits:    new(signal.HitCounts),
+		ownHits: true,
+	}
+}
+
+func (sched *rareScheduler) useHitCounts(hits *signal.HitCounts) {
+	sched.hits = hits
+	sched.ownHits = false
+}
+
+func (sched *rareScheduler) Save(p *prog.Prog, sig signal.Signal) {
+	sched.signals = append(sched.signals, sig)
+	sched.count = append(sched.count, 0)
+	idx := sched.add(p, 0)
+	sched.set(idx, sched.energy(idx))
+}
+
+func (sched *rareScheduler) Fuzzed(p *prog.Prog, info *ipc.ProgInfo) {
+	idx, ok := sched.index[p]
+	if !ok {
+		return
+	}
+	sched.count[idx]++
+	if info != nil && sched.ownHits {
+		raws := [][]uint32{info.Extra.Signal}
+		for i := range info.Calls {
+			raws = append(raws, info.Calls[i].Signal)
+		}
+		sched.hits.Record(raws...)
+	}
+	sched.fuzzed++
+	if sched.fuzzed%rareRecalcPeriod == 0 {
+		sched.recalc()
+		return
+	}
+	sched.set(idx, sched.energy(idx))
+}
+
+func (sched *rareScheduler) NeedsFeedback() bool {
+	return true
+}
+
+func (sched *rareScheduler) recalc() {
+	sum := 0.0
+	for idx := range sched.progs {
+		sum += float64(sched.pathFrequency(idx))
+	}
+	sched.meanHits = sum / float64(len(sched.progs))
+	for idx := range sched.progs {
+		sched.set(idx, sched.energy(idx))
+	}
+}
+
+// pathFrequency is the AFLFast f(i), the number of executions that have hit the rarest
+// signal of the program (plus the execution that has discovered it).
+func (sched *rareScheduler) pathFrequency(idx int) int {
+	rarest := -1
+	for elem := range sched.signals[idx] {
+		if count := int(sched.hits.Count(uint32(elem))); rarest == -1 || count < rarest {
+			rarest = count
+		}
+	}
+	if rarest == -1 {
+		// The program has no signal, use the number of times it was fuzzed instead.
+		rarest = sched.count[idx]
+	}
+	return rarest + 1
+}
+
+func (sched *rareScheduler) energy(idx int) float64 {
+	freq := sched.pathFrequency(idx)
+	if sched.coe && sched.meanHits != 0 && float64(freq) > sched.meanHits {
+		return 0
+	}
+	// AFLFast s(i) is the number of times the program was chosen from the queue, and each time
+	// the number of its mutants doubles. Here programs are chosen for a single mutation,
+	// so s(i) is the number of doublings of the number of times the program was fuzzed.
+	rounds := bits.Len(uint(sched.count[idx]))
+	energy := math.Exp2(float64(rounds)) / float64(freq)
+	return math.Min(energy, rareMaxEnergy)
+}
@@ -0,0 +1,145 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package corpus
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/google/syzkaller/pkg/ipc"
+	"github.com/google/syzkaller/pkg/signal"
+	"github.com/google/syzkaller/prog"
+	"github.com/google/syzkaller/sys/targets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWeightedSeeds(t *testing.T) {
+	r := rand.New(rand.NewSource(0))
+	var ws weightedSeeds
+	var progs []*prog.Prog
+	for i := 0; i < 100; i++ {
+		p := &prog.Prog{}
+		progs = append(progs, p)
+		ws.add(p, float64(r.Intn(10)))
+	}
+	for i := 0; i < 100; i++ {
+		ws.set(r.Intn(len(progs)), float64(r.Intn(10)))
+	}
+	total := 0.0
+	for _, w := range ws.weights {
+		total += w
+	}
+	assert.InDelta(t, total, ws.total(), 1e-9)
+
+	const iters = 100000
+	counts := make(map[*prog.Prog]int)
+	for i := 0; i < iters; i++ {
+		counts[ws.choose(r)]++
+	}
+	for idx, p := range progs {
+		expected := ws.weights[idx] / total * iters
+		if ws.weights[idx] == 0 {
+			assert.Zero(t, counts[p])
+			continue
+		}
+		assert.InDelta(t, expected, counts[p], 5*math.Sqrt(expected)+1)
+	}
+}
+
+func TestSeedSchedules(t *testing.T) {
+	target := getTarget(t, targets.TestOS, targets.TestArch64)
+	rs := rand.NewSource(0)
+	for _, name := range SeedSchedules() {
+		corpus := NewCorpus(context.Background())
+		assert.NoError(t, corpus.SetSeedSchedule(name))
+		for i := 0; i < 10; i++ {
+			corpus.Save(generateInput(target, rs, 5, i+1))
+		}
+		assert.Error(t, corpus.SetSeedSchedule(name))
+		r := rand.New(rs)
+		for i := 0; i < 100; i++ {
+			p := corpus.ChooseProgram(r)
+			assert.NotNil(t, p, name)
+			corpus.Fuzzed(p, &ipc.ProgInfo{}, nil, false)
+		}
+		energies := corpus.Energies()
+		assert.Len(t, energies, 10, name)
+		for _, energy := range energies {
+			assert.GreaterOrEqual(t, energy, 0.0, name)
+		}
+	}
+	_, err := NewSeedScheduler("foo")
+	assert.Error(t, err)
+}
+
+func TestFuzzCountSchedule(t *testing.T) {
+	sched, _ := NewSeedScheduler("fuzz-count")
+	assert.True(t, sched.NeedsFeedback())
+	a, b := &prog.Prog{}, &prog.Prog{}
+	sched.Save(a, signal.FromRaw([]uint32{1, 2}, 0))
+	sched.Save(b, signal.FromRaw([]uint32{3, 4}, 0))
+	assert.Equal(t, 2.0, sched.Energy(a))
+	sched.Fuzzed(a, nil)
+	sched.Fuzzed(a, nil)
+	sched.Fuzzed(a, nil)
+	assert.Equal(t, 0.5, sched.Energy(a))
+	assert.Equal(t, 2.0, sched.Energy(b))
+}
+
+func TestAgeSchedule(t *testing.T) {
+	sched, _ := NewSeedScheduler("age")
+	assert.False(t, sched.NeedsFeedback())
+	first := &prog.Prog{}
+	sched.Save(first, signal.FromRaw([]uint32{1}, 0))
+	assert.Equal(t, 1.0, sched.Energy(first))
+	var last *prog.Prog
+	for i := 0; i < ageHalfLife; i++ {
+		last = &prog.Prog{}
+		sched.Save(last, signal.FromRaw([]uint32{1}, 0))
+	}
+	assert.InDelta(t, 0.5, sched.Energy(first), 1e-9)
+	assert.Equal(t, 1.0, sched.Energy(last))
+}
+
+func TestRareSchedule(t *testing.T) {
+	for _, name := range []string{"fast", "coe"} {
+		sched, _ := NewSeedScheduler(name)
+		common, rare := &prog.Prog{}, &prog.Prog{}
+		sched.Save(common, signal.FromRaw([]uint32{1, 2}, 0))
+		sched.Save(rare, signal.FromRaw([]uint32{3, 4}, 0))
+		assert.Equal(t, sched.Energy(common), sched.Energy(rare), name)
+		// Mutants of the common program hit its signal over and over again,
+		// while the rare program produces a mutant with new signal once.
+		for i := 0; i < rareRecalcPeriod-1; i++ {
+			sched.Fuzzed(common, &ipc.ProgInfo{Calls: []ipc.CallInfo{{Signal: []uint32{1, 2, 5}}}})
+		}
+		sched.Fuzzed(rare, &ipc.ProgInfo{Calls: []ipc.CallInfo{{Signal: []uint32{3, 6}}}})
+		assert.Greater(t, sched.Energy(rare), sched.Energy(common), name)
+		if name == "coe" {
+			assert.Zero(t, sched.Energy(common))
+		}
+	}
+}
+
+func TestRareScheduleHitCounts(t *testing.T) {
+	pl := new(ProgramsList)
+	hits := new(signal.HitCounts)
+	pl.SetHitCounts(hits)
+	assert.NoError(t, pl.reset("fast"))
+	common, rare := &prog.Prog{}, &prog.Prog{}
+	pl.saveProgram(common, signal.FromRaw([]uint32{1, 2}, 0))
+	pl.saveProgram(rare, signal.FromRaw([]uint32{3, 4}, 0))
+	// The executions are recorded by the owner of the shared table, not by the scheduler.
+	info := &ipc.ProgInfo{Calls: []ipc.CallInfo{{Signal: []uint32{1, 2}}}}
+	for i := 0; i < rareRecalcPeriod-1; i++ {
+		hits.Record(info.Calls[0].Signal)
+		pl.fuzzed(common, info)
+	}
+	pl.fuzzed(rare, &ipc.ProgInfo{Calls: []ipc.CallInfo{{Signal: []uint32{3}}}})
+	assert.Equal(t, uint32(rareRecalcPeriod-1), hits.Count(1))
+	assert.Zero(t, hits.Count(3))
+	assert.Greater(t, pl.energy(rare), pl.energy(common))
+}
@@ -12,8 +12,12 @@ import (
 // Cover keeps track of the signal known to the fuzzer.
 type Cover struct {
 	mu        sync.RWMutex
-	maxSignal signal.Signal // max signal ever observed (including flakes)
-	newSignal signal.Signal // newly identified max signal
+	maxSignal signal.Signal    // max signal ever observed (including flakes)
+	newSignal signal.Signal    // newly identified max signal
+	hits      signal.HitCounts // how rare the signal is, see triageJobPrio
+	// Max value profile signal ever observed (see signal.ValueProfile).
+	// It's a separate namespace, so it's not mixed with maxSignal.
+	maxValueProfile signal.Signal
 }
 
 // Signal that should no longer be chased after.
@@ -35,6 +39,21 @@ func (cover *Cover) addRawMaxSignal(signal []uint32, prio uint8) signal.Signal {
 	return diff
 }
 
+// AddMaxValueProfile marks the value profile signal as no longer worth chasing after.
+func (cover *Cover) AddMaxValueProfile(sign signal.Signal) {
+	cover.mu.Lock()
+	defer cover.mu.Unlock()
+	cover.maxValueProfile.Merge(sign)
+}
+
+func (cover *Cover) addRawMaxValueProfile(raw []uint32) signal.Signal {
+	cover.mu.Lock()
+	defer cover.mu.Unlock()
+	diff := cover.maxValueProfile.DiffRaw(raw, 0)
+	cover.maxValueProfile.Merge(diff)
+	return diff
+}
+
 func (cover *Cover) GrabNewSignal() signal.Signal {
 	cover.mu.Lock()
 	defer cover.mu.Unlock()
@@ -44,13 +63,15 @@ func (cover *Cover) GrabNewSignal() signal.Signal {
 }
 
 type CoverStats struct {
-	MaxSignal int
+	MaxSignal       int
+	MaxValueProfile int
 }
 
 func (cover *Cover) Stats() CoverStats {
 	cover.mu.RLock()
 	defer cover.mu.RUnlock()
 	return CoverStats{
-		MaxSignal: len(cover.maxSignal),
+		MaxSignal:       len(cover.maxSignal),
+		MaxValueProfile: len(cover.maxValueProfile),
 	}
 }
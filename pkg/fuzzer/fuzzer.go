@@ -1,5 +1,3 @@
-//go:build !profiling
-
 // Copyright 2024 syzkaller project authors. All rights reserved.
 // Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
 
@@ -10,6 +8,7 @@ import (
 	"fmt"
 	"math/rand"
 	"runtime"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -17,6 +16,9 @@ import (
 	"github.com/google/syzkaller/pkg/corpus"
 	"github.com/google/syzkaller/pkg/hash"
 	"github.com/google/syzkaller/pkg/ipc"
+	"github.com/google/syzkaller/pkg/profevent"
+	"github.com/google/syzkaller/pkg/replay"
+	"github.com/google/syzkaller/profiler"
 	"github.com/google/syzkaller/prog"
 )
 
@@ -24,6 +26,10 @@ type Fuzzer struct {
 	Config         *Config
 	Cover          *Cover
 	NeedCandidates chan struct{}
+	prof           Profiler
+	mutatorSched   mutatorScheduler
+	policy         *policyController
+	ngrams         ngramMiner
 
 	ctx    context.Context
 	mu     sync.Mutex
@@ -54,6 +60,8 @@ func NewFuzzer(ctx context.Context, cfg *Config, rnd *rand.Rand,
 		Config:         cfg,
 		Cover:          &Cover{},
 		NeedCandidates: make(chan struct{}, 1),
+		prof:           NoopProfiler{},
+		policy:         newPolicyController(cfg.Policy.withDefaults(cfg.Coverage)),
 
 		ctx:    ctx,
 		stats:  map[string]uint64{},
@@ -67,6 +75,13 @@ func NewFuzzer(ctx context.Context, cfg *Config, rnd *rand.Rand,
 		nextExec:     makePriorityQueue[*Request](),
 		runningExecs: map[*Request]time.Time{},
 	}
+	// Seed scheduling asks the same table how rare the signal is as triage does.
+	cfg.Corpus.SetHitCounts(&f.Cover.hits)
+	if cfg.Profiling {
+		sp := newStatsProfiler(f)
+		f.prof = sp
+		go sp.logger()
+	}
 	f.updateChoiceTable(nil)
 	go f.choiceTableUpdater()
 	if cfg.Debug {
@@ -92,6 +107,26 @@ type Config struct {
 	// NeedCandidates is triggered.
 	MinCandidates uint
 	NewInputs     chan corpus.NewInput
+	// Profiling enables accounting of the profiling stats.
+	Profiling bool
+	// If set, profiling events (see pkg/profevent) are passed to ProfilingEvents.
+	ProfilingEvents func(profevent.Event)
+	// LogNewPCs emits a profiling event for each PC newly covered by a corpus input
+	// (only if Profiling is set).
+	LogNewPCs bool
+	// GenerateProbability is the probability to generate a new program instead of
+	// taking the next request from the execution queue.
+	GenerateProbability float64
+	// If set, all generated and mutated programs are recorded for replay (see pkg/replay).
+	Replay *replay.Recorder
+	// Policy controls the mix of generated, mutated, smashed and hint requests.
+	Policy SchedulingPolicy
+	// ValueProfile makes new comparison operand distances count as feedback
+	// (see signal.ValueProfile), it has effect only if Comparisons is set.
+	ValueProfile bool
+	// PrioPrior are the call-to-call priorities learned in the past (e.g. by the previous run),
+	// they are combined with the ones learned from the corpus (see prog.LearnPrioMatrix).
+	PrioPrior *prog.CompactPrioMatrix
 }
 
 type Request struct {
@@ -105,22 +140,93 @@ type Request struct {
 	stat    string
 	result  *Result
 	resultC chan *Result
+	/*
+	 * As we iterate through a program, we fetch the next input (via `NextInput` below) at
+	 * each loop iteration. This input can take different forms:
+	 * - It may be a combination of a job (encodes the jobPriority) and a request that has been
+	 *   placed in the next input queue using the "fuzzer.exec(job, request)" function.
+	 * - If the "next input queue" (fuzzer.nextExec in the code) mentioned above is empty, we
+	 *   then generate either a "program generation request" or a "program mutation request."
+	 * - Alternatively, it could be a candidate retrieved from the manager (see candidateRequest).
+	 *   Candidates are programs with additional information, such as whether they have been
+	 *   minimized or smashed already, they are queued with candidatePrio by AddCandidates.
+	 * We want to keep track of what mode created a certain request to be able to check whether
+	 * or not a certain mode is better than another at increasing coverage
+	 */
+	requesterStat string
+	// mutators that were applied to obtain Prog (if it was mutated)
+	mutators map[prog.MutatorIndex]int
+	// the corpus program Prog was mutated from (if it was chosen by the seed scheduler)
+	seed *prog.Prog
+	// the corpus program Prog was derived from (by mutations, smashing or hints)
+	parent *prog.Prog
+}
+
+func (req *Request) origin() Origin {
+	return Origin{
+		Stat:          req.stat,
+		RequesterStat: req.requesterStat,
+		Mutators:      req.mutators,
+	}
+}
+
+// lineage returns how Prog was derived from its parent corpus program.
+func (req *Request) lineage() corpus.Lineage {
+	if req.parent == nil {
+		return corpus.Lineage{}
+	}
+	lineage := corpus.Lineage{
+		Parent: hash.String(req.parent.Serialize()),
+	}
+	for idx := range req.mutators {
+		lineage.Mutators = append(lineage.Mutators, idx.String())
+	}
+	if req.stat == statHint {
+		lineage.Mutators = append(lineage.Mutators, corpus.HintsMutator)
+	}
+	sort.Strings(lineage.Mutators)
+	return lineage
 }
 
 type Result struct {
 	Info *ipc.ProgInfo
 	Stop bool
+	// How long the program took to execute (zero if unknown).
+	Elapsed time.Duration
 }
 
 func (fuzzer *Fuzzer) Done(req *Request, res *Result) {
 	// Triage individual calls.
 	// We do it before unblocking the waiting threads because
 	// it may result it concurrent modification of req.Prog.
+	newSignal := false
 	if req.NeedSignal && res.Info != nil {
 		for call, info := range res.Info.Calls {
-			fuzzer.triageProgCall(req.Prog, &info, call, req.flags)
+			if fuzzer.triageProgCall(req, &info, call) {
+				newSignal = true
+			}
+		}
+		if fuzzer.triageProgCall(req, &res.Info.Extra, -1) {
+			newSignal = true
+		}
+		fuzzer.mutatorSched.credit(req.mutators, newSignal)
+		fuzzer.policy.credit(req.stat, newSignal)
+		fuzzer.prof.Triaged(req.origin(), newSignal)
+	}
+	if res.Info != nil {
+		// Hits are recorded after triage, so that triage sees how rare the signal was
+		// before this execution.
+		fuzzer.Cover.hits.Record(progRawSignal(res.Info)...)
+	}
+	if req.NeedHints && fuzzer.valueProfile() && res.Info != nil {
+		for call, info := range res.Info.Calls {
+			if fuzzer.triageValueProfile(req, &info, call) {
+				newSignal = true
+			}
 		}
-		fuzzer.triageProgCall(req.Prog, &res.Info.Extra, -1, req.flags)
+	}
+	if req.seed != nil {
+		fuzzer.Config.Corpus.Fuzzed(req.seed, res.Info, req.mutators, newSignal)
 	}
 	// Unblock threads that wait for the result.
 	req.result = res
@@ -134,18 +240,18 @@ func (fuzzer *Fuzzer) Done(req *Request, res *Result) {
 	fuzzer.mu.Unlock()
 }
 
-func (fuzzer *Fuzzer) triageProgCall(p *prog.Prog, info *ipc.CallInfo, call int,
-	flags ProgTypes) {
+func (fuzzer *Fuzzer) triageProgCall(req *Request, info *ipc.CallInfo, call int) bool {
+	p, flags := req.Prog, req.flags
 	prio := signalPrio(p, info, call)
 	newMaxSignal := fuzzer.Cover.addRawMaxSignal(info.Signal, prio)
 	if newMaxSignal.Empty() {
-		return
+		return false
 	}
 	if flags&progInTriage > 0 {
 		// We are already triaging this exact prog.
 		// All newly found coverage is flaky.
 		fuzzer.Logf(2, "found new flaky signal in call %d in %s", call, p)
-		return
+		return false
 	}
 	fuzzer.Logf(2, "found new signal in call %d in %s", call, p)
 	fuzzer.startJob(&triageJob{
@@ -154,8 +260,19 @@ func (fuzzer *Fuzzer) triageProgCall(p *prog.Prog, info *ipc.CallInfo, call int,
 		info:        *info,
 		newSignal:   newMaxSignal,
 		flags:       flags,
-		jobPriority: triageJobPrio(flags),
+		jobPriority: triageJobPrio(flags, fuzzer.Cover.hits.RareCount(info.Signal)),
+		origin:      req.origin(),
+		lineage:     req.lineage(),
 	})
+	return true
+}
+
+func progRawSignal(info *ipc.ProgInfo) [][]uint32 {
+	raws := make([][]uint32, 0, len(info.Calls)+1)
+	for i := range info.Calls {
+		raws = append(raws, info.Calls[i].Signal)
+	}
+	return append(raws, info.Extra.Signal)
 }
 
 func signalPrio(p *prog.Prog, info *ipc.CallInfo, call int) (prio uint8) {
@@ -176,6 +293,9 @@ type Candidate struct {
 	Hash      hash.Sig
 	Smashed   bool
 	Minimized bool
+	// The program was in the corpus with value profile signal, the comparisons
+	// are collected for it as well so that it can be saved again.
+	ValueProfile bool
 }
 
 func (fuzzer *Fuzzer) NextInput() *Request {
@@ -199,24 +319,37 @@ func (fuzzer *Fuzzer) NextInput() *Request {
 }
 
 func (fuzzer *Fuzzer) nextInput() *Request {
+	rnd := fuzzer.rand()
+	if fuzzer.Config.GenerateProbability > 0 && rnd.Float64() < fuzzer.Config.GenerateProbability {
+		return genProgRequest(fuzzer, rnd)
+	}
+
 	nextExec := fuzzer.nextExec.tryPop()
 	if nextExec != nil {
 		return nextExec.value
 	}
 	// Either generate a new input or mutate an existing one.
-	mutateRate := 0.95
-	if !fuzzer.Config.Coverage {
-		// If we don't have real coverage signal, generate programs
-		// more frequently because fallback signal is weak.
-		mutateRate = 0.5
-	}
-	rnd := fuzzer.rand()
-	if rnd.Float64() < mutateRate {
+	rnd = fuzzer.rand()
+	if rnd.Float64() < fuzzer.policy.policy().MutateRate {
 		req := mutateProgRequest(fuzzer, rnd)
 		if req != nil {
 			return req
 		}
 	}
+
+	if fuzzer.ngramEnabled() && rnd.Float64() < fuzzer.policy.policy().NgramRate {
+		req := genNgramRequest(fuzzer, rnd)
+		if req != nil {
+			return req
+		}
+	}
+
+	// if the generation mode is disabled (via ablation), return an empty
+	// program with 0 syscall instead of a random program
+	if profiler.Ablation().DisableModeGenerate {
+		return genEmptyProgRequest(fuzzer, rnd)
+	}
+
 	return genProgRequest(fuzzer, rnd)
 }
 
@@ -242,9 +375,13 @@ func (fuzzer *Fuzzer) NeedCandidatesNow() bool {
 }
 
 func (fuzzer *Fuzzer) AddCandidates(candidates []Candidate) {
-	fuzzer.queuedCandidates.Add(int64(len(candidates)))
 	for _, candidate := range candidates {
+		fuzzer.queuedCandidates.Add(1)
 		fuzzer.pushExec(candidateRequest(candidate), priority{candidatePrio})
+		if candidate.ValueProfile && fuzzer.valueProfile() {
+			fuzzer.queuedCandidates.Add(1)
+			fuzzer.pushExec(candidateValueProfileRequest(candidate), priority{candidatePrio})
+		}
 	}
 	fuzzer.candidatesRequested.Store(false)
 }
@@ -271,10 +408,12 @@ func (fuzzer *Fuzzer) pushExec(req *Request, prio priority) {
 func (fuzzer *Fuzzer) exec(job job, req *Request) *Result {
 	req.resultC = make(chan *Result, 1)
 	fuzzer.pushExec(req, job.priority())
+	t := time.Now() // compute duration spent in queue
 	select {
 	case <-fuzzer.ctx.Done():
 		return &Result{Stop: true}
 	case res := <-req.resultC:
+		fuzzer.prof.Dequeued(req.origin(), time.Since(t))
 		close(req.resultC)
 		return res
 	}
@@ -301,7 +440,8 @@ func (fuzzer *Fuzzer) leakDetector() {
 }
 
 func (fuzzer *Fuzzer) updateChoiceTable(programs []*prog.Prog) {
-	newCt := fuzzer.target.BuildChoiceTable(programs, fuzzer.Config.EnabledCalls)
+	newCt := fuzzer.target.BuildChoiceTableWithPrior(programs, fuzzer.Config.EnabledCalls,
+		fuzzer.Config.PrioPrior)
 
 	fuzzer.ctMu.Lock()
 	defer fuzzer.ctMu.Unlock()
@@ -323,6 +463,12 @@ func (fuzzer *Fuzzer) choiceTableUpdater() {
 }
 
 func (fuzzer *Fuzzer) ChoiceTable() *prog.ChoiceTable {
+	ct, _ := fuzzer.choiceTable()
+	return ct
+}
+
+// choiceTable also returns the number of corpus programs the choice table was built from.
+func (fuzzer *Fuzzer) choiceTable() (*prog.ChoiceTable, int) {
 	progs := fuzzer.Config.Corpus.Programs()
 
 	fuzzer.ctMu.Lock()
@@ -341,7 +487,7 @@ func (fuzzer *Fuzzer) ChoiceTable() *prog.ChoiceTable {
 			// It means that we're already regenerating the table.
 		}
 	}
-	return fuzzer.ct
+	return fuzzer.ct, fuzzer.ctProgs
 }
 
 func (fuzzer *Fuzzer) logCurrentStats() {
@@ -368,13 +514,17 @@ type Stats struct {
 	corpus.Stats
 	Candidates  int
 	RunningJobs int
+	// The shares of the mutators in the current mutator weights by the mutator names
+	// (nil unless the weights are adaptive).
+	MutatorWeights map[string]float64
 }
 
 func (fuzzer *Fuzzer) Stats() Stats {
 	return Stats{
-		CoverStats:  fuzzer.Cover.Stats(),
-		Stats:       fuzzer.Config.Corpus.Stats(),
-		Candidates:  int(fuzzer.queuedCandidates.Load()),
-		RunningJobs: int(fuzzer.runningJobs.Load()),
+		CoverStats:     fuzzer.Cover.Stats(),
+		Stats:          fuzzer.Config.Corpus.Stats(),
+		Candidates:     int(fuzzer.queuedCandidates.Load()),
+		RunningJobs:    int(fuzzer.runningJobs.Load()),
+		MutatorWeights: fuzzer.mutatorShares(),
 	}
 }
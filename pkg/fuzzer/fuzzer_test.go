@@ -20,8 +20,11 @@ import (
 
 	"github.com/google/syzkaller/pkg/corpus"
 	"github.com/google/syzkaller/pkg/csource"
+	"github.com/google/syzkaller/pkg/hash"
 	"github.com/google/syzkaller/pkg/ipc"
 	"github.com/google/syzkaller/pkg/ipc/ipcconfig"
+	"github.com/google/syzkaller/pkg/replay"
+	"github.com/google/syzkaller/pkg/signal"
 	"github.com/google/syzkaller/pkg/testutil"
 	"github.com/google/syzkaller/prog"
 	"github.com/google/syzkaller/sys/targets"
@@ -55,6 +58,7 @@ func TestFuzz(t *testing.T) {
 			target.SyscallMap["syz_test_fuzzer1"]: true,
 		},
 		NewInputs: make(chan corpus.NewInput),
+		Profiling: true,
 	}, rand.New(testutil.RandSource(t)), target)
 
 	go func() {
@@ -86,6 +90,206 @@ func TestFuzz(t *testing.T) {
 
 	assert.Equal(t, len(tf.expectedCrashes), len(tf.crashes),
 		"not all expected crashes were found")
+	counts := fuzzer.prof.(*statsProfiler).stats.allCounts()
+	assert.NotZero(t, counts[string(ProfilingStatModeMutate)], "mutations were not profiled")
+	for _, item := range fuzzer.Config.Corpus.Items() {
+		if parent := item.Meta.Lineage.Parent; parent != "" {
+			assert.NotNil(t, fuzzer.Config.Corpus.Item(parent), "the parent of %v is not in the corpus", item.Sig)
+		}
+	}
+}
+
+func TestRequestLineage(t *testing.T) {
+	target, err := prog.GetTarget(targets.TestOS, targets.TestArch64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := target.Generate(rand.New(testutil.RandSource(t)), 5, target.DefaultChoiceTable())
+	req := &Request{
+		stat: statFuzz,
+		mutators: map[prog.MutatorIndex]int{
+			prog.MutatorIndexSquashAny:  1,
+			prog.MutatorIndexInsertCall: 2,
+		},
+	}
+	assert.Equal(t, corpus.Lineage{}, req.lineage(), "generated programs have no parent")
+	req.parent = parent
+	assert.Equal(t, corpus.Lineage{
+		Parent:   hash.String(parent.Serialize()),
+		Mutators: []string{prog.MutatorIndexInsertCall.String(), prog.MutatorIndexSquashAny.String()},
+	}, req.lineage())
+	req = &Request{stat: statHint, parent: parent}
+	assert.Equal(t, []string{corpus.HintsMutator}, req.lineage().Mutators)
+}
+
+func TestGenerateProbability(t *testing.T) {
+	target, err := prog.GetTarget(targets.TestOS, targets.TestArch64Fuzz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fuzzer := NewFuzzer(ctx, &Config{
+		Corpus:   corpus.NewCorpus(ctx),
+		Coverage: true,
+		EnabledCalls: map[*prog.Syscall]bool{
+			target.SyscallMap["syz_test_fuzzer1"]: true,
+		},
+		GenerateProbability: 1,
+	}, rand.New(testutil.RandSource(t)), target)
+	fuzzer.AddCandidates([]Candidate{{Prog: target.DataMmapProg()}})
+	for i := 0; i < 10; i++ {
+		req := fuzzer.NextInput()
+		assert.Equal(t, statGenerate, req.stat)
+		fuzzer.Done(req, &Result{})
+	}
+	fuzzer.Config.GenerateProbability = 0
+	req := fuzzer.NextInput()
+	assert.Equal(t, statCandidate, req.stat)
+	fuzzer.Done(req, &Result{})
+}
+
+func TestNgramGenerate(t *testing.T) {
+	target, err := prog.GetTarget(targets.TestOS, targets.TestArch64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	calls := map[*prog.Syscall]bool{}
+	for _, c := range target.Syscalls {
+		calls[c] = true
+	}
+	fuzzer := NewFuzzer(ctx, &Config{
+		Corpus:       corpus.NewCorpus(ctx),
+		Coverage:     true,
+		EnabledCalls: calls,
+		Policy: SchedulingPolicy{
+			MutateRate: 1e-9,
+			NgramRate:  1,
+		},
+	}, rand.New(testutil.RandSource(t)), target)
+	// Without a corpus there are no n-grams to start from.
+	req := fuzzer.NextInput()
+	assert.Equal(t, statGenerate, req.stat)
+	fuzzer.Done(req, &Result{})
+	for i := 0; i < 2; i++ {
+		p, err := target.Deserialize([]byte(fmt.Sprintf(`
+r0 = mutate5(&(0x7f0000000000)='./file%v\x00', 0x0)
+mutate6(r0, &(0x7f0000000000)="00", 0x1)
+mutate6(r0, &(0x7f0000000000)="01", 0x1)
+`, i)), prog.Strict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fuzzer.Config.Corpus.Save(corpus.NewInput{
+			Prog:   p,
+			Call:   -1,
+			Signal: signal.FromRaw([]uint32{uint32(i)}, 0),
+		})
+	}
+	for i := 0; i < 10; i++ {
+		req := fuzzer.NextInput()
+		assert.Equal(t, statNgram, req.stat)
+		// The template is cut out of the second program.
+		assert.Contains(t, string(req.Prog.Serialize()), `mutate5(&(0x7f0000000000)='./file1\x00', 0x0)`)
+		fuzzer.Done(req, &Result{})
+	}
+}
+
+func TestNgramMinerGeneration(t *testing.T) {
+	target, err := prog.GetTarget(targets.TestOS, targets.TestArch64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var progs []*prog.Prog
+	for i := 0; i < 2; i++ {
+		p, err := target.Deserialize([]byte(`
+r0 = mutate5(&(0x7f0000000000)='./file0\x00', 0x0)
+mutate6(r0, &(0x7f0000000000)="00", 0x1)
+mutate6(r0, &(0x7f0000000000)="01", 0x1)
+`), prog.Strict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		progs = append(progs, p)
+	}
+	rnd := rand.New(testutil.RandSource(t))
+	var nm ngramMiner
+	assert.NotNil(t, nm.choose(progs, 1, rnd))
+	// The corpus was minimized to a single program and then grew back,
+	// the miner must forget the dropped programs.
+	other, err := target.Deserialize([]byte("mutate7(&(0x7f0000000000)='123', 0x3)\n"), prog.Strict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, nm.choose([]*prog.Prog{progs[0], other, other}, 2, rnd))
+	assert.Equal(t, 3, nm.miner.Progs())
+}
+
+func TestReplay(t *testing.T) {
+	target, err := prog.GetTarget(targets.TestOS, targets.TestArch64Fuzz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	calls := map[*prog.Syscall]bool{}
+	var callNames []string
+	for _, c := range target.Syscalls {
+		calls[c] = true
+		callNames = append(callNames, c.Name)
+	}
+	recorder := replay.NewRecorder(&replay.Config{
+		OS:           target.OS,
+		Arch:         target.Arch,
+		EnabledCalls: callNames,
+	})
+	updates := make(chan corpus.NewItemEvent)
+	recorded := make(chan struct{})
+	go func() {
+		defer close(recorded)
+		for ev := range updates {
+			if !ev.Exists {
+				recorder.AddedToCorpus(ev.ProgData)
+			}
+		}
+	}()
+	fuzzer := NewFuzzer(ctx, &Config{
+		Corpus:       corpus.NewMonitoredCorpus(ctx, updates),
+		Coverage:     true,
+		EnabledCalls: calls,
+		Replay:       recorder,
+	}, rand.New(testutil.RandSource(t)), target)
+	generated, mutated := 0, 0
+	for i := 0; i < 500; i++ {
+		req := fuzzer.NextInput()
+		switch req.stat {
+		case statGenerate:
+			generated++
+			// Pretend that every 5th generated program gave new coverage.
+			if generated%5 == 0 {
+				fuzzer.Config.Corpus.Save(corpus.NewInput{
+					Prog:   req.Prog,
+					Call:   -1,
+					Signal: signal.FromRaw([]uint32{uint32(i)}, 0),
+				})
+			}
+		case statFuzz:
+			mutated++
+		}
+		fuzzer.Done(req, &Result{})
+	}
+	cancel()
+	close(updates)
+	<-recorded
+	replayed := 0
+	err = replay.Replay(recorder.Drain(), func(rec *replay.Record, p *prog.Prog) {
+		replayed++
+	})
+	assert.NoError(t, err)
+	assert.NotZero(t, mutated)
+	assert.Equal(t, generated+mutated, replayed)
 }
 
 func BenchmarkFuzzer(b *testing.B) {
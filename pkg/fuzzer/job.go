@@ -1,5 +1,3 @@
-//go:build !profiling
-
 // Copyright 2024 syzkaller project authors. All rights reserved.
 // Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
 
@@ -7,12 +5,16 @@ package fuzzer
 
 import (
 	"fmt"
+	"math/bits"
 	"math/rand"
+	"time"
 
 	"github.com/google/syzkaller/pkg/corpus"
 	"github.com/google/syzkaller/pkg/cover"
 	"github.com/google/syzkaller/pkg/ipc"
+	"github.com/google/syzkaller/pkg/replay"
 	"github.com/google/syzkaller/pkg/signal"
+	"github.com/google/syzkaller/profiler"
 	"github.com/google/syzkaller/prog"
 )
 
@@ -60,15 +62,91 @@ func (jp *jobPriority) saveID(id int64) {
 	jp.prio = append(jp.prio, id)
 }
 
+func genEmptyProgRequest(fuzzer *Fuzzer, rnd *rand.Rand) *Request {
+	p := fuzzer.generate(rnd, 0)
+	return &Request{
+		Prog:          p,
+		NeedSignal:    true,
+		stat:          statGenerate,
+		requesterStat: statGenerate,
+	}
+}
+
 func genProgRequest(fuzzer *Fuzzer, rnd *rand.Rand) *Request {
-	p := fuzzer.target.Generate(rnd,
-		prog.RecommendedCalls,
-		fuzzer.ChoiceTable())
+	start := time.Now()
+	p := fuzzer.generate(rnd, prog.RecommendedCalls)
+	fuzzer.prof.ModeDone(ProfilingStatModeGenerate, time.Since(start))
+
 	return &Request{
-		Prog:       p,
-		NeedSignal: true,
-		stat:       statGenerate,
+		Prog:          p,
+		NeedSignal:    true,
+		stat:          statGenerate,
+		requesterStat: statGenerate,
+	}
+}
+
+// mutatorWeights returns the mutator weights of the current ablation configuration,
+// adapted by the mutator scheduler if it's enabled.
+func (fuzzer *Fuzzer) mutatorWeights() prog.MutatorWeights {
+	ablation := profiler.Ablation()
+	weights, err := prog.ParseMutatorWeights(ablation.MutatorWeights)
+	if err != nil {
+		// syz-manager validates the configuration before sending it to us.
+		panic(fmt.Sprintf("bad mutator weights: %v", err))
+	}
+	if ablation.AdaptiveMutatorWeights {
+		adapted, ok := fuzzer.mutatorSched.weights(weights.WithoutDisabledMutators(ablation))
+		if ok {
+			weights = adapted
+		}
+	}
+	return weights
+}
+
+// mutatorShares returns the shares of the mutators in the adapted mutator weights,
+// or nil if the mutator weights are not adaptive.
+func (fuzzer *Fuzzer) mutatorShares() map[string]float64 {
+	if !profiler.Ablation().AdaptiveMutatorWeights {
+		return nil
+	}
+	weights := fuzzer.mutatorWeights()
+	total := 0.0
+	for _, weight := range weights {
+		total += weight
+	}
+	shares := make(map[string]float64)
+	for idx, weight := range weights {
+		if weight != 0 {
+			shares[prog.MutatorIndex(idx).String()] = weight / total
+		}
+	}
+	return shares
+}
+
+// generate generates a program from a seed of its own (see pkg/replay).
+func (fuzzer *Fuzzer) generate(rnd *rand.Rand, ncalls int) *prog.Prog {
+	seed := rnd.Int63()
+	ct, ctProgs := fuzzer.choiceTable()
+	p := replay.Generate(fuzzer.target, seed, ncalls, ct)
+	if fuzzer.Config.Replay != nil {
+		fuzzer.Config.Replay.Generated(seed, ncalls, ctProgs, p)
+	}
+	return p
+}
+
+// mutate mutates a copy of the program with a seed of its own (see pkg/replay).
+func (fuzzer *Fuzzer) mutate(rnd *rand.Rand, p *prog.Prog) (*prog.Prog,
+	map[prog.MutatorIndex]int, map[prog.MutatorIndex]prog.MutatorAnalysis) {
+	seed := rnd.Int63()
+	ct, ctProgs := fuzzer.choiceTable()
+	corpus := fuzzer.Config.Corpus.Programs()
+	weights := fuzzer.mutatorWeights()
+	newP, obs, analysis := replay.Mutate(p, seed, ct, fuzzer.Config.NoMutateCalls, corpus, weights,
+		fuzzer.Config.Profiling)
+	if fuzzer.Config.Replay != nil {
+		fuzzer.Config.Replay.Mutated(seed, p, len(corpus), ctProgs, weights, obs, newP)
 	}
+	return newP, obs, analysis
 }
 
 func mutateProgRequest(fuzzer *Fuzzer, rnd *rand.Rand) *Request {
@@ -76,18 +154,36 @@ func mutateProgRequest(fuzzer *Fuzzer, rnd *rand.Rand) *Request {
 	if p == nil {
 		return nil
 	}
-	newP := p.Clone()
-	newP.Mutate(rnd,
-		prog.RecommendedCalls,
-		fuzzer.ChoiceTable(),
-		fuzzer.Config.NoMutateCalls,
-		fuzzer.Config.Corpus.Programs(),
-	)
-	return &Request{
-		Prog:       newP,
-		NeedSignal: true,
-		stat:       statFuzz,
+	// if the mutate mode is disabled (via ablation), skip the mutation and return
+	// a copy of the original program
+	newP := p
+	var obs map[prog.MutatorIndex]int
+	if profiler.Ablation().DisableModeMutate {
+		newP = p.Clone()
+	} else {
+		start := time.Now()
+		var analysis map[prog.MutatorIndex]prog.MutatorAnalysis
+		newP, obs, analysis = fuzzer.mutate(rnd, p)
+
+		fuzzer.prof.ModeDone(ProfilingStatModeMutate, time.Since(start))
+		fuzzer.prof.Mutated(analysis)
 	}
+
+	req := &Request{
+		Prog:          newP,
+		NeedSignal:    true,
+		stat:          statFuzz,
+		requesterStat: statFuzz,
+		mutators:      obs,
+		seed:          p,
+		parent:        p,
+	}
+	if fuzzer.valueProfile() && rnd.Float64() < valueProfileRate {
+		// Comparisons can't be collected together with the coverage.
+		req.NeedSignal, req.NeedHints = false, true
+		req.stat = statValueProfile
+	}
+	return req
 }
 
 func candidateRequest(input Candidate) *Request {
@@ -99,13 +195,23 @@ func candidateRequest(input Candidate) *Request {
 		flags |= progSmashed
 	}
 	return &Request{
-		Prog:       input.Prog,
-		NeedSignal: true,
-		stat:       statCandidate,
-		flags:      flags,
+		Prog:          input.Prog,
+		NeedSignal:    true,
+		stat:          statCandidate,
+		flags:         flags,
+		requesterStat: statCandidate,
 	}
 }
 
+// candidateValueProfileRequest collects the value profile signal of the candidate,
+// new signal makes it a valueProfileJob.
+func candidateValueProfileRequest(input Candidate) *Request {
+	req := candidateRequest(input)
+	req.NeedSignal = false
+	req.NeedHints = true
+	return req
+}
+
 // triageJob are programs for which we noticed potential new coverage during
 // first execution. But we are not sure yet if the coverage is real or not.
 // During triage we understand if these programs in fact give new coverage,
@@ -117,16 +223,34 @@ type triageJob struct {
 	newSignal signal.Signal
 	flags     ProgTypes
 	jobPriority
+	// In case the coverage increase is indeed real, we need to be able to
+	// attribute this contribution to the request that started the triageJob.
+	origin Origin
+	// How the program was derived (goes to the corpus together with it).
+	lineage corpus.Lineage
+	// The fastest execution time of the (minimized) program seen during triage.
+	execTime time.Duration
 }
 
-func triageJobPrio(flags ProgTypes) jobPriority {
+// triageJobPrio boosts the triage of programs whose call has hit rare signal
+// (see signal.HitCounts) among the triage jobs of the same kind.
+// rare is the number of such rare signal elements.
+func triageJobPrio(flags ProgTypes, rare int) jobPriority {
+	base := triagePrio
 	if flags&progCandidate > 0 {
-		return newJobPriority(candidateTriagePrio)
+		base = candidateTriagePrio
 	}
-	return newJobPriority(triagePrio)
+	jp := newJobPriority(base)
+	// The boost grows logarithmically, so that jobs with a similar number of rare elements
+	// are still handled in the order they were started.
+	jp.prio = append(jp.prio, int64(bits.Len(uint(rare))))
+	return jp
 }
 
 func (job *triageJob) run(fuzzer *Fuzzer) {
+	if job.origin.RequesterStat == "" {
+		fuzzer.Logf(0, "ERROR! started a triage job that does not have any requestStat!")
+	}
 	logCallName := "extra"
 	if job.call != -1 {
 		callName := job.p.Calls[job.call].Meta.Name
@@ -138,6 +262,7 @@ func (job *triageJob) run(fuzzer *Fuzzer) {
 	if stop || info.newStableSignal.Empty() {
 		return
 	}
+
 	if job.flags&progMinimized == 0 {
 		stop = job.minimize(fuzzer, info.newStableSignal)
 		if stop {
@@ -145,21 +270,34 @@ func (job *triageJob) run(fuzzer *Fuzzer) {
 		}
 	}
 	fuzzer.Logf(2, "added new input for %q to the corpus:\n%s", logCallName, job.p.String())
-	if job.flags&progSmashed == 0 {
-		fuzzer.startJob(&smashJob{
-			p:           job.p.Clone(),
-			call:        job.call,
-			jobPriority: newJobPriority(smashPrio),
-		})
-	}
-	input := corpus.NewInput{
+	fuzzer.saveInput(corpus.NewInput{
 		Prog:     job.p,
 		Call:     job.call,
 		Signal:   info.stableSignal,
 		Cover:    info.cover.Serialize(),
 		RawCover: info.rawCover,
+		Lineage:  job.lineage,
+		ExecTime: job.execTime,
+	}, job.flags, job.origin)
+}
+
+// saveInput adds a triaged program to the corpus and starts smashing it.
+func (fuzzer *Fuzzer) saveInput(input corpus.NewInput, flags ProgTypes, origin Origin) {
+	if fuzzer.Config.Replay != nil {
+		// The replayer mutates the deserialized corpus programs.
+		input.Prog = replay.Canonical(input.Prog)
 	}
-	fuzzer.Config.Corpus.Save(input)
+	if flags&progSmashed == 0 {
+		fuzzer.startJob(&smashJob{
+			p:           input.Prog.Clone(),
+			call:        input.Call,
+			jobPriority: newJobPriority(smashPrio),
+		})
+	}
+
+	newCover := fuzzer.Config.Corpus.Save(input)
+	fuzzer.prof.NewInput(origin, newCover)
+
 	if fuzzer.Config.NewInputs != nil {
 		select {
 		case <-fuzzer.ctx.Done():
@@ -180,12 +318,13 @@ func (job *triageJob) deflake(fuzzer *Fuzzer) (info deflakedCover, stop bool) {
 	var notExecuted int
 	for i := 0; i < signalRuns; i++ {
 		result := fuzzer.exec(job, &Request{
-			Prog:         job.p,
-			NeedSignal:   true,
-			NeedCover:    true,
-			NeedRawCover: fuzzer.Config.FetchRawCover,
-			stat:         statTriage,
-			flags:        progInTriage,
+			Prog:          job.p,
+			NeedSignal:    true,
+			NeedCover:     true,
+			NeedRawCover:  fuzzer.Config.FetchRawCover,
+			stat:          statTriage,
+			flags:         progInTriage,
+			requesterStat: job.origin.RequesterStat,
 		})
 		if result.Stop {
 			stop = true
@@ -200,6 +339,9 @@ func (job *triageJob) deflake(fuzzer *Fuzzer) (info deflakedCover, stop bool) {
 			}
 			continue
 		}
+		if result.Elapsed != 0 && (job.execTime == 0 || result.Elapsed < job.execTime) {
+			job.execTime = result.Elapsed
+		}
 		thisSignal, thisCover := getSignalAndCover(job.p, result.Info, job.call)
 		if len(info.rawCover) == 0 && fuzzer.Config.FetchRawCover {
 			info.rawCover = thisCover
@@ -223,14 +365,19 @@ func (job *triageJob) minimize(fuzzer *Fuzzer, newSignal signal.Signal) (stop bo
 	const minimizeAttempts = 3
 	job.p, job.call = prog.Minimize(job.p, job.call, false,
 		func(p1 *prog.Prog, call1 int) bool {
+			if profiler.Ablation().DisableStageMinimize {
+				return false
+			}
+
 			if stop {
 				return false
 			}
 			for i := 0; i < minimizeAttempts; i++ {
 				result := fuzzer.exec(job, &Request{
-					Prog:       p1,
-					NeedSignal: true,
-					stat:       statMinimize,
+					Prog:          p1,
+					NeedSignal:    true,
+					stat:          statMinimize,
+					requesterStat: job.origin.RequesterStat,
 				})
 				if result.Stop {
 					stop = true
@@ -243,6 +390,10 @@ func (job *triageJob) minimize(fuzzer *Fuzzer, newSignal signal.Signal) (stop bo
 				}
 				thisSignal, _ := getSignalAndCover(p1, info, call1)
 				if newSignal.Intersection(thisSignal).Len() == newSignal.Len() {
+					// p1 replaces the program, so does its execution time (if it's known).
+					if result.Elapsed != 0 {
+						job.execTime = result.Elapsed
+					}
 					return true
 				}
 			}
@@ -281,35 +432,64 @@ type smashJob struct {
 }
 
 func (job *smashJob) run(fuzzer *Fuzzer) {
+	smashAnalysis := SmashAnalysis{
+		NFaultInjection:        0,
+		NHintsJobStart:         0,
+		DurationMutations:      time.Duration(0),
+		DurationFullSmash:      time.Duration(0),
+		DurationFaultInjection: time.Duration(0),
+	}
+
 	fuzzer.Logf(2, "smashing the program %s (call=%d):", job.p, job.call)
-	if fuzzer.Config.Comparisons && job.call >= 0 {
+	policy := fuzzer.policy.policy()
+	rnd := fuzzer.rand()
+	if fuzzer.Config.Comparisons && job.call >= 0 && rnd.Float64() < policy.HintsRate {
+		smashAnalysis.NHintsJobStart += 1
 		fuzzer.startJob(&hintsJob{
 			p:           job.p.Clone(),
 			call:        job.call,
 			jobPriority: newJobPriority(smashPrio),
+			fromSmash:   true,
 		})
 	}
 
-	const iters = 100
-	rnd := fuzzer.rand()
-	for i := 0; i < iters; i++ {
-		p := job.p.Clone()
-		p.Mutate(rnd, prog.RecommendedCalls,
-			fuzzer.ChoiceTable(),
-			fuzzer.Config.NoMutateCalls,
-			fuzzer.Config.Corpus.Programs())
+	// smashJob simply starts a hintsJob and performs a number of mutations. We can simply omit
+	// these operations and return instantly. If the smash mode is disabled, with STILL
+	// want to run the hints jobs
+	if profiler.Ablation().DisableModeSmash {
+		return
+	}
+
+	start := time.Now()
+
+	for i := 0; i < policy.SmashMutations; i++ {
+		// if the mutation mode is disabled, we still want to be able to smash!
+		startInside := time.Now()
+
+		p, obs, analysis := fuzzer.mutate(rnd, job.p)
+
+		deltaInside := time.Since(startInside)
+		fuzzer.prof.ModeDone(ProfilingStatModeMutateFromSmash, deltaInside)
+		fuzzer.prof.Mutated(analysis)
+		smashAnalysis.DurationMutations += deltaInside
+
 		result := fuzzer.exec(job, &Request{
-			Prog:       p,
-			NeedSignal: true,
-			stat:       statSmash,
+			Prog:          p,
+			NeedSignal:    true,
+			stat:          statSmash,
+			requesterStat: statFuzzFromSmash,
+			mutators:      obs,
+			parent:        job.p,
 		})
 		if result.Stop {
 			return
 		}
-		if fuzzer.Config.Collide {
+
+		if !profiler.Ablation().DisableStageCollide && fuzzer.Config.Collide {
 			result := fuzzer.exec(job, &Request{
-				Prog: randomCollide(p, rnd),
-				stat: statCollide,
+				Prog:          randomCollide(p, rnd),
+				stat:          statCollide,
+				requesterStat: statCollide,
 			})
 			if result.Stop {
 				return
@@ -317,8 +497,16 @@ func (job *smashJob) run(fuzzer *Fuzzer) {
 		}
 	}
 	if fuzzer.Config.FaultInjection && job.call >= 0 {
-		job.faultInjection(fuzzer)
+		t := time.Now()
+		count := job.faultInjection(fuzzer, policy.FaultInjections)
+
+		smashAnalysis.DurationFaultInjection += time.Since(t)
+		smashAnalysis.NFaultInjection += count
 	}
+
+	smashAnalysis.DurationFullSmash = time.Since(start)
+	fuzzer.prof.ModeDone(ProfilingStatModeSmash, smashAnalysis.DurationFullSmash)
+	fuzzer.prof.SmashDone(smashAnalysis)
 }
 
 func randomCollide(origP *prog.Prog, rnd *rand.Rand) *prog.Prog {
@@ -343,18 +531,21 @@ func randomCollide(origP *prog.Prog, rnd *rand.Rand) *prog.Prog {
 	return p
 }
 
-func (job *smashJob) faultInjection(fuzzer *Fuzzer) {
-	for nth := 1; nth <= 100; nth++ {
+func (job *smashJob) faultInjection(fuzzer *Fuzzer, maxFaults int) uint64 {
+	var count uint64 = 0
+	for nth := 1; nth <= maxFaults; nth++ {
 		fuzzer.Logf(2, "injecting fault into call %v, step %v",
 			job.call, nth)
 		newProg := job.p.Clone()
 		newProg.Calls[job.call].Props.FailNth = nth
 		result := fuzzer.exec(job, &Request{
-			Prog: job.p,
-			stat: statSmash,
+			Prog:          job.p,
+			stat:          statSmash,
+			requesterStat: statSmash,
 		})
+		count += 1
 		if result.Stop {
-			return
+			return count
 		}
 		info := result.Info
 		if info != nil && len(info.Calls) > job.call &&
@@ -362,21 +553,32 @@ func (job *smashJob) faultInjection(fuzzer *Fuzzer) {
 			break
 		}
 	}
+
+	return count
 }
 
 type hintsJob struct {
 	p    *prog.Prog
 	call int
 	jobPriority
+	fromSmash bool
 }
 
 func (job *hintsJob) run(fuzzer *Fuzzer) {
+	// similarly to smashJob, we can simply omit the mutations if
+	// syzkaller's mutate with hints mode is disabled
+	if profiler.Ablation().DisableModeHints {
+		return
+	}
+
 	// First execute the original program to dump comparisons from KCOV.
 	p := job.p
+	t := time.Now()
 	result := fuzzer.exec(job, &Request{
-		Prog:      p,
-		NeedHints: true,
-		stat:      statSeed,
+		Prog:          p,
+		NeedHints:     true,
+		stat:          statSeed,
+		requesterStat: statSeedFromHint,
 	})
 	if result.Stop || result.Info == nil {
 		return
@@ -384,13 +586,22 @@ func (job *hintsJob) run(fuzzer *Fuzzer) {
 	// Then mutate the initial program for every match between
 	// a syscall argument and a comparison operand.
 	// Execute each of such mutants to check if it gives new coverage.
-	p.MutateWithHints(job.call, result.Info.Calls[job.call].Comps,
+	start := time.Now()
+	p.MutateWithHints(
+		job.call,
+		result.Info.Calls[job.call].Comps,
 		func(p *prog.Prog) bool {
 			result := fuzzer.exec(job, &Request{
-				Prog:       p,
-				NeedSignal: true,
-				stat:       statHint,
+				Prog:          p,
+				NeedSignal:    true,
+				stat:          statHint,
+				requesterStat: statHint,
+				parent:        job.p,
 			})
 			return !result.Stop
-		})
+		},
+	)
+
+	fuzzer.prof.ModeDone(ProfilingStatModeMutateHints, time.Since(start))
+	fuzzer.prof.HintsDone(job.fromSmash, time.Since(t))
 }
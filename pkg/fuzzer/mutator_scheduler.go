@@ -0,0 +1,99 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package fuzzer
+
+import (
+	"math"
+	"sync"
+
+	"github.com/google/syzkaller/prog"
+)
+
+// mutatorScheduler adjusts mutator weights online (in the spirit of MOpt) using the UCB1
+// multi-armed bandit: every mutator applied to a program is credited when the execution
+// of the program gives new signal, and mutators with a higher yield get a higher weight.
+type mutatorScheduler struct {
+	mu      sync.Mutex
+	pulls   [prog.MutatorCount]float64 // how many times each mutator was applied
+	rewards [prog.MutatorCount]float64 // new signal credited to each mutator
+	total   float64
+}
+
+const (
+	// Until every enabled mutator was applied that many times, the base weights are used.
+	schedulerWarmup = 100
+	// Once the mutators were applied that many times in total, all counters are halved
+	// so that the scheduler keeps adapting as the usefulness of mutators changes
+	// over the fuzzing campaign.
+	schedulerWindow = 1 << 20
+	// Each enabled mutator keeps at least this share of the total weight.
+	schedulerMinShare = 0.01
+)
+
+// credit records the outcome of the execution of a program mutated with the applied mutators.
+// If the program gave new signal, the reward is split between the mutators.
+func (ms *mutatorScheduler) credit(applied map[prog.MutatorIndex]int, newSignal bool) {
+	count := 0
+	for _, n := range applied {
+		count += n
+	}
+	if count == 0 {
+		return
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for idx, n := range applied {
+		ms.pulls[idx] += float64(n)
+		if newSignal {
+			ms.rewards[idx] += float64(n) / float64(count)
+		}
+	}
+	ms.total += float64(count)
+	if ms.total >= schedulerWindow {
+		for idx := range ms.pulls {
+			ms.pulls[idx] /= 2
+			ms.rewards[idx] /= 2
+		}
+		ms.total /= 2
+	}
+}
+
+// weights returns the weights of the mutators that have a non-zero base weight.
+// It returns false if there is not enough data to deviate from the base weights yet.
+func (ms *mutatorScheduler) weights(base prog.MutatorWeights) (prog.MutatorWeights, bool) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	var means [prog.MutatorCount]float64
+	maxMean, pulls := 0.0, 0.0
+	for idx, weight := range base {
+		if weight == 0 {
+			continue
+		}
+		if ms.pulls[idx] < schedulerWarmup {
+			return base, false
+		}
+		means[idx] = ms.rewards[idx] / ms.pulls[idx]
+		maxMean = math.Max(maxMean, means[idx])
+		pulls += ms.pulls[idx]
+	}
+	if maxMean == 0 {
+		return base, false
+	}
+	var res prog.MutatorWeights
+	total := 0.0
+	for idx, weight := range base {
+		if weight == 0 {
+			continue
+		}
+		// Yields are normalized to [0, 1] since new signal is rare in absolute terms.
+		res[idx] = means[idx]/maxMean + math.Sqrt(2*math.Log(pulls)/ms.pulls[idx])
+		total += res[idx]
+	}
+	for idx, weight := range base {
+		if weight != 0 && res[idx] < schedulerMinShare*total {
+			res[idx] = schedulerMinShare * total
+		}
+	}
+	return res, true
+}
@@ -0,0 +1,54 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package fuzzer
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/google/syzkaller/prog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMutatorScheduler(t *testing.T) {
+	var ms mutatorScheduler
+	base := prog.DefaultMutatorWeights
+	base[prog.MutatorIndexRemoveCall] = 0
+	base[prog.MutatorIndexRewireResources] = 0
+	base[prog.MutatorIndexCrossover] = 0
+
+	_, ok := ms.weights(base)
+	assert.False(t, ok, "no data yet")
+
+	rnd := rand.New(rand.NewSource(0))
+	yield := map[prog.MutatorIndex]float64{
+		prog.MutatorIndexSquashAny:  0.01,
+		prog.MutatorIndexSplice:     0.2,
+		prog.MutatorIndexInsertCall: 0.02,
+		prog.MutatorIndexMutateArg:  0.05,
+	}
+	for i := 0; i < 100000; i++ {
+		idx := prog.MutatorIndex(rnd.Intn(int(prog.MutatorIndexRemoveCall)))
+		ms.credit(map[prog.MutatorIndex]int{idx: 1}, rnd.Float64() < yield[idx])
+	}
+	weights, ok := ms.weights(base)
+	assert.True(t, ok)
+	assert.Zero(t, weights[prog.MutatorIndexRemoveCall], "disabled mutator must stay disabled")
+	for idx := range yield {
+		if idx != prog.MutatorIndexSplice {
+			assert.Greater(t, weights[prog.MutatorIndexSplice], weights[idx], "mutator %v", idx)
+		}
+	}
+	assert.Greater(t, weights[prog.MutatorIndexMutateArg], weights[prog.MutatorIndexSquashAny])
+	assert.NoError(t, weights.Validate())
+}
+
+func TestMutatorSchedulerWindow(t *testing.T) {
+	var ms mutatorScheduler
+	for i := 0; i < 3*schedulerWindow/1000; i++ {
+		ms.credit(map[prog.MutatorIndex]int{prog.MutatorIndexSplice: 1000}, false)
+	}
+	assert.Less(t, ms.total, float64(schedulerWindow))
+	assert.Equal(t, ms.total, ms.pulls[prog.MutatorIndexSplice])
+}
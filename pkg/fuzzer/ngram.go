@@ -0,0 +1,82 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package fuzzer
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/google/syzkaller/profiler"
+	"github.com/google/syzkaller/prog"
+)
+
+// ngramMiner incrementally mines the call n-grams of the corpus programs.
+type ngramMiner struct {
+	mu    sync.Mutex
+	miner *prog.NgramMiner
+	gen   uint64 // the corpus generation (see corpus.ProgramsList.ProgramsGen)
+	mined int    // the number of mined corpus programs
+}
+
+const (
+	// Each choose call mines at most that many new programs, so that procs
+	// don't wait for the miner long after a corpus reset.
+	ngramMineBatch = 100
+	// Once the miner tracks that many n-grams, the rarest ones are dropped until
+	// at most half of that remains, so that the next pruning is only due after many new n-grams.
+	ngramPruneLimit = 1 << 17
+)
+
+// choose mines the new corpus programs and returns a random n-gram template (nil if there are none).
+func (nm *ngramMiner) choose(progs []*prog.Prog, gen uint64, rnd *rand.Rand) *prog.Ngram {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	if nm.miner == nil || gen != nm.gen {
+		// Programs were dropped from the corpus (e.g. it was minimized), start over.
+		nm.miner = prog.NewNgramMiner()
+		nm.gen = gen
+		nm.mined = 0
+	}
+	end := len(progs)
+	if end > nm.mined+ngramMineBatch {
+		end = nm.mined + ngramMineBatch
+	}
+	for _, p := range progs[nm.mined:end] {
+		nm.miner.Add(p)
+	}
+	nm.mined = end
+	if nm.miner.Len() > ngramPruneLimit {
+		for minCount := prog.NgramMinCount; nm.miner.Len() > ngramPruneLimit/2; minCount *= 2 {
+			nm.miner.Prune(minCount)
+		}
+	}
+	return nm.miner.Choose(rnd)
+}
+
+func (fuzzer *Fuzzer) ngramEnabled() bool {
+	// The generated programs can't be replayed: they depend on the corpus contents.
+	return fuzzer.Config.Replay == nil && fuzzer.Config.Corpus != nil &&
+		!profiler.Ablation().DisableModeNgram
+}
+
+// genNgramRequest generates a program around a call sequence mined from the corpus,
+// it returns nil if the corpus has no such sequences yet.
+func genNgramRequest(fuzzer *Fuzzer, rnd *rand.Rand) *Request {
+	start := time.Now()
+	progs, gen := fuzzer.Config.Corpus.ProgramsGen()
+	ngram := fuzzer.ngrams.choose(progs, gen, rnd)
+	if ngram == nil {
+		return nil
+	}
+	p := fuzzer.target.GenerateFromNgram(rand.NewSource(rnd.Int63()), prog.RecommendedCalls,
+		fuzzer.ChoiceTable(), ngram)
+	fuzzer.prof.ModeDone(ProfilingStatModeGenerateNgram, time.Since(start))
+	return &Request{
+		Prog:          p,
+		NeedSignal:    true,
+		stat:          statNgram,
+		requesterStat: statNgram,
+	}
+}
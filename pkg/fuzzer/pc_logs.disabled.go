@@ -1,6 +0,0 @@
-//go:build !log_pc
-
-package fuzzer
-
-// log each new PC value reached
-const FLAG_LOG_NEW_PC = false
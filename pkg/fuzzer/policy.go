@@ -0,0 +1,156 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package fuzzer
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+)
+
+// SchedulingPolicy controls the mix of requests produced by the fuzzer.
+// Zero values of the fields stand for the defaults.
+// Apart from n-gram generation, which is off unless NgramRate is set,
+// fuzzing modes can be disabled entirely only via the ablation configuration.
+type SchedulingPolicy struct {
+	// Probability to mutate a corpus program instead of generating a new one when there
+	// are no queued requests (default 0.95, or 0.5 if there is no real coverage signal).
+	MutateRate float64
+	// Number of mutations of a new corpus program performed by its smash job (default 100).
+	SmashMutations int
+	// Maximum number of faults injected into the call of a new corpus program (default 100).
+	FaultInjections int
+	// Probability that a smash job starts a hints job (default 1).
+	HintsRate float64
+	// Probability to generate a program around a call sequence mined from the corpus
+	// (see prog.NgramMiner) instead of from scratch (default 0, n-grams are not used).
+	NgramRate float64
+	// If set, the values above are only the starting point: the fuzzer continuously
+	// shifts the budget towards the request types (generation, mutation, smash, hints and n-grams)
+	// with the best new signal per execution rate.
+	Adaptive bool
+}
+
+func (policy SchedulingPolicy) withDefaults(coverage bool) SchedulingPolicy {
+	if policy.MutateRate == 0 {
+		policy.MutateRate = 0.95
+		if !coverage {
+			// If we don't have real coverage signal, generate programs
+			// more frequently because fallback signal is weak.
+			policy.MutateRate = 0.5
+		}
+	}
+	if policy.SmashMutations == 0 {
+		policy.SmashMutations = 100
+	}
+	if policy.FaultInjections == 0 {
+		policy.FaultInjections = 100
+	}
+	if policy.HintsRate == 0 {
+		policy.HintsRate = 1
+	}
+	return policy
+}
+
+// policyController adapts the scheduling policy to the new signal per execution
+// rates of the request types.
+type policyController struct {
+	mu      sync.Mutex
+	base    SchedulingPolicy
+	execs   map[string]float64
+	signals map[string]float64 // executions that gave new signal
+	total   float64
+	// The policy computed on the last refresh (see policyRefresh).
+	current atomic.Pointer[SchedulingPolicy]
+	credits int
+}
+
+const (
+	// Until a request type was executed that many times, its base share is used.
+	policyWarmup = 1000
+	// Once that many requests were executed in total, all counters are halved.
+	policyWindow = 1 << 20
+	// The adaptive values are kept within [base/policyMaxScale, base*policyMaxScale].
+	policyMaxScale = 4
+	// Neither generation nor mutation is ever scheduled with a lower probability.
+	policyMinRate = 0.05
+	// The adaptive policy is recomputed once per that many executions.
+	policyRefresh = 1000
+)
+
+var policyStats = []string{statGenerate, statFuzz, statSmash, statHint, statNgram}
+
+func newPolicyController(base SchedulingPolicy) *policyController {
+	pc := &policyController{
+		base:    base,
+		execs:   make(map[string]float64),
+		signals: make(map[string]float64),
+	}
+	pc.current.Store(&base)
+	return pc
+}
+
+// credit records the outcome of the execution of a request of the given type.
+func (pc *policyController) credit(stat string, newSignal bool) {
+	if !pc.base.Adaptive {
+		return
+	}
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.execs[stat]++
+	if newSignal {
+		pc.signals[stat]++
+	}
+	pc.total++
+	if pc.total >= policyWindow {
+		for stat := range pc.execs {
+			pc.execs[stat] /= 2
+			pc.signals[stat] /= 2
+		}
+		pc.total /= 2
+	}
+	if pc.credits++; pc.credits >= policyRefresh {
+		pc.credits = 0
+		policy := pc.compute()
+		pc.current.Store(&policy)
+	}
+}
+
+// policy returns the current scheduling policy.
+func (pc *policyController) policy() SchedulingPolicy {
+	return *pc.current.Load()
+}
+
+// compute must be called with pc.mu held.
+func (pc *policyController) compute() SchedulingPolicy {
+	yields := make(map[string]float64)
+	sum := 0.0
+	for _, stat := range policyStats {
+		if pc.execs[stat] < policyWarmup {
+			continue
+		}
+		yields[stat] = pc.signals[stat] / pc.execs[stat]
+		sum += yields[stat]
+	}
+	if sum == 0 {
+		return pc.base
+	}
+	mean := sum / float64(len(yields))
+	scale := func(stat string) float64 {
+		yield, ok := yields[stat]
+		if !ok {
+			return 1
+		}
+		return math.Max(math.Min(yield/mean, policyMaxScale), 1.0/policyMaxScale)
+	}
+	res := pc.base
+	if gen, fuzz := yields[statGenerate], yields[statFuzz]; gen+fuzz > 0 &&
+		pc.execs[statGenerate] >= policyWarmup && pc.execs[statFuzz] >= policyWarmup {
+		res.MutateRate = math.Max(math.Min(fuzz/(gen+fuzz), 1-policyMinRate), policyMinRate)
+	}
+	res.SmashMutations = int(math.Max(math.Round(float64(res.SmashMutations)*scale(statSmash)), 1))
+	res.HintsRate = math.Min(res.HintsRate*scale(statHint), 1)
+	res.NgramRate = math.Min(res.NgramRate*scale(statNgram), 1)
+	return res
+}
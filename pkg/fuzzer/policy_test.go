@@ -0,0 +1,69 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package fuzzer
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyDefaults(t *testing.T) {
+	policy := SchedulingPolicy{SmashMutations: 10}.withDefaults(true)
+	assert.Equal(t, SchedulingPolicy{
+		MutateRate:      0.95,
+		SmashMutations:  10,
+		FaultInjections: 100,
+		HintsRate:       1,
+	}, policy)
+	assert.Equal(t, 0.5, SchedulingPolicy{}.withDefaults(false).MutateRate)
+
+	pc := newPolicyController(policy)
+	for i := 0; i < 2*policyWarmup; i++ {
+		pc.credit(statGenerate, true)
+	}
+	assert.Equal(t, policy, pc.policy(), "a static policy must not change")
+}
+
+func TestPolicyAdaptive(t *testing.T) {
+	base := SchedulingPolicy{Adaptive: true}.withDefaults(true)
+	pc := newPolicyController(base)
+	assert.Equal(t, base, pc.policy(), "no data yet")
+
+	rnd := rand.New(rand.NewSource(0))
+	yield := map[string]float64{
+		statGenerate: 0.04,
+		statFuzz:     0.01,
+		statSmash:    0.05,
+		statHint:     0.001,
+	}
+	for i := 0; i < 100000; i++ {
+		stat := policyStats[rnd.Intn(len(policyStats))]
+		pc.credit(stat, rnd.Float64() < yield[stat])
+	}
+	policy := pc.policy()
+	assert.Less(t, policy.MutateRate, 0.5, "generation has the better yield")
+	assert.GreaterOrEqual(t, policy.MutateRate, policyMinRate)
+	assert.Greater(t, policy.SmashMutations, base.SmashMutations)
+	assert.LessOrEqual(t, policy.SmashMutations, base.SmashMutations*policyMaxScale)
+	assert.Less(t, policy.HintsRate, base.HintsRate)
+	assert.Equal(t, base.FaultInjections, policy.FaultInjections)
+	// The policy is only recomputed periodically.
+	for i := 0; i < policyRefresh-1; i++ {
+		pc.credit(statHint, true)
+	}
+	assert.Equal(t, policy, pc.policy())
+	pc.credit(statHint, true)
+	assert.Greater(t, pc.policy().HintsRate, policy.HintsRate)
+}
+
+func TestPolicyWindow(t *testing.T) {
+	pc := newPolicyController(SchedulingPolicy{Adaptive: true})
+	for i := 0; i < policyWindow+10; i++ {
+		pc.credit(statFuzz, false)
+	}
+	assert.Less(t, pc.total, float64(policyWindow))
+	assert.Equal(t, pc.total, pc.execs[statFuzz])
+}
@@ -42,3 +42,15 @@ func TestPrioQueueWait(t *testing.T) {
 	pq.push(&priorityQueueItem[int]{value: 10, prio: priority{1}})
 	wg.Wait()
 }
+
+func TestTriageJobPrio(t *testing.T) {
+	prio := func(flags ProgTypes, rare int, id int64) priority {
+		jp := triageJobPrio(flags, rare)
+		jp.saveID(-id)
+		return jp.priority()
+	}
+	assert.True(t, prio(0, 10, 2).greaterThan(prio(0, 0, 1)), "rare signal is boosted")
+	assert.True(t, prio(0, 3, 1).greaterThan(prio(0, 2, 2)), "similar boost, older job goes first")
+	assert.True(t, prio(0, 4, 2).greaterThan(prio(0, 3, 1)))
+	assert.True(t, prio(progCandidate, 0, 2).greaterThan(prio(0, 1000, 1)), "candidates still go first")
+}
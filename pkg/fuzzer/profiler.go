@@ -0,0 +1,156 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package fuzzer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/syzkaller/pkg/profevent"
+	"github.com/google/syzkaller/prog"
+)
+
+// Origin describes how the program of a request was produced.
+type Origin struct {
+	// Stat the execution of the request is accounted to.
+	Stat string
+	// The mode of operation that (directly or not) led to the request, e.g. triage
+	// and minimization requests inherit it from the request that gave new signal.
+	RequesterStat string
+	// Mutators that were applied to the program (if it was mutated).
+	Mutators map[prog.MutatorIndex]int
+}
+
+// Profiler is notified by the fuzzer at the points of interest for profiling.
+// The methods are invoked concurrently.
+type Profiler interface {
+	// ModeDone is called after a mode of operation has been performed.
+	ModeDone(mode ProfilingModeName, took time.Duration)
+	// Mutated is called after a program was mutated.
+	Mutated(analysis map[prog.MutatorIndex]prog.MutatorAnalysis)
+	// Dequeued is called when a request waited for by a job has been executed,
+	// waited is the time the job waited for the result.
+	Dequeued(origin Origin, waited time.Duration)
+	// Triaged is called after the result of a request has been triaged.
+	Triaged(origin Origin, newSignal bool)
+	// NewInput is called after an input has been added to the corpus,
+	// newCover are the PCs covered by the input that were not covered before.
+	NewInput(origin Origin, newCover []uint32)
+	// SmashDone is called after a smash job has finished.
+	SmashDone(analysis SmashAnalysis)
+	// HintsDone is called after a hints job has finished.
+	HintsDone(fromSmash bool, took time.Duration)
+}
+
+// NoopProfiler ignores all notifications, it's used unless Config.Profiling is set.
+type NoopProfiler struct{}
+
+func (NoopProfiler) ModeDone(ProfilingModeName, time.Duration)          {}
+func (NoopProfiler) Mutated(map[prog.MutatorIndex]prog.MutatorAnalysis) {}
+func (NoopProfiler) Dequeued(Origin, time.Duration)                     {}
+func (NoopProfiler) Triaged(Origin, bool)                               {}
+func (NoopProfiler) NewInput(Origin, []uint32)                          {}
+func (NoopProfiler) SmashDone(SmashAnalysis)                            {}
+func (NoopProfiler) HintsDone(bool, time.Duration)                      {}
+
+type SmashAnalysis struct {
+	NFaultInjection        uint64
+	NHintsJobStart         uint64
+	DurationMutations      time.Duration
+	DurationFullSmash      time.Duration
+	DurationFaultInjection time.Duration
+}
+
+// statsProfiler accounts the notifications in ProfilingStats and in the fuzzer stats
+// (which are sent to the manager), and emits profiling events.
+type statsProfiler struct {
+	fuzzer *Fuzzer
+	stats  *ProfilingStats
+}
+
+func newStatsProfiler(fuzzer *Fuzzer) *statsProfiler {
+	return &statsProfiler{
+		fuzzer: fuzzer,
+		stats:  NewProfilingStats(),
+	}
+}
+
+func (sp *statsProfiler) addStats(stats map[string]uint64) {
+	sp.fuzzer.mu.Lock()
+	defer sp.fuzzer.mu.Unlock()
+	for name, val := range stats {
+		sp.fuzzer.stats[name] += val
+	}
+}
+
+func (sp *statsProfiler) ModeDone(mode ProfilingModeName, took time.Duration) {
+	sp.stats.IncModeCounter(mode)
+	sp.stats.AddModeDuration(mode, took)
+	sp.addStats(map[string]uint64{
+		fmt.Sprintf("%v > time spent (!= executing) (ns)", mode): uint64(took.Nanoseconds()),
+	})
+}
+
+func (sp *statsProfiler) Mutated(analysis map[prog.MutatorIndex]prog.MutatorAnalysis) {
+	for idx, a := range analysis {
+		sp.stats.AddMutatorCounter(mutatorStatName(idx), int(a.NSuccess+a.NFails))
+	}
+	sp.stats.AddMutatorAnalysis(analysis)
+}
+
+func (sp *statsProfiler) Dequeued(origin Origin, waited time.Duration) {
+	sp.addStats(map[string]uint64{
+		fmt.Sprintf("[prof] priority queue > time spent for stat='%v', requesterStat='%v'",
+			origin.Stat, origin.RequesterStat): uint64(waited.Nanoseconds()),
+	})
+}
+
+func (sp *statsProfiler) Triaged(origin Origin, newSignal bool) {
+	sp.stats.AddMutatorExec(origin.Mutators, newSignal)
+}
+
+func (sp *statsProfiler) NewInput(origin Origin, newCover []uint32) {
+	sp.stats.AddMutatorCorpusInput(origin.Mutators)
+	covChanged := len(newCover) > 0
+	contrib := ProfilingStatContribution(origin.RequesterStat, covChanged)
+	blocks := ProfilingStatBasicBlocksCoverage(origin.RequesterStat)
+	if origin.Stat == statMinimize {
+		// If the input comes from a minimize request, we attribute the new coverage
+		// to the requester of the minimization.
+		contrib = fmt.Sprintf("%s (via %s)", contrib, statMinimize)
+		blocks = fmt.Sprintf("%s (via %s)", blocks, statMinimize)
+	}
+	sp.addStats(map[string]uint64{
+		contrib: 1,
+		blocks:  uint64(len(newCover)),
+		ProfilingAllStatsContribution(covChanged): 1,
+	})
+	if sp.fuzzer.Config.LogNewPCs {
+		for _, pc := range newCover {
+			sp.fuzzer.emit(profevent.KindNewPC, profevent.NewPC{
+				PC:            pc,
+				Stat:          origin.Stat,
+				RequesterStat: origin.RequesterStat,
+			})
+		}
+	}
+}
+
+func (sp *statsProfiler) SmashDone(analysis SmashAnalysis) {
+	sp.addStats(map[string]uint64{
+		"[prof] analysis : smash > #hintsJobs started":           analysis.NHintsJobStart,
+		"[prof] analysis : smash > #fault Injections":            analysis.NFaultInjection,
+		"[prof] analysis : smash > time spent (fault injection)": uint64(analysis.DurationFaultInjection.Nanoseconds()),
+		"[prof] analysis : smash > time spent (full smash)":      uint64(analysis.DurationFullSmash.Nanoseconds()),
+		"[prof] analysis : smash > time spent (mutations)":       uint64(analysis.DurationMutations.Nanoseconds()),
+	})
+}
+
+func (sp *statsProfiler) HintsDone(fromSmash bool, took time.Duration) {
+	if fromSmash {
+		sp.addStats(map[string]uint64{
+			"[prof] analysis : smash > time spent (hintsJob)": uint64(took.Nanoseconds()),
+		})
+	}
+}
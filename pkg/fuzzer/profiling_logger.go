@@ -1,65 +1,70 @@
 package fuzzer
 
-import "time"
+import (
+	"time"
 
-func (fuzzer *Fuzzer) StartProfilingLogger() {
-	go func() {
-		modes := allModes()
-		mutators := allMutators()
+	"github.com/google/syzkaller/pkg/profevent"
+	"github.com/google/syzkaller/prog"
+)
 
-		prevCounts := map[string]uint64{}
+// logger periodically emits the profiling stats as profiling events.
+func (sp *statsProfiler) logger() {
+	fuzzer := sp.fuzzer
+	modes := allModes()
+	mutators := allMutators()
 
-		for {
-			time.Sleep(60 * time.Second)
-			now := time.Now().Unix()
+	prevCounts := map[string]uint64{}
 
-			counts := fuzzer.profilingStats.allCounts()
-			countsJson, err := ToJson(counts)
-			if err != nil {
-				fuzzer.Logf(0, "ERROR encoding counts map to JSON")
-			}
-
-			durations := fuzzer.profilingStats.allDurations()
-			displayDurations := map[string]string{}
-			for k, v := range durations {
-				displayDurations[k] = v.String()
-			}
-			durationsJson, err := ToJson(displayDurations)
-			if err != nil {
-				fuzzer.Logf(0, "ERROR encoding duration map to JSON")
-			}
+	for {
+		select {
+		case <-time.After(60 * time.Second):
+		case <-fuzzer.ctx.Done():
+			return
+		}
+		counts := sp.stats.allCounts()
+		fuzzer.emit(profevent.KindCounts, counts)
+		fuzzer.emit(profevent.KindDurations, sp.stats.allDurations())
+		fuzzer.emit(profevent.KindFuzzerStats, fuzzer.GrabAllStats())
 
-			fuzzer.Logf(0, "%v;logging total counts:%v", now, countsJson)
-			fuzzer.Logf(0, "%v;logging total durations (hh:mm:ss):%v", now, durationsJson)
+		weights := map[string]float64{}
+		for idx, weight := range fuzzer.mutatorWeights() {
+			weights[prog.MutatorIndex(idx).String()] = weight
+		}
+		fuzzer.emit(profevent.KindMutatorWeights, weights)
+		fuzzer.emit(profevent.KindMutatorStats, sp.stats.allMutatorStats())
 
-			// log all fuzzer stats stats
-			stats := fuzzer.GrabAllStats()
-			statsJson, err := ToJson(stats)
-			if err != nil {
-				fuzzer.Logf(0, "ERROR encoding stats map to JSON")
-			}
-			fuzzer.Logf(0, "%v;logging all stats:%v", now, statsJson)
+		fuzzer.mu.Lock()
+		for _, mode := range modes {
+			modeName := string(mode)
+			current := counts[modeName]
+			delta := current - prevCounts[modeName]
 
-			fuzzer.mu.Lock()
-			for _, mode := range modes {
-				modeName := string(mode)
-				current := counts[modeName]
-				delta := current - prevCounts[modeName]
+			fuzzer.stats[modeName] = delta
+			prevCounts[modeName] = current
+		}
 
-				fuzzer.stats[modeName] = delta
-				prevCounts[modeName] = current
-			}
+		for _, mutator := range mutators {
+			mutatorName := string(mutator)
+			current := counts[mutatorName]
+			delta := current - prevCounts[mutatorName]
 
-			for _, mutator := range mutators {
-				mutatorName := string(mutator)
-				current := counts[mutatorName]
-				delta := current - prevCounts[mutatorName]
+			fuzzer.stats[mutatorName] = delta
+			prevCounts[mutatorName] = current
+		}
 
-				fuzzer.stats[mutatorName] = delta
-				prevCounts[mutatorName] = current
-			}
+		fuzzer.mu.Unlock()
+	}
+}
 
-			fuzzer.mu.Unlock()
-		}
-	}()
+// emit passes a profiling event to Config.ProfilingEvents.
+func (fuzzer *Fuzzer) emit(kind profevent.Kind, data interface{}) {
+	if fuzzer.Config.ProfilingEvents == nil {
+		return
+	}
+	ev, err := profevent.New("", kind, data)
+	if err != nil {
+		fuzzer.Logf(0, "%v", err)
+		return
+	}
+	fuzzer.Config.ProfilingEvents(ev)
 }
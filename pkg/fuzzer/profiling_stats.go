@@ -1,9 +1,10 @@
-//go:build profiling
-
 package fuzzer
 
 import (
 	"time"
+
+	"github.com/google/syzkaller/pkg/profevent"
+	"github.com/google/syzkaller/prog"
 )
 
 type ProfilingStats struct {
@@ -17,6 +18,22 @@ type ProfilingStats struct {
 
 	// time elapsed executing modes of operations
 	durationModes map[ProfilingModeName]*AtomicDuration
+
+	// success accounting and downstream attribution for individual mutators
+	mutators [prog.MutatorCount]mutatorStats
+}
+
+type mutatorStats struct {
+	// applications of the mutator that changed the program or did nothing
+	success     StatCount
+	fails       StatCount
+	timeSuccess AtomicDuration
+	timeFails   AtomicDuration
+	// executed programs the mutator was applied to, how many of them gave new signal
+	// and how many inputs they contributed to the corpus
+	execs        StatCount
+	newSignal    StatCount
+	corpusInputs StatCount
 }
 
 func NewProfilingStats() *ProfilingStats {
@@ -49,12 +66,16 @@ func (ps *ProfilingStats) allCounts() map[string]uint64 {
 		string(ProfilingStatModeMutateHints):     ps.countModes[ProfilingStatModeMutateHints].get(),
 		string(ProfilingStatModeSmash):           ps.countModes[ProfilingStatModeSmash].get(),
 		string(ProfilingStatModeMutateFromSmash): ps.countModes[ProfilingStatModeMutateFromSmash].get(),
+		string(ProfilingStatModeGenerateNgram):   ps.countModes[ProfilingStatModeGenerateNgram].get(),
 		// mutators
 		string(ProfilingStatMutatorSquashAny):  ps.countMutators[ProfilingStatMutatorSquashAny].get(),
 		string(ProfilingStatMutatorSplice):     ps.countMutators[ProfilingStatMutatorSplice].get(),
 		string(ProfilingStatMutatorInsertCall): ps.countMutators[ProfilingStatMutatorInsertCall].get(),
 		string(ProfilingStatMutatorMutateArg):  ps.countMutators[ProfilingStatMutatorMutateArg].get(),
 		string(ProfilingStatMutatorRemoveCall): ps.countMutators[ProfilingStatMutatorRemoveCall].get(),
+
+		string(ProfilingStatMutatorRewireResources): ps.countMutators[ProfilingStatMutatorRewireResources].get(),
+		string(ProfilingStatMutatorCrossover):       ps.countMutators[ProfilingStatMutatorCrossover].get(),
 	}
 }
 
@@ -66,6 +87,7 @@ func (ps *ProfilingStats) allDurations() map[string]time.Duration {
 		string(ProfilingStatModeMutateHints):     ps.durationModes[ProfilingStatModeMutateHints].Get(),
 		string(ProfilingStatModeSmash):           ps.durationModes[ProfilingStatModeSmash].Get(),
 		string(ProfilingStatModeMutateFromSmash): ps.durationModes[ProfilingStatModeMutateFromSmash].Get(),
+		string(ProfilingStatModeGenerateNgram):   ps.durationModes[ProfilingStatModeGenerateNgram].Get(),
 	}
 }
 
@@ -84,3 +106,47 @@ func (ps *ProfilingStats) IncMutatorCounter(mutator ProfilingMutatorName) {
 func (ps *ProfilingStats) AddModeDuration(mode ProfilingModeName, duration time.Duration) {
 	ps.durationModes[mode].Add(duration)
 }
+
+func (ps *ProfilingStats) AddMutatorAnalysis(analysis map[prog.MutatorIndex]prog.MutatorAnalysis) {
+	for idx, a := range analysis {
+		stats := &ps.mutators[idx]
+		stats.success.add(int(a.NSuccess))
+		stats.fails.add(int(a.NFails))
+		stats.timeSuccess.Add(a.TimeSuccess)
+		stats.timeFails.Add(a.TimeFails)
+	}
+}
+
+// AddMutatorExec attributes the execution of a program to the mutators that were applied to it.
+func (ps *ProfilingStats) AddMutatorExec(applied map[prog.MutatorIndex]int, newSignal bool) {
+	for idx := range applied {
+		ps.mutators[idx].execs.inc()
+		if newSignal {
+			ps.mutators[idx].newSignal.inc()
+		}
+	}
+}
+
+// AddMutatorCorpusInput attributes a new corpus input to the mutators that were applied to it.
+func (ps *ProfilingStats) AddMutatorCorpusInput(applied map[prog.MutatorIndex]int) {
+	for idx := range applied {
+		ps.mutators[idx].corpusInputs.inc()
+	}
+}
+
+func (ps *ProfilingStats) allMutatorStats() map[string]profevent.MutatorStats {
+	res := make(map[string]profevent.MutatorStats)
+	for idx := range ps.mutators {
+		stats := &ps.mutators[idx]
+		res[prog.MutatorIndex(idx).String()] = profevent.MutatorStats{
+			NSuccess:     stats.success.get(),
+			NFails:       stats.fails.get(),
+			TimeSuccess:  stats.timeSuccess.Get(),
+			TimeFails:    stats.timeFails.Get(),
+			Execs:        stats.execs.get(),
+			NewSignal:    stats.newSignal.get(),
+			CorpusInputs: stats.corpusInputs.get(),
+		}
+	}
+	return res
+}
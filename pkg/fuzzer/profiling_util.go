@@ -3,7 +3,8 @@ package fuzzer
 import (
 	"encoding/json"
 	"fmt"
-	"time"
+
+	"github.com/google/syzkaller/prog"
 )
 
 type ProfilingModeName string
@@ -16,6 +17,7 @@ const (
 	ProfilingStatModeMutateHints     ProfilingModeName = prefix + " mode mutate with hints"
 	ProfilingStatModeSmash           ProfilingModeName = prefix + " mode smash"
 	ProfilingStatModeMutateFromSmash ProfilingModeName = prefix + " mode mutate (from smash)"
+	ProfilingStatModeGenerateNgram   ProfilingModeName = prefix + " mode generate (ngram)"
 )
 
 func ProfilingStatContribution(requesterStat string, coverageIncrease bool) string {
@@ -40,8 +42,32 @@ const (
 	ProfilingStatMutatorInsertCall ProfilingMutatorName = prefix + " mutator insertCall"
 	ProfilingStatMutatorMutateArg  ProfilingMutatorName = prefix + " mutator mutateArg"
 	ProfilingStatMutatorRemoveCall ProfilingMutatorName = prefix + " mutator removeCall"
+
+	ProfilingStatMutatorRewireResources ProfilingMutatorName = prefix + " mutator rewireResources"
+	ProfilingStatMutatorCrossover       ProfilingMutatorName = prefix + " mutator crossover"
 )
 
+func mutatorStatName(idx prog.MutatorIndex) ProfilingMutatorName {
+	switch idx {
+	case prog.MutatorIndexSquashAny:
+		return ProfilingStatMutatorSquashAny
+	case prog.MutatorIndexSplice:
+		return ProfilingStatMutatorSplice
+	case prog.MutatorIndexInsertCall:
+		return ProfilingStatMutatorInsertCall
+	case prog.MutatorIndexMutateArg:
+		return ProfilingStatMutatorMutateArg
+	case prog.MutatorIndexRemoveCall:
+		return ProfilingStatMutatorRemoveCall
+	case prog.MutatorIndexRewireResources:
+		return ProfilingStatMutatorRewireResources
+	case prog.MutatorIndexCrossover:
+		return ProfilingStatMutatorCrossover
+	default:
+		panic(fmt.Sprintf("unknown mutator index %v", idx))
+	}
+}
+
 // careful, a new slice is generated each time. Don't abuse
 func allModes() []ProfilingModeName {
 	return []ProfilingModeName{
@@ -50,6 +76,7 @@ func allModes() []ProfilingModeName {
 		ProfilingStatModeMutateHints,
 		ProfilingStatModeSmash,
 		ProfilingStatModeMutateFromSmash,
+		ProfilingStatModeGenerateNgram,
 	}
 }
 
@@ -61,21 +88,11 @@ func allMutators() []ProfilingMutatorName {
 		ProfilingStatMutatorInsertCall,
 		ProfilingStatMutatorMutateArg,
 		ProfilingStatMutatorRemoveCall,
+		ProfilingStatMutatorRewireResources,
+		ProfilingStatMutatorCrossover,
 	}
 }
 
-func (fuzzer *Fuzzer) AddTimeSpent(identifier string, duration time.Duration) {
-	fuzzer.mu.Lock()
-	defer fuzzer.mu.Unlock()
-
-	fuzzer.stats[identifier] += uint64(duration.Nanoseconds())
-}
-
-func (fuzzer *Fuzzer) AddModeTimeSpent(mode ProfilingModeName, duration time.Duration) {
-	id := fmt.Sprintf("%v > time spent (!= executing) (ns)", mode)
-	fuzzer.AddTimeSpent(id, duration)
-}
-
 // https://siongui.github.io/2016/01/30/go-pretty-print-variable/
 func Prettify(v interface{}) (string, error) {
 	b, err := json.MarshalIndent(v, "", "  ") // to json
@@ -1,5 +1,3 @@
-//go:build !profiling
-
 // Copyright 2024 syzkaller project authors. All rights reserved.
 // Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
 
@@ -17,6 +15,10 @@ const (
 	statCollide        = "exec collide"
 	statExecTotal      = "exec total"
 	statBufferTooSmall = "buffer too small"
+	statFuzzFromSmash  = "exec fuzz (from smash)"
+	statSeedFromHint   = "exec seeds (from hint)"
+	statValueProfile   = "exec value profile"
+	statNgram          = "exec ngram"
 )
 
 func (fuzzer *Fuzzer) GrabStats() map[string]uint64 {
@@ -26,3 +28,17 @@ func (fuzzer *Fuzzer) GrabStats() map[string]uint64 {
 	fuzzer.stats = map[string]uint64{}
 	return ret
 }
+
+func (fuzzer *Fuzzer) GrabAllStats() map[string]uint64 {
+	r := fuzzer.GrabStats()
+
+	fuzzer.mu.Lock()
+	defer fuzzer.mu.Unlock()
+
+	r["running jobs"] = uint64(fuzzer.runningJobs.Load())
+	r["queued candidates"] = uint64(fuzzer.queuedCandidates.Load())
+	r["exec queue size (prio queue of req)"] = uint64(fuzzer.nextExec.Len())
+	r["queued requests (running req)"] = uint64(len(fuzzer.runningExecs))
+
+	return r
+}
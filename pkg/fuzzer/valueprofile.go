@@ -0,0 +1,181 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package fuzzer
+
+import (
+	"github.com/google/syzkaller/pkg/corpus"
+	"github.com/google/syzkaller/pkg/cover"
+	"github.com/google/syzkaller/pkg/ipc"
+	"github.com/google/syzkaller/pkg/signal"
+	"github.com/google/syzkaller/profiler"
+	"github.com/google/syzkaller/prog"
+)
+
+// The share of the mutated programs that are executed to collect the comparisons
+// instead of the coverage if the value profile feedback is enabled.
+const valueProfileRate = 0.1
+
+func (fuzzer *Fuzzer) valueProfile() bool {
+	return fuzzer.Config.ValueProfile && fuzzer.Config.Comparisons
+}
+
+func (fuzzer *Fuzzer) triageValueProfile(req *Request, info *ipc.CallInfo, call int) bool {
+	newValueProfile := fuzzer.Cover.addRawMaxValueProfile(info.CompSignal)
+	if newValueProfile.Empty() || req.flags&progInTriage > 0 {
+		return false
+	}
+	fuzzer.Logf(2, "found new value profile signal in call %d in %s", call, req.Prog)
+	fuzzer.startJob(&valueProfileJob{
+		p:               req.Prog.Clone(),
+		call:            call,
+		info:            *info,
+		newValueProfile: newValueProfile,
+		flags:           req.flags,
+		jobPriority:     triageJobPrio(req.flags, 0),
+		origin:          req.origin(),
+		lineage:         req.lineage(),
+	})
+	return true
+}
+
+// valueProfileJob is the triageJob counterpart for the programs with new value profile signal:
+// the program is deflaked and minimized with the comparison collection executions.
+// Then it's saved to the corpus with its coverage signal, even if the coverage is not new.
+type valueProfileJob struct {
+	p               *prog.Prog
+	call            int
+	info            ipc.CallInfo
+	newValueProfile signal.Signal
+	flags           ProgTypes
+	jobPriority
+	origin  Origin
+	lineage corpus.Lineage
+}
+
+func (job *valueProfileJob) run(fuzzer *Fuzzer) {
+	fuzzer.Logf(3, "triaging value profile of call #%v %v (new signal=%v)",
+		job.call, job.p.Calls[job.call].Meta.Name, job.newValueProfile.Len())
+	stable, newStable, stop := job.deflake(fuzzer)
+	if stop || newStable.Empty() {
+		return
+	}
+	if job.flags&progMinimized == 0 {
+		if job.minimize(fuzzer, newStable) {
+			return
+		}
+	}
+	// Now collect the coverage of the program.
+	result := fuzzer.exec(job, &Request{
+		Prog:          job.p,
+		NeedSignal:    true,
+		NeedCover:     true,
+		stat:          statTriage,
+		flags:         progInTriage,
+		requesterStat: job.origin.RequesterStat,
+	})
+	if result.Stop {
+		return
+	}
+	input := corpus.NewInput{
+		Prog:         job.p,
+		Call:         job.call,
+		Lineage:      job.lineage,
+		ValueProfile: stable,
+	}
+	if result.Info != nil && job.call < len(result.Info.Calls) {
+		var rawCover []uint32
+		var cov cover.Cover
+		input.Signal, rawCover = getSignalAndCover(job.p, result.Info, job.call)
+		cov.Merge(rawCover)
+		input.Cover = cov.Serialize()
+	}
+	fuzzer.Logf(2, "added new input for value profile of call #%v to the corpus:\n%s", job.call, job.p)
+	fuzzer.saveInput(input, job.flags, job.origin)
+}
+
+// deflake returns the stable value profile signal of the call and the stable part of the new one.
+func (job *valueProfileJob) deflake(fuzzer *Fuzzer) (stable, newStable signal.Signal, stop bool) {
+	const runs = 3
+	var notExecuted int
+	for i := 0; i < runs; i++ {
+		result := fuzzer.exec(job, &Request{
+			Prog:          job.p,
+			NeedHints:     true,
+			stat:          statTriage,
+			flags:         progInTriage,
+			requesterStat: job.origin.RequesterStat,
+		})
+		if result.Stop {
+			return nil, nil, true
+		}
+		if !compsReexecutionSuccess(result.Info, &job.info, job.call) {
+			notExecuted++
+			if notExecuted >= runs/2+1 {
+				return nil, nil, true
+			}
+			continue
+		}
+		this := job.valueProfile(result.Info, job.call)
+		if stable == nil {
+			stable = this
+			newStable = job.newValueProfile.Intersection(this)
+		} else {
+			stable = stable.Intersection(this)
+			newStable = newStable.Intersection(this)
+		}
+		if newStable.Empty() {
+			return
+		}
+	}
+	return
+}
+
+func (job *valueProfileJob) minimize(fuzzer *Fuzzer, newValueProfile signal.Signal) (stop bool) {
+	const minimizeAttempts = 3
+	job.p, job.call = prog.Minimize(job.p, job.call, false,
+		func(p1 *prog.Prog, call1 int) bool {
+			if stop || profiler.Ablation().DisableStageMinimize || call1 == -1 {
+				return false
+			}
+			for i := 0; i < minimizeAttempts; i++ {
+				result := fuzzer.exec(job, &Request{
+					Prog:          p1,
+					NeedHints:     true,
+					stat:          statMinimize,
+					requesterStat: job.origin.RequesterStat,
+				})
+				if result.Stop {
+					stop = true
+					return false
+				}
+				if !compsReexecutionSuccess(result.Info, &job.info, call1) {
+					continue
+				}
+				if newValueProfile.Intersection(job.valueProfile(result.Info, call1)).Len() ==
+					newValueProfile.Len() {
+					return true
+				}
+			}
+			return false
+		})
+	return stop
+}
+
+func (job *valueProfileJob) valueProfile(info *ipc.ProgInfo, call int) signal.Signal {
+	if info == nil || call >= len(info.Calls) {
+		return nil
+	}
+	return signal.FromRaw(info.Calls[call].CompSignal, 0)
+}
+
+func compsReexecutionSuccess(info *ipc.ProgInfo, oldInfo *ipc.CallInfo, call int) bool {
+	if info == nil || call >= len(info.Calls) {
+		return false
+	}
+	// Don't minimize calls from successful to unsuccessful.
+	if oldInfo.Errno == 0 && info.Calls[call].Errno != 0 {
+		return false
+	}
+	return len(info.Calls[call].CompSignal) != 0
+}
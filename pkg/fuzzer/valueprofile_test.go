@@ -0,0 +1,107 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package fuzzer
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/google/syzkaller/pkg/corpus"
+	"github.com/google/syzkaller/pkg/ipc"
+	"github.com/google/syzkaller/pkg/signal"
+	"github.com/google/syzkaller/pkg/testutil"
+	"github.com/google/syzkaller/prog"
+	"github.com/google/syzkaller/sys/targets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValueProfile(t *testing.T) {
+	target, err := prog.GetTarget(targets.TestOS, targets.TestArch64Fuzz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fuzzer := newValueProfileFuzzer(ctx, t, target)
+
+	const maxExecs = 100000
+	for i := 0; i < maxExecs && fuzzer.Config.Corpus.Stats().ValueProfile < 2; i++ {
+		req := fuzzer.NextInput()
+		fuzzer.Done(req, &Result{Info: valueProfileExec(req)})
+	}
+	stats := fuzzer.Stats()
+	assert.GreaterOrEqual(t, stats.ValueProfile, 2)
+	assert.GreaterOrEqual(t, stats.MaxValueProfile, stats.ValueProfile)
+	// The value profile signal does not leak into the coverage signal.
+	for _, item := range fuzzer.Config.Corpus.Items() {
+		assert.Empty(t, item.Signal.Intersection(item.ValueProfile), item.Sig)
+	}
+}
+
+func TestValueProfileCandidate(t *testing.T) {
+	target, err := prog.GetTarget(targets.TestOS, targets.TestArch64Fuzz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fuzzer := newValueProfileFuzzer(ctx, t, target)
+
+	// The coverage of the candidate is not new, it's kept only for its value profile.
+	p, err := target.Deserialize([]byte("syz_test_fuzzer1(0x5, 0x0, 0x0)\n"), prog.NonStrict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fuzzer.Cover.AddMaxSignal(signal.FromRaw([]uint32{1}, 3))
+	fuzzer.AddCandidates([]Candidate{{
+		Prog:         p,
+		Minimized:    true,
+		Smashed:      true,
+		ValueProfile: true,
+	}})
+	assert.Equal(t, 2, fuzzer.Stats().Candidates)
+
+	const maxExecs = 100000
+	for i := 0; i < maxExecs && fuzzer.Config.Corpus.Stats().ValueProfile == 0; i++ {
+		req := fuzzer.NextInput()
+		fuzzer.Done(req, &Result{Info: valueProfileExec(req)})
+	}
+	items := fuzzer.Config.Corpus.Items()
+	if assert.Len(t, items, 1) {
+		assert.Equal(t, string(p.Serialize()), string(items[0].Prog.Serialize()))
+		assert.Equal(t, 1, items[0].ValueProfile.Len())
+	}
+}
+
+func newValueProfileFuzzer(ctx context.Context, t *testing.T, target *prog.Target) *Fuzzer {
+	return NewFuzzer(ctx, &Config{
+		Corpus:       corpus.NewCorpus(ctx),
+		Logf:         func(level int, msg string, args ...interface{}) {},
+		Coverage:     true,
+		Comparisons:  true,
+		ValueProfile: true,
+		EnabledCalls: map[*prog.Syscall]bool{
+			target.SyscallMap["syz_test_fuzzer1"]: true,
+		},
+	}, rand.New(testutil.RandSource(t)), target)
+}
+
+// valueProfileExec is a fake executor that gives the same coverage signal for all programs,
+// but the comparisons of the first call depend on its first argument.
+func valueProfileExec(req *Request) *ipc.ProgInfo {
+	info := &ipc.ProgInfo{}
+	for idx := range req.Prog.Calls {
+		call := ipc.CallInfo{Flags: ipc.CallExecuted | ipc.CallFinished}
+		if req.NeedSignal {
+			call.Signal = []uint32{uint32(idx) + 1}
+		}
+		if req.NeedHints && idx == 0 {
+			arg := req.Prog.Calls[0].Args[0].(*prog.ConstArg)
+			call.CompSignal = []uint32{signal.ValueProfile(1, arg.Val, 0x1234)}
+		}
+		info.Calls = append(info.Calls, call)
+	}
+	return info
+}
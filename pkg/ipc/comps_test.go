@@ -0,0 +1,75 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package ipc
+
+import (
+	"testing"
+
+	"github.com/google/syzkaller/pkg/signal"
+	"github.com/google/syzkaller/prog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadComps(t *testing.T) {
+	var out []byte
+	put32 := func(v uint32) {
+		out = prog.HostEndian.AppendUint32(out, v)
+	}
+	put64 := func(v uint64) {
+		out = prog.HostEndian.AppendUint64(out, v)
+	}
+	putComps := func(withPC bool) {
+		out = out[:0]
+		putPC := func(pc uint32) {
+			if withPC {
+				put32(pc)
+			}
+		}
+		// 4-byte comparison with a const.
+		put32(compConstMask)
+		put32(0x10)
+		put32(0x11)
+		putPC(0x1000)
+		// 8-byte comparison.
+		put32(compSize8)
+		put64(0xabcd)
+		put64(0xabce)
+		putPC(0x2000)
+		// Satisfied comparison.
+		put32(0)
+		put32(0x5)
+		put32(0x5)
+		putPC(0x3000)
+	}
+	wantComps := prog.CompMap{
+		0x11:   {0x10: true},
+		0xabce: {0xabcd: true},
+		0xabcd: {0xabce: true},
+	}
+
+	putComps(true)
+	comps, compSignal, err := readComps(&out, 3, true)
+	assert.NoError(t, err)
+	assert.Empty(t, out)
+	assert.Equal(t, wantComps, comps)
+	assert.Equal(t, []uint32{
+		signal.ValueProfile(0x1000, 0x10, 0x11),
+		signal.ValueProfile(0x2000, 0xabcd, 0xabce),
+		signal.ValueProfile(0x3000, 0x5, 0x5),
+	}, compSignal)
+
+	putComps(false)
+	comps, compSignal, err = readComps(&out, 3, false)
+	assert.NoError(t, err)
+	assert.Empty(t, out)
+	assert.Equal(t, wantComps, comps)
+	assert.Empty(t, compSignal)
+
+	out = out[:0]
+	put32(compSize8)
+	put64(1)
+	put64(2)
+	_, _, err = readComps(&out, 1, true)
+	assert.Error(t, err, "the PC is missing")
+}
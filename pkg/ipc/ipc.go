@@ -55,6 +55,7 @@ const (
 	FlagCollectComps                               // collect KCOV comparisons
 	FlagThreaded                                   // use multiple threads to mitigate blocked syscalls
 	FlagEnableCoverageFilter                       // setup and use bitmap to do coverage filter
+	FlagCollectCompsPC                             // collect PCs of KCOV comparisons (value profile)
 )
 
 type ExecOpts struct {
@@ -91,7 +92,10 @@ type CallInfo struct {
 	Cover  []uint32 // per-call coverage, filled if FlagSignal is set and cover == true,
 	// if dedup == false, then cov effectively contains a trace, otherwise duplicates are removed
 	Comps prog.CompMap // per-call comparison operands
-	Errno int          // call errno (0 if the call was successful)
+	// Value profile signal of the comparisons (see signal.ValueProfile),
+	// filled if FlagCollectComps and FlagCollectCompsPC are set.
+	CompSignal []uint32
+	Errno      int // call errno (0 if the call was successful)
 }
 
 type ProgInfo struct {
@@ -383,11 +387,11 @@ func (env *Env) parseOutput(p *prog.Prog, opts *ExecOpts) (*ProgInfo, error) {
 			return nil, fmt.Errorf("call %v/%v/%v: cover overflow: %v/%v",
 				i, reply.index, reply.num, reply.coverSize, len(out))
 		}
-		comps, err := readComps(&out, reply.compsSize)
+		comps, compSignal, err := readComps(&out, reply.compsSize, opts.Flags&FlagCollectCompsPC != 0)
 		if err != nil {
 			return nil, err
 		}
-		inf.Comps = comps
+		inf.Comps, inf.CompSignal = comps, compSignal
 	}
 	if len(extraParts) == 0 {
 		return info, nil
@@ -422,18 +426,22 @@ func convertExtra(extraParts []CallInfo, dedupCover bool) CallInfo {
 	return extra
 }
 
-func readComps(outp *[]byte, compsSize uint32) (prog.CompMap, error) {
+func readComps(outp *[]byte, compsSize uint32, withPC bool) (prog.CompMap, []uint32, error) {
 	if compsSize == 0 {
-		return nil, nil
+		return nil, nil, nil
 	}
 	compMap := make(prog.CompMap)
+	var compSignal []uint32
+	if withPC {
+		compSignal = make([]uint32, 0, compsSize)
+	}
 	for i := uint32(0); i < compsSize; i++ {
 		typ, ok := readUint32(outp)
 		if !ok {
-			return nil, fmt.Errorf("failed to read comp %v", i)
+			return nil, nil, fmt.Errorf("failed to read comp %v", i)
 		}
 		if typ > compConstMask|compSizeMask {
-			return nil, fmt.Errorf("bad comp %v type %v", i, typ)
+			return nil, nil, fmt.Errorf("bad comp %v type %v", i, typ)
 		}
 		var op1, op2 uint64
 		var ok1, ok2 bool
@@ -447,7 +455,15 @@ func readComps(outp *[]byte, compsSize uint32) (prog.CompMap, error) {
 			op1, op2 = uint64(tmp1), uint64(tmp2)
 		}
 		if !ok1 || !ok2 {
-			return nil, fmt.Errorf("failed to read comp %v op", i)
+			return nil, nil, fmt.Errorf("failed to read comp %v op", i)
+		}
+		if withPC {
+			pc, ok := readUint32(outp)
+			if !ok {
+				return nil, nil, fmt.Errorf("failed to read comp %v pc", i)
+			}
+			// Satisfied comparisons are the most interesting value profile signal.
+			compSignal = append(compSignal, signal.ValueProfile(pc, op1, op2))
 		}
 		if op1 == op2 {
 			continue // it's useless to store such comparisons
@@ -462,7 +478,7 @@ func readComps(outp *[]byte, compsSize uint32) (prog.CompMap, error) {
 		}
 		compMap.AddComp(op1, op2)
 	}
-	return compMap, nil
+	return compMap, compSignal, nil
 }
 
 func readUint32(outp *[]byte) (uint32, bool) {
@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 
 	"github.com/google/syzkaller/pkg/asset"
+	"github.com/google/syzkaller/profiler"
 )
 
 type Config struct {
@@ -143,7 +144,8 @@ type Config struct {
 	// "pcs": specify raw PC table files name.
 	// Each line of the file should be: "64-bit-pc:32-bit-weight\n".
 	// eg. "0xffffffff81000000:0x10\n"
-	CovFilter covFilterCfg `json:"cover_filter,omitempty"`
+	// The filter can be changed at runtime with the /api/v1/coverfilter/set manager endpoint.
+	CovFilter CovFilterCfg `json:"cover_filter,omitempty"`
 
 	// For each prog in the corpus, remember the raw array of PCs obtained from the kernel.
 	// It can be useful for debugging syzkaller descriptions and syzkaller itself.
@@ -204,6 +206,57 @@ type Config struct {
 	// More details can be found in pkg/asset/config.go.
 	AssetStorage *asset.Config `json:"asset_storage"`
 
+	// Ablation configuration passed to all fuzzers (optional).
+	// Each flag disables or reduces a fuzzing mode, a mutator or a stage, e.g.:
+	//	"ablation": {"disable_mutator_splice": true, "disable_stage_collide": true}
+	// The configuration can be changed at runtime via the /ablation page of the
+	// manager HTTP UI, the new settings are pushed to the fuzzers right away
+	// (in the deterministic mode, fuzzers pick them up on their next poll).
+	Ablation profiler.AblationConfiguration `json:"ablation"`
+
+	// Enable profiling of the fuzzing process (optional, default false).
+	// Fuzzers account detailed stats about fuzzing modes and mutators, and these stats
+	// are written to the profiling event stream (profiling.jsonl in the workdir).
+	Profiling bool `json:"profiling"`
+	// Emit a profiling event for every PC newly covered by a corpus input (optional, default false).
+	// Requires profiling. Beware that this produces a large number of events.
+	LogNewPCs bool `json:"log_new_pcs"`
+	// Probability in [0, 1] with which fuzzers generate a new program instead of taking
+	// the next queued request, e.g. of a triage or smash job (optional, default 0).
+	GenerateProbability float64 `json:"generate_probability"`
+	// Seed schedule that decides which corpus programs fuzzers mutate (optional, default "signal"):
+	//	"signal":     proportionally to the signal of the program at the time it was saved;
+	//	"fast":       AFLFast FAST schedule, programs that hit rare signal are preferred;
+	//	"coe":        AFLFast COE schedule, programs that hit common signal are skipped;
+	//	"age":        newer programs are preferred, the priority halves every 1000 programs;
+	//	"fuzz-count": programs that were mutated less often are preferred.
+	// The current energy of each program is shown on the corpus page of the manager HTTP UI.
+	SeedSchedule string `json:"seed_schedule"`
+	// Mix of the requests produced by fuzzers (optional), e.g.:
+	//	"scheduling": {"mutate_rate": 0.9, "smash_mutations": 50, "adaptive": true}
+	// Unlike ablation, it only changes the proportions of the fuzzing modes.
+	Scheduling Scheduling `json:"scheduling"`
+	// Count newly seen comparison operand distances at each comparison site as feedback,
+	// like libFuzzer's value profile (optional, default false). It requires comparisons
+	// tracing in the kernel (KCOV_TRACE_CMP): fuzzers collect comparisons for a share
+	// of the mutated programs and save the programs that give new value profile signal
+	// to the corpus. The value profile signal is accounted separately from the coverage signal.
+	ValueProfile bool `json:"value_profile"`
+	// Run fuzzers in the deterministic mode (optional, default false).
+	// Each fuzzer gets its random seed from the manager and records every generated
+	// and mutated program together with its seed, so that the programs can be
+	// reproduced offline with syz-replay (see pkg/replay). The records are written
+	// to the replay subdirectory of the workdir.
+	Deterministic bool `json:"deterministic"`
+	// Seed the fuzzer seeds are derived from in the deterministic mode
+	// (optional, by default a random one is chosen and logged).
+	Seed int64 `json:"seed"`
+	// Distill the corpus instead of the default periodic corpus minimization (optional), e.g.:
+	//	"distill": {"enabled": true, "redundancy": 3, "budget": 20000}
+	// Unlike minimization, distillation prefers short and fast programs, keeps several
+	// programs for the rare signal and can bound the corpus size (see signal.Distill).
+	Distill Distill `json:"distill"`
+
 	// Experimental options.
 	Experimental Experimental
 
@@ -211,6 +264,39 @@ type Config struct {
 	Derived `json:"-"`
 }
 
+// Scheduling corresponds to pkg/fuzzer.SchedulingPolicy, zero (or unset) values stand for the defaults.
+// Fuzzing modes can be disabled entirely only via the ablation configuration,
+// so mutate_rate and hints_rate can't be set to 0.
+type Scheduling struct {
+	// Probability to mutate a corpus program instead of generating a new one
+	// when fuzzers have nothing queued (default 0.95, or 0.5 without coverage).
+	MutateRate *float64 `json:"mutate_rate,omitempty"`
+	// Number of mutations of each new corpus program (default 100).
+	SmashMutations int `json:"smash_mutations"`
+	// Maximum number of faults injected into each new corpus program (default 100).
+	FaultInjections int `json:"fault_injections"`
+	// Probability to run hints for a new corpus program (default 1).
+	HintsRate *float64 `json:"hints_rate,omitempty"`
+	// Probability to generate a program around a call sequence mined from the corpus
+	// instead of from scratch (default 0, n-grams are not used).
+	NgramRate float64 `json:"ngram_rate"`
+	// Continuously shift the budget towards the fuzzing modes (generation, mutation,
+	// smash, hints and n-gram generation) with the best new signal per execution rate.
+	Adaptive bool `json:"adaptive"`
+}
+
+// Distill corresponds to signal.DistillConfig, zero values stand for the defaults.
+type Distill struct {
+	Enabled bool `json:"enabled"`
+	// Number of programs kept for each rare signal element (default 2).
+	Redundancy int `json:"redundancy"`
+	// Signal elements covered by at most this many programs are rare (default 10).
+	RareLimit int `json:"rare_limit"`
+	// Maximum number of programs in the corpus after distillation (default 0, no limit).
+	// Programs kept for the value profile signal are not accounted.
+	Budget int `json:"budget"`
+}
+
 // These options are not guaranteed to be backward/forward compatible and
 // can be dropped at any moment.
 type Experimental struct {
@@ -224,7 +310,8 @@ type Subsystem struct {
 	Paths []string `json:"path"`
 }
 
-type covFilterCfg struct {
+// CovFilterCfg selects the kernel code the coverage filter keeps (see CovFilter).
+type CovFilterCfg struct {
 	Files     []string `json:"files,omitempty"`
 	Functions []string `json:"functions,omitempty"`
 	RawPCs    []string `json:"pcs,omitempty"`
@@ -190,6 +190,21 @@ func Complete(cfg *Config) error {
 			return err
 		}
 	}
+	if _, err := prog.ParseMutatorWeights(cfg.Ablation.MutatorWeights); err != nil {
+		return fmt.Errorf("bad ablation mutator_weights: %w", err)
+	}
+	if cfg.GenerateProbability < 0 || cfg.GenerateProbability > 1 {
+		return fmt.Errorf("generate_probability must be in [0, 1], got %v", cfg.GenerateProbability)
+	}
+	if cfg.LogNewPCs && !cfg.Profiling {
+		return fmt.Errorf("log_new_pcs requires profiling")
+	}
+	if err := cfg.Scheduling.validate(); err != nil {
+		return err
+	}
+	if cfg.Distill.Redundancy < 0 || cfg.Distill.RareLimit < 0 || cfg.Distill.Budget < 0 {
+		return fmt.Errorf("distill: redundancy, rare_limit and budget must not be negative")
+	}
 	cfg.initTimeouts()
 	return nil
 }
@@ -371,3 +386,21 @@ func MatchSyscall(name, pattern string) bool {
 	}
 	return false
 }
+
+func (sched *Scheduling) validate() error {
+	if rate := sched.MutateRate; rate != nil && (*rate <= 0 || *rate > 1) {
+		return fmt.Errorf("scheduling: mutate_rate must be in (0, 1], got %v"+
+			" (fuzzing modes can be disabled via ablation)", *rate)
+	}
+	if rate := sched.HintsRate; rate != nil && (*rate <= 0 || *rate > 1) {
+		return fmt.Errorf("scheduling: hints_rate must be in (0, 1], got %v"+
+			" (hints can be disabled via ablation)", *rate)
+	}
+	if sched.NgramRate < 0 || sched.NgramRate > 1 {
+		return fmt.Errorf("scheduling: ngram_rate must be in [0, 1], got %v", sched.NgramRate)
+	}
+	if sched.SmashMutations < 0 || sched.FaultInjections < 0 {
+		return fmt.Errorf("scheduling: smash_mutations and fault_injections must not be negative")
+	}
+	return nil
+}
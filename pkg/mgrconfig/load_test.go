@@ -0,0 +1,34 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package mgrconfig
+
+import (
+	"testing"
+
+	"github.com/google/syzkaller/pkg/config"
+)
+
+func TestSchedulingValidate(t *testing.T) {
+	tests := []struct {
+		config string
+		valid  bool
+	}{
+		{`{}`, true},
+		{`{"mutate_rate": 0.5, "hints_rate": 1, "ngram_rate": 0}`, true},
+		{`{"mutate_rate": 0}`, false},
+		{`{"hints_rate": 0}`, false},
+		{`{"mutate_rate": 1.5}`, false},
+		{`{"ngram_rate": -1}`, false},
+		{`{"smash_mutations": -1}`, false},
+	}
+	for _, test := range tests {
+		var sched Scheduling
+		if err := config.LoadData([]byte(test.config), &sched); err != nil {
+			t.Fatalf("%v: %v", test.config, err)
+		}
+		if err := sched.validate(); (err == nil) != test.valid {
+			t.Errorf("%v: got error %v, want valid=%v", test.config, err, test.valid)
+		}
+	}
+}
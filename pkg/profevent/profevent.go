@@ -0,0 +1,103 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// Package profevent implements the profiling event stream.
+// The stream is a JSON Lines file (one Event per line) written by syz-manager
+// into its workdir, events of fuzzers are forwarded to the manager on poll.
+// The format of the records is described in schema.json.
+// Analysis tools should read the stream with Reader rather than parse it by hand.
+package profevent
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Version of the record format. It's increased whenever a change of the format
+// may break existing readers (e.g. a field is renamed or changes its meaning),
+// adding new fields or new kinds does not increase the version.
+const Version = 1
+
+// FileName is the name of the event stream file in the manager workdir.
+const FileName = "profiling.jsonl"
+
+// SourceManager is the source of the events emitted by syz-manager itself,
+// events of fuzzers have the fuzzer name as the source.
+const SourceManager = "manager"
+
+type Kind string
+
+const (
+	// Counts of modes of operation and mutators, data is map[string]uint64.
+	KindCounts Kind = "counts"
+	// Time spent in modes of operation, data is map[string]time.Duration (in ns).
+	KindDurations Kind = "durations"
+	// All fuzzer stats (also sent to the manager), data is map[string]uint64.
+	KindFuzzerStats Kind = "fuzzer_stats"
+	// Current mutator weights, data is map[string]float64 keyed by mutator name.
+	KindMutatorWeights Kind = "mutator_weights"
+	// Per-mutator accounting, data is map[string]MutatorStats keyed by mutator name.
+	KindMutatorStats Kind = "mutator_stats"
+	// A PC that was newly covered by a corpus input, data is NewPC.
+	KindNewPC Kind = "new_pc"
+	// Aggregated manager stats, data is map[string]uint64.
+	KindManagerStats Kind = "manager_stats"
+)
+
+// AllKinds returns all known kinds of events.
+func AllKinds() []Kind {
+	return []Kind{KindCounts, KindDurations, KindFuzzerStats, KindMutatorWeights,
+		KindMutatorStats, KindNewPC, KindManagerStats}
+}
+
+type Event struct {
+	Version int             `json:"v"`
+	Time    time.Time       `json:"time"`
+	Source  string          `json:"source"`
+	Kind    Kind            `json:"kind"`
+	Data    json.RawMessage `json:"data"`
+}
+
+type MutatorStats struct {
+	// Applications of the mutator that changed the program or did nothing.
+	NSuccess    uint64        `json:"successes"`
+	NFails      uint64        `json:"fails"`
+	TimeSuccess time.Duration `json:"time_successes"`
+	TimeFails   time.Duration `json:"time_fails"`
+	// Executed programs the mutator was applied to, how many of them gave new signal
+	// and how many corpus inputs they resulted in.
+	Execs        uint64 `json:"execs"`
+	NewSignal    uint64 `json:"new_signal"`
+	CorpusInputs uint64 `json:"corpus_inputs"`
+}
+
+type NewPC struct {
+	// The lower 32 bits of the PC, as in the coverage reported by the executor.
+	PC            uint32 `json:"pc"`
+	Stat          string `json:"stat"`
+	RequesterStat string `json:"requester_stat"`
+}
+
+// New creates an event of the current version with data encoded as JSON.
+func New(source string, kind Kind, data interface{}) (Event, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, fmt.Errorf("failed to encode %v event: %w", kind, err)
+	}
+	return Event{
+		Version: Version,
+		Time:    time.Now(),
+		Source:  source,
+		Kind:    kind,
+		Data:    raw,
+	}, nil
+}
+
+// Decode decodes the event data into v.
+func (ev *Event) Decode(v interface{}) error {
+	if err := json.Unmarshal(ev.Data, v); err != nil {
+		return fmt.Errorf("failed to decode %v event: %w", ev.Kind, err)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package profevent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoundTrip(t *testing.T) {
+	file := filepath.Join(t.TempDir(), FileName)
+	w, closer, err := OpenFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := map[string]MutatorStats{"splice": {NSuccess: 1, TimeSuccess: time.Second, CorpusInputs: 2}}
+	assert.NoError(t, w.Emit(SourceManager, KindManagerStats, map[string]uint64{"exec total": 10}))
+	assert.NoError(t, w.Emit("vm-0", KindMutatorStats, stats))
+	assert.NoError(t, w.Emit("vm-0", KindNewPC, NewPC{PC: 0x81000000, Stat: "exec fuzz"}))
+	assert.NoError(t, closer.Close())
+
+	events, err := ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("got %v events, want 3", len(events))
+	}
+	assert.Equal(t, SourceManager, events[0].Source)
+	var counters map[string]uint64
+	assert.NoError(t, events[0].Decode(&counters))
+	assert.Equal(t, map[string]uint64{"exec total": 10}, counters)
+	var gotStats map[string]MutatorStats
+	assert.NoError(t, events[1].Decode(&gotStats))
+	assert.Equal(t, stats, gotStats)
+	var pc NewPC
+	assert.NoError(t, events[2].Decode(&pc))
+	assert.Equal(t, uint32(0x81000000), pc.PC)
+	for _, ev := range events {
+		assert.Equal(t, Version, ev.Version)
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	r := NewReader(strings.NewReader(`{"v":1,"kind":"counts","data":{}}` + "\n\n" +
+		`{"v":100,"kind":"counts","data":{}}` + "\n"))
+	_, err := r.Next()
+	assert.NoError(t, err)
+	_, err = r.Next()
+	assert.ErrorContains(t, err, "line 3: unsupported version 100")
+
+	r = NewReader(strings.NewReader("1700000000;manager;{}\n"))
+	_, err = r.Next()
+	assert.Error(t, err)
+
+	r = NewReader(strings.NewReader(""))
+	_, err = r.Next()
+	assert.True(t, errors.Is(err, io.EOF))
+}
+
+func TestBuffer(t *testing.T) {
+	b := NewBuffer(2)
+	for i := 0; i < 3; i++ {
+		b.Add(Event{Kind: KindCounts})
+	}
+	events, dropped := b.Drain()
+	assert.Len(t, events, 2)
+	assert.Equal(t, 1, dropped)
+	events, dropped = b.Drain()
+	assert.Len(t, events, 0)
+	assert.Equal(t, 0, dropped)
+}
+
+// TestSchema checks that schema.json is in sync with the Go definitions.
+func TestSchema(t *testing.T) {
+	data, err := os.ReadFile("schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema struct {
+		Properties struct {
+			Version struct {
+				Const int `json:"const"`
+			} `json:"v"`
+			Kind struct {
+				Enum []Kind `json:"enum"`
+			} `json:"kind"`
+		} `json:"properties"`
+		Definitions struct {
+			MutatorStats struct {
+				AdditionalProperties struct {
+					Required []string `json:"required"`
+				} `json:"additionalProperties"`
+			} `json:"mutator_stats"`
+		} `json:"definitions"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, Version, schema.Properties.Version.Const)
+	assert.ElementsMatch(t, AllKinds(), schema.Properties.Kind.Enum)
+	buf := new(bytes.Buffer)
+	assert.NoError(t, json.NewEncoder(buf).Encode(MutatorStats{}))
+	var fields map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &fields))
+	var names []string
+	for name := range fields {
+		names = append(names, name)
+	}
+	assert.ElementsMatch(t, names, schema.Definitions.MutatorStats.AdditionalProperties.Required)
+}
@@ -0,0 +1,146 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package profevent
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Writer appends events to a stream. It's safe for concurrent use.
+type Writer struct {
+	mu  sync.Mutex
+	w   io.Writer
+	enc *json.Encoder
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{
+		w:   w,
+		enc: json.NewEncoder(w),
+	}
+}
+
+// OpenFile opens the stream file for appending, creating it if necessary.
+func OpenFile(filename string) (*Writer, io.Closer, error) {
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open profiling event stream: %w", err)
+	}
+	return NewWriter(f), f, nil
+}
+
+func (w *Writer) Write(ev Event) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	// json.Encoder terminates each record with a new line.
+	return w.enc.Encode(ev)
+}
+
+// Emit creates an event and appends it to the stream.
+func (w *Writer) Emit(source string, kind Kind, data interface{}) error {
+	ev, err := New(source, kind, data)
+	if err != nil {
+		return err
+	}
+	return w.Write(ev)
+}
+
+// Reader reads events from a stream.
+type Reader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// maxLine is the maximum length of a single record.
+const maxLine = 64 << 20
+
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLine)
+	return &Reader{scanner: scanner}
+}
+
+// Next returns the next event in the stream, or io.EOF at the end of the stream.
+// Events of unknown kinds are returned as is, events of newer versions result in an error.
+func (r *Reader) Next() (*Event, error) {
+	for r.scanner.Scan() {
+		r.line++
+		data := r.scanner.Bytes()
+		if len(data) == 0 {
+			continue
+		}
+		ev := new(Event)
+		if err := json.Unmarshal(data, ev); err != nil {
+			return nil, fmt.Errorf("line %v: %w", r.line, err)
+		}
+		if ev.Version < 1 || ev.Version > Version {
+			return nil, fmt.Errorf("line %v: unsupported version %v (supported up to %v)",
+				r.line, ev.Version, Version)
+		}
+		return ev, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// ReadFile reads all events from the stream file.
+func ReadFile(filename string) ([]*Event, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var events []*Event
+	r := NewReader(f)
+	for {
+		ev, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return events, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", filename, err)
+		}
+		events = append(events, ev)
+	}
+}
+
+// Buffer accumulates events until they are drained (e.g. sent to the manager).
+// Once it holds max events, new events are dropped. It's safe for concurrent use.
+type Buffer struct {
+	mu      sync.Mutex
+	max     int
+	events  []Event
+	dropped int
+}
+
+func NewBuffer(max int) *Buffer {
+	return &Buffer{max: max}
+}
+
+func (b *Buffer) Add(ev Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.events) >= b.max {
+		b.dropped++
+		return
+	}
+	b.events = append(b.events, ev)
+}
+
+// Drain returns the accumulated events and the number of dropped events, and resets the buffer.
+func (b *Buffer) Drain() ([]Event, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	events, dropped := b.events, b.dropped
+	b.events, b.dropped = nil, 0
+	return events, dropped
+}
@@ -0,0 +1,250 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// Package replay implements recording and offline replay of the programs produced
+// by the fuzzer in the deterministic mode.
+//
+// In the deterministic mode every generated and mutated program is produced from its own seed,
+// and the fuzzer records the seed, the hash of the mutated (parent) program, the mutators that
+// were applied and everything else the prog side depends on (the corpus programs, the choice
+// table, the mutator weights and the ablation configuration). Replayer re-runs the prog side
+// with these inputs and checks that exactly the same programs are produced, no kernel is needed.
+// Programs produced from kernel feedback (hints) or for collide runs are not recorded.
+//
+// The records of each fuzzer are written by syz-manager as a JSON Lines file into
+// the replay subdirectory of its workdir.
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sync"
+
+	"github.com/google/syzkaller/pkg/hash"
+	"github.com/google/syzkaller/profiler"
+	"github.com/google/syzkaller/prog"
+)
+
+// Dir is the name of the directory in the manager workdir where the records are saved.
+const Dir = "replay"
+
+type Kind string
+
+const (
+	// The first record of a fuzzer, describes the fuzzer configuration.
+	KindConfig Kind = "config"
+	// A program was generated.
+	KindGenerate Kind = "generate"
+	// A program was mutated.
+	KindMutate Kind = "mutate"
+	// A new program was added to the corpus of the fuzzer.
+	KindCorpus Kind = "corpus"
+)
+
+type Record struct {
+	// Order of the record among the records of the fuzzer.
+	Seq  uint64 `json:"seq"`
+	Kind Kind   `json:"kind"`
+	// Seed of the random source the program was generated/mutated with.
+	Seed int64 `json:"seed,omitempty"`
+	// The requested number of calls of a generated program.
+	NCalls int `json:"ncalls,omitempty"`
+	// Hash of the mutated program.
+	Parent string `json:"parent,omitempty"`
+	// Number of corpus programs that were passed to the mutation.
+	Corpus int `json:"corpus,omitempty"`
+	// Number of corpus programs the choice table was built from.
+	ChoiceTable int `json:"choice_table,omitempty"`
+	// How many times each mutator was applied.
+	Mutators map[string]int `json:"mutators,omitempty"`
+	// Mutator weights, set only if they have changed since the previous record.
+	Weights map[string]float64 `json:"weights,omitempty"`
+	// Ablation configuration, set only if it has changed since the previous record.
+	Ablation *profiler.AblationConfiguration `json:"ablation,omitempty"`
+	// Hash of the produced program.
+	Hash string `json:"hash,omitempty"`
+	// The program added to the corpus.
+	Prog []byte `json:"prog,omitempty"`
+	// Set only for KindConfig records.
+	Config *Config `json:"config,omitempty"`
+}
+
+type Config struct {
+	OS            string   `json:"os"`
+	Arch          string   `json:"arch"`
+	Seed          int64    `json:"seed"`
+	EnabledCalls  []string `json:"enabled_calls"`
+	NoMutateCalls []string `json:"no_mutate_calls,omitempty"`
+}
+
+// Generate generates a program the same way in the fuzzer and during replay.
+func Generate(target *prog.Target, seed int64, ncalls int, ct *prog.ChoiceTable) *prog.Prog {
+	return target.Generate(rand.New(rand.NewSource(seed)), ncalls, ct)
+}
+
+// Mutate mutates a copy of the program the same way in the fuzzer and during replay.
+// The mutator analysis (see prog.MutateWithObserver) is collected only if analyze is set.
+func Mutate(p *prog.Prog, seed int64, ct *prog.ChoiceTable, noMutate map[int]bool, corpus []*prog.Prog,
+	weights prog.MutatorWeights, analyze bool) (*prog.Prog, map[prog.MutatorIndex]int,
+	map[prog.MutatorIndex]prog.MutatorAnalysis) {
+	newP := p.Clone()
+	rs := rand.New(rand.NewSource(seed))
+	if !analyze {
+		obs := newP.MutateWithMutators(rs, prog.RecommendedCalls, ct, noMutate, corpus, weights)
+		return newP, obs, nil
+	}
+	obs, analysis := newP.MutateWithObserver(rs, prog.RecommendedCalls, ct, noMutate, corpus, weights)
+	return newP, obs, analysis
+}
+
+// Canonical returns the program the way the replayer sees it after deserialization.
+// The in-memory representation of a program may differ from the deserialized one
+// (e.g. default conditional fields are omitted during serialization), and mutations
+// depend on it, so the fuzzer must mutate and splice only canonical programs.
+func Canonical(p *prog.Prog) *prog.Prog {
+	canonical, err := p.Target.Deserialize(p.Serialize(), prog.NonStrict)
+	if err != nil {
+		panic(fmt.Sprintf("failed to deserialize a serialized program: %v\n%s", err, p.Serialize()))
+	}
+	return canonical
+}
+
+func progHash(p *prog.Prog) string {
+	return hash.String(p.Serialize())
+}
+
+// Recorder accumulates the records of a fuzzer until they are drained.
+type Recorder struct {
+	mu       sync.Mutex
+	seq      uint64
+	records  []Record
+	weights  *prog.MutatorWeights
+	ablation *profiler.AblationConfiguration
+}
+
+func NewRecorder(cfg *Config) *Recorder {
+	r := &Recorder{}
+	r.add(Record{Kind: KindConfig, Config: cfg})
+	return r
+}
+
+// Generated records a program produced by Generate.
+func (r *Recorder) Generated(seed int64, ncalls, ctProgs int, p *prog.Prog) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.addProgLocked(Record{
+		Kind:        KindGenerate,
+		Seed:        seed,
+		NCalls:      ncalls,
+		ChoiceTable: ctProgs,
+		Hash:        progHash(p),
+	}, nil)
+}
+
+// Mutated records a program produced by Mutate.
+func (r *Recorder) Mutated(seed int64, parent *prog.Prog, corpus, ctProgs int, weights prog.MutatorWeights,
+	mutators map[prog.MutatorIndex]int, p *prog.Prog) {
+	names := make(map[string]int)
+	for idx, count := range mutators {
+		names[idx.String()] = count
+	}
+	rec := Record{
+		Kind:        KindMutate,
+		Seed:        seed,
+		Parent:      progHash(parent),
+		Corpus:      corpus,
+		ChoiceTable: ctProgs,
+		Mutators:    names,
+		Hash:        progHash(p),
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.addProgLocked(rec, &weights)
+}
+
+// AddedToCorpus records a program that was added to the corpus.
+// The programs must be recorded in the order they are added to the corpus.
+func (r *Recorder) AddedToCorpus(data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.add(Record{
+		Kind: KindCorpus,
+		Prog: data,
+		Hash: hash.String(data),
+	})
+}
+
+func (r *Recorder) addProgLocked(rec Record, weights *prog.MutatorWeights) {
+	if weights != nil && (r.weights == nil || *r.weights != *weights) {
+		r.weights = weights
+		rec.Weights = make(map[string]float64)
+		for idx, weight := range weights {
+			rec.Weights[prog.MutatorIndex(idx).String()] = weight
+		}
+	}
+	// The configuration is replaced as a whole on change, so comparing pointers is enough.
+	if ablation := profiler.Ablation(); ablation != r.ablation {
+		r.ablation = ablation
+		rec.Ablation = ablation
+	}
+	r.add(rec)
+}
+
+func (r *Recorder) add(rec Record) {
+	rec.Seq = r.seq
+	r.seq++
+	r.records = append(r.records, rec)
+}
+
+// Drain returns the records accumulated since the previous call.
+func (r *Recorder) Drain() []Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	records := r.records
+	r.records = nil
+	return records
+}
+
+// Writer writes records as JSON Lines.
+type Writer struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{enc: json.NewEncoder(w)}
+}
+
+func (w *Writer) Write(records []Record) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i := range records {
+		if err := w.enc.Encode(&records[i]); err != nil {
+			return fmt.Errorf("failed to write replay record: %w", err)
+		}
+	}
+	return nil
+}
+
+// ReadFile reads all records from a file written by Writer.
+func ReadFile(filename string) ([]Record, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var records []Record
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for dec.More() {
+		var rec Record
+		if err := dec.Decode(&rec); err != nil {
+			return nil, fmt.Errorf("%v: record #%v: %w", filename, len(records), err)
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
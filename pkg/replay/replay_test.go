@@ -0,0 +1,85 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package replay
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/syzkaller/pkg/testutil"
+	"github.com/google/syzkaller/profiler"
+	"github.com/google/syzkaller/prog"
+	_ "github.com/google/syzkaller/sys"
+	"github.com/google/syzkaller/sys/targets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplay(t *testing.T) {
+	defer profiler.SetAblation(*profiler.Ablation())
+	target, err := prog.GetTarget(targets.TestOS, targets.TestArch64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enabled := make(map[*prog.Syscall]bool)
+	var names []string
+	for _, call := range target.Syscalls {
+		enabled[call] = true
+		names = append(names, call.Name)
+	}
+	rnd := rand.New(testutil.RandSource(t))
+	recorder := NewRecorder(&Config{OS: target.OS, Arch: target.Arch, EnabledCalls: names})
+	ct := target.BuildChoiceTable(nil, enabled)
+	ctProgs := 0
+	var corpus []*prog.Prog
+	for i := 0; i < 100; i++ {
+		if len(corpus) == 0 || rnd.Intn(3) == 0 {
+			seed := rnd.Int63()
+			p := Generate(target, seed, prog.RecommendedCalls, ct)
+			recorder.Generated(seed, prog.RecommendedCalls, ctProgs, p)
+			p = Canonical(p)
+			corpus = append(corpus, p)
+			recorder.AddedToCorpus(p.Serialize())
+			continue
+		}
+		if i == 50 {
+			profiler.SetAblation(profiler.AblationConfiguration{DisableMutatorSplice: true})
+			ct = target.BuildChoiceTable(corpus, enabled)
+			ctProgs = len(corpus)
+		}
+		weights := prog.DefaultMutatorWeights
+		weights[prog.MutatorIndexRemoveCall] = float64(i)
+		seed := rnd.Int63()
+		parent := corpus[rnd.Intn(len(corpus))]
+		p, obs, _ := Mutate(parent, seed, ct, nil, corpus, weights, false)
+		recorder.Mutated(seed, parent, len(corpus), ctProgs, weights, obs, p)
+	}
+	file := filepath.Join(t.TempDir(), "replay.jsonl")
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, NewWriter(f).Write(recorder.Drain()))
+	f.Close()
+	records, err := ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, recorder.Drain())
+
+	replayed := 0
+	assert.NoError(t, Replay(records, func(rec *Record, p *prog.Prog) {
+		replayed++
+	}))
+	assert.Equal(t, 100, replayed)
+
+	// A single mutation may produce the same program with a different seed, but not all of them.
+	for i := range records {
+		if records[i].Kind == KindMutate {
+			records[i].Seed++
+		}
+	}
+	assert.Error(t, Replay(records, nil))
+}
@@ -0,0 +1,160 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package replay
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/google/syzkaller/profiler"
+	"github.com/google/syzkaller/prog"
+)
+
+type replayer struct {
+	target   *prog.Target
+	enabled  map[*prog.Syscall]bool
+	noMutate map[int]bool
+	corpus   []*prog.Prog
+	byHash   map[string]*prog.Prog
+	weights  prog.MutatorWeights
+	ct       *prog.ChoiceTable
+	ctProgs  int
+}
+
+// Replay re-runs the generation and mutation of the programs described by the records
+// of a single fuzzer and checks that the same programs are produced.
+// If cb is not nil, it's invoked for every replayed program.
+// Replay changes the global ablation configuration (see profiler.SetAblation).
+func Replay(records []Record, cb func(rec *Record, p *prog.Prog)) error {
+	records = append([]Record{}, records...)
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Seq < records[j].Seq
+	})
+	if len(records) == 0 || records[0].Kind != KindConfig || records[0].Config == nil {
+		return fmt.Errorf("the records don't start with a config record")
+	}
+	r, err := newReplayer(records[0].Config)
+	if err != nil {
+		return err
+	}
+	// The records of the corpus programs may come later than the records of the programs
+	// that already used them, so first load the whole corpus.
+	for _, rec := range records {
+		if rec.Kind != KindCorpus {
+			continue
+		}
+		p, err := r.target.Deserialize(rec.Prog, prog.NonStrict)
+		if err != nil {
+			return fmt.Errorf("record #%v: failed to deserialize corpus program: %w", rec.Seq, err)
+		}
+		r.corpus = append(r.corpus, p)
+		r.byHash[rec.Hash] = p
+	}
+	profiler.SetAblation(profiler.AblationConfiguration{})
+	for i := range records {
+		rec := &records[i]
+		if rec.Kind != KindGenerate && rec.Kind != KindMutate {
+			continue
+		}
+		p, err := r.replay(rec)
+		if err != nil {
+			return fmt.Errorf("record #%v: %w", rec.Seq, err)
+		}
+		if cb != nil {
+			cb(rec, p)
+		}
+	}
+	return nil
+}
+
+func newReplayer(cfg *Config) (*replayer, error) {
+	target, err := prog.GetTarget(cfg.OS, cfg.Arch)
+	if err != nil {
+		return nil, err
+	}
+	r := &replayer{
+		target:   target,
+		enabled:  make(map[*prog.Syscall]bool),
+		noMutate: make(map[int]bool),
+		byHash:   make(map[string]*prog.Prog),
+		weights:  prog.DefaultMutatorWeights,
+		ctProgs:  -1,
+	}
+	for _, name := range cfg.EnabledCalls {
+		call := target.SyscallMap[name]
+		if call == nil {
+			return nil, fmt.Errorf("unknown enabled syscall %v", name)
+		}
+		r.enabled[call] = true
+	}
+	for _, name := range cfg.NoMutateCalls {
+		call := target.SyscallMap[name]
+		if call == nil {
+			return nil, fmt.Errorf("unknown no-mutate syscall %v", name)
+		}
+		r.noMutate[call.ID] = true
+	}
+	return r, nil
+}
+
+func (r *replayer) replay(rec *Record) (*prog.Prog, error) {
+	if rec.Weights != nil {
+		weights, err := prog.ParseMutatorWeights(rec.Weights)
+		if err != nil {
+			return nil, err
+		}
+		r.weights = weights
+	}
+	if rec.Ablation != nil {
+		profiler.SetAblation(*rec.Ablation)
+	}
+	if err := r.updateChoiceTable(rec.ChoiceTable); err != nil {
+		return nil, err
+	}
+	var p *prog.Prog
+	switch rec.Kind {
+	case KindGenerate:
+		p = Generate(r.target, rec.Seed, rec.NCalls, r.ct)
+	case KindMutate:
+		parent := r.byHash[rec.Parent]
+		if parent == nil {
+			return nil, fmt.Errorf("unknown parent program %v", rec.Parent)
+		}
+		if rec.Corpus > len(r.corpus) {
+			return nil, fmt.Errorf("the mutation used %v corpus programs, but only %v were recorded",
+				rec.Corpus, len(r.corpus))
+		}
+		var obs map[prog.MutatorIndex]int
+		p, obs, _ = Mutate(parent, rec.Seed, r.ct, r.noMutate, r.corpus[:rec.Corpus], r.weights, false)
+		mutators := make(map[string]int)
+		for idx, count := range obs {
+			mutators[idx.String()] = count
+		}
+		if !reflect.DeepEqual(mutators, rec.Mutators) && (len(mutators) != 0 || len(rec.Mutators) != 0) {
+			return nil, fmt.Errorf("applied mutators %v, recorded %v", mutators, rec.Mutators)
+		}
+	}
+	if got := progHash(p); got != rec.Hash {
+		return nil, fmt.Errorf("produced program %v, recorded %v:\n%s", got, rec.Hash, p.Serialize())
+	}
+	return p, nil
+}
+
+func (r *replayer) updateChoiceTable(ctProgs int) error {
+	if ctProgs == r.ctProgs {
+		return nil
+	}
+	if ctProgs > len(r.corpus) {
+		return fmt.Errorf("the choice table was built from %v corpus programs, but only %v were recorded",
+			ctProgs, len(r.corpus))
+	}
+	var progs []*prog.Prog
+	if ctProgs != 0 {
+		progs = r.corpus[:ctProgs]
+	}
+	r.ct = r.target.BuildChoiceTable(progs, r.enabled)
+	r.ctProgs = ctProgs
+	return nil
+}
@@ -46,7 +46,7 @@ func (serv *RPCServer) Serve() {
 			continue
 		}
 		setupKeepAlive(conn, time.Minute)
-		go serv.s.ServeConn(newFlateConn(newCountedConn(serv, conn)))
+		go serv.s.ServeConn(newFlateConn(newCountedConn(&serv.TotalBytes, conn)))
 	}
 }
 
@@ -166,25 +166,25 @@ func (fc *flateConn) Close() error {
 // countedConn wraps net.Conn to record the transferred bytes.
 type countedConn struct {
 	io.ReadWriteCloser
-	server *RPCServer
+	total *atomic.Uint64
 }
 
-func newCountedConn(server *RPCServer,
+func newCountedConn(total *atomic.Uint64,
 	conn io.ReadWriteCloser) io.ReadWriteCloser {
 	return &countedConn{
 		ReadWriteCloser: conn,
-		server:          server,
+		total:           total,
 	}
 }
 
 func (cc countedConn) Read(p []byte) (n int, err error) {
 	n, err = cc.ReadWriteCloser.Read(p)
-	cc.server.TotalBytes.Add(uint64(n))
+	cc.total.Add(uint64(n))
 	return
 }
 
 func (cc countedConn) Write(b []byte) (n int, err error) {
 	n, err = cc.ReadWriteCloser.Write(b)
-	cc.server.TotalBytes.Add(uint64(n))
+	cc.total.Add(uint64(n))
 	return
 }
@@ -1,16 +1,22 @@
 // Copyright 2015 syzkaller project authors. All rights reserved.
 // Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
 
-// Package rpctype contains types of message passed via net/rpc connections
+// Package rpctype contains types of message passed via net/rpc and stream connections
 // between various parts of the system.
 package rpctype
 
 import (
 	"math"
+	"time"
 
 	"github.com/google/syzkaller/pkg/host"
 	"github.com/google/syzkaller/pkg/ipc"
+	"github.com/google/syzkaller/pkg/mgrconfig"
+	"github.com/google/syzkaller/pkg/profevent"
+	"github.com/google/syzkaller/pkg/replay"
 	"github.com/google/syzkaller/pkg/signal"
+	"github.com/google/syzkaller/profiler"
+	"github.com/google/syzkaller/prog"
 )
 
 type Input struct {
@@ -19,12 +25,21 @@ type Input struct {
 	Signal   signal.Serial
 	Cover    []uint32
 	RawCover []uint32
+	// Lineage of the program (see corpus.Lineage).
+	Parent   string
+	Mutators []string
+	// Value profile signal (see signal.ValueProfile).
+	ValueProfile signal.Serial
+	// How long the program took to execute during triage (zero if unknown).
+	ExecTime time.Duration
 }
 
 type Candidate struct {
 	Prog      []byte
 	Minimized bool
 	Smashed   bool
+	// The program was in the corpus with value profile signal (see signal.ValueProfile).
+	ValueProfile bool
 }
 
 type ExecTask struct {
@@ -39,15 +54,28 @@ type ConnectArgs struct {
 }
 
 type ConnectRes struct {
-	EnabledCalls      []int
-	NoMutateCalls     map[int]bool
-	GitRevision       string
-	TargetRevision    string
-	AllSandboxes      bool
-	CheckResult       *CheckArgs
-	MemoryLeakFrames  []string
-	DataRaceFrames    []string
-	CoverFilterBitmap []byte
+	EnabledCalls        []int
+	NoMutateCalls       map[int]bool
+	GitRevision         string
+	TargetRevision      string
+	AllSandboxes        bool
+	CheckResult         *CheckArgs
+	MemoryLeakFrames    []string
+	DataRaceFrames      []string
+	CoverFilterBitmap   []byte
+	CoverFilterEpoch    int
+	Ablation            profiler.AblationConfiguration
+	Profiling           bool
+	LogNewPCs           bool
+	GenerateProbability float64
+	SeedSchedule        string
+	Scheduling          mgrconfig.Scheduling
+	ValueProfile        bool
+	// Learned call-to-call priorities used as the prior for the choice table (may be nil).
+	Prios *prog.CompactPrioMatrix
+	// If set, the fuzzer uses Seed for all randomness and records its programs for replay.
+	Deterministic bool
+	Seed          int64
 }
 
 type CheckArgs struct {
@@ -74,12 +102,53 @@ type PollArgs struct {
 	NeedCandidates bool
 	MaxSignal      signal.Serial
 	Stats          map[string]uint64
+	// Profiling events emitted since the last poll (only if profiling is enabled).
+	ProfilingEvents []profevent.Event
+	// Programs recorded since the last poll (only in the deterministic mode).
+	ReplayRecords []replay.Record
+	// Seed scheduler energies of the corpus programs by their sigs (sent only periodically).
+	SeedEnergy map[string]float64
+	// Changes of the fuzzing history of the corpus programs by their sigs (sent only periodically).
+	ProgMeta map[string]ProgMeta
+	// The shares of the mutators in the adapted mutator weights (only if they are adaptive).
+	MutatorWeights map[string]float64
+}
+
+// ProgMeta is a change of the fuzzing history of a corpus program (see corpus.ItemMeta).
+type ProgMeta struct {
+	// How many times the program was mutated.
+	Mutated uint64
+	// How many mutants of the program have given new signal, by the applied mutators.
+	Mutators map[string]uint64
 }
 
 type PollRes struct {
 	Candidates []Candidate
 	NewInputs  []Input
 	MaxSignal  signal.Serial
+	// Set only if the ablation configuration has changed since the last poll.
+	Ablation *profiler.AblationConfiguration
+	// Set only if the coverage filter has changed since the last poll.
+	CoverFilter *CoverFilterUpdate
+}
+
+// PushArgs is what the manager pushes to fuzzers between polls.
+type PushArgs struct {
+	Candidates []Candidate
+	NewInputs  []Input
+	MaxSignal  signal.Serial
+	// Set only if the ablation configuration has changed since it was last sent.
+	Ablation *profiler.AblationConfiguration
+	// Set only if the coverage filter has changed since it was last sent.
+	CoverFilter *CoverFilterUpdate
+}
+
+// CoverFilterUpdate replaces the coverage filter the fuzzer got in ConnectRes.
+type CoverFilterUpdate struct {
+	// Epochs only grow, the fuzzer ignores updates older than the filter it uses.
+	Epoch int
+	// The bitmap in the ConnectRes.CoverFilterBitmap format, nil disables filtering.
+	Bitmap []byte
 }
 
 type RunnerConnectArgs struct {
@@ -159,6 +228,10 @@ type HubSyncArgs struct {
 	Del []string
 	// Repros found since last sync.
 	Repros [][]byte
+	// Call-to-call priorities learned by the manager (sent only periodically).
+	Prios *prog.PrioMatrix
+	// Manager requests the priorities learned by other managers.
+	NeedPrios bool
 }
 
 type HubSyncRes struct {
@@ -171,6 +244,8 @@ type HubSyncRes struct {
 	// Number of remaining pending programs,
 	// if >0 manager should do sync again.
 	More int
+	// Merged call-to-call priorities of other managers (if NeedPrios was set).
+	Prios *prog.PrioMatrix
 }
 
 type HubInput struct {
@@ -0,0 +1,737 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package rpctype
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/syzkaller/pkg/log"
+)
+
+// The streaming transport carries calls in both directions and one-way pushes over a single
+// connection, so that the manager can send updates to fuzzers as they happen instead of
+// waiting for the next poll. Every message is a frame:
+//
+//	| length uint32 | kind uint8 | flags uint8 | seq uint64 | payload |
+//
+// The payload is a streamMsg header followed by the arguments or the reply (if there is no error).
+// Each direction of the connection is a single gob stream, so type descriptors are sent only once.
+// The payload is compressed with flate if the peers agreed on it and the payload is large enough.
+// The peers negotiate the protocol version and the compression in a handshake before exchanging
+// any other frames. Pushes are flow controlled with credits: the sender may have at most
+// streamWindow pushes the receiver has not handled yet. Calls are served concurrently,
+// but at most streamMaxCalls at a time, further calls wait until one of them finishes.
+// Methods are exported methods of registered receivers as in net/rpc:
+//
+//	func (t *T) Method(args *A, reply *R) error
+//	func (t *T) Method(conn *StreamConn, args *A, reply *R) error
+//
+// The second form gives the method the connection, e.g. to push messages to the peer later.
+const (
+	StreamVersion = 1
+	// The oldest version the peer may talk.
+	streamMinVersion  = 1
+	streamMagic       = "syz-stream"
+	streamCompression = "flate"
+	streamWindow      = 64
+	streamMaxCalls    = 64
+	streamMaxFrame    = 256 << 20
+	streamCompressMin = 512
+	frameHeaderSize   = 14
+)
+
+const (
+	frameHello uint8 = iota + 1
+	frameWelcome
+	frameCall
+	frameReply
+	framePush
+	frameCredit
+)
+
+const frameCompressed uint8 = 1 << 0
+
+var ErrStreamClosed = errors.New("stream connection is closed")
+
+type streamHello struct {
+	Magic       string
+	MinVersion  int
+	MaxVersion  int
+	Compression []string
+}
+
+type streamWelcome struct {
+	Version     int
+	Compression string
+	Error       string
+}
+
+type streamMsg struct {
+	Method string
+	Error  string
+}
+
+// streamCall is an outgoing call waiting for the reply.
+type streamCall struct {
+	reply reflect.Value // the reply is decoded into it, invalid if the caller does not need it
+	err   error
+	done  chan struct{}
+}
+
+// streamRequest is an incoming call or push.
+type streamRequest struct {
+	name   string
+	method *streamMethod // nil if there is no such method
+	args   reflect.Value
+}
+
+type streamMethod struct {
+	rcvr      reflect.Value
+	fn        reflect.Value
+	withConn  bool
+	argType   reflect.Type
+	replyType reflect.Type
+}
+
+// StreamConn is one end of a stream connection.
+type StreamConn struct {
+	rw          io.ReadWriteCloser
+	r           *bufio.Reader
+	methods     map[string]*streamMethod
+	version     int
+	compress    bool
+	callTimeout time.Duration
+
+	// Only readLoop (or the handshake before it starts) reads frames, so dec needs no lock.
+	rbuf bytes.Buffer
+	dec  *gob.Decoder
+
+	wmu  sync.Mutex // serializes frame writes, protects wbuf and enc
+	wbuf bytes.Buffer
+	enc  *gob.Encoder
+
+	mu      sync.Mutex
+	seq     uint64
+	pending map[uint64]*streamCall
+	err     error
+
+	done      chan struct{}
+	closeOnce sync.Once
+	credits   chan struct{}
+	pushes    chan *streamRequest
+	calls     chan struct{}
+}
+
+// StreamServer accepts stream connections and serves the methods of the receiver on them.
+type StreamServer struct {
+	ln         net.Listener
+	methods    map[string]*streamMethod
+	TotalBytes atomic.Uint64
+}
+
+func NewStreamServer(addr, name string, receiver interface{}) (*StreamServer, error) {
+	methods, err := streamMethods(name, receiver)
+	if err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %v: %w", addr, err)
+	}
+	serv := &StreamServer{
+		ln:      ln,
+		methods: methods,
+	}
+	return serv, nil
+}
+
+func (serv *StreamServer) Serve() {
+	for {
+		conn, err := serv.ln.Accept()
+		if err != nil {
+			log.Logf(0, "failed to accept a stream connection: %v", err)
+			continue
+		}
+		setupKeepAlive(conn, time.Minute)
+		go func() {
+			// Don't let a silent peer hang in the handshake.
+			conn.SetDeadline(time.Now().Add(time.Minute))
+			_, err := acceptStream(newCountedConn(&serv.TotalBytes, conn), serv.methods, 3*time.Minute)
+			if err != nil {
+				log.Logf(0, "stream handshake with %v failed: %v", conn.RemoteAddr(), err)
+				return
+			}
+			conn.SetDeadline(time.Time{})
+		}()
+	}
+}
+
+func (serv *StreamServer) Addr() net.Addr {
+	return serv.ln.Addr()
+}
+
+// DialStream connects to a stream server, the peer may call and push to the methods of the receiver.
+func DialStream(addr string, timeScale time.Duration, name string, receiver interface{}) (*StreamConn, error) {
+	methods, err := streamMethods(name, receiver)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := Dial(addr, timeScale)
+	if err != nil {
+		return nil, err
+	}
+	// Note: SetDeadline is not implemented on fuchsia, so don't fail on error.
+	conn.SetDeadline(time.Now().Add(3 * time.Minute * timeScale))
+	sc, err := connectStream(conn, methods, 3*time.Minute*timeScale,
+		streamMinVersion, StreamVersion, []string{streamCompression})
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return sc, nil
+}
+
+// StreamLoopback connects a server and a client receivers in memory.
+// It's meant for tests of the code that talks over stream connections.
+func StreamLoopback(serverName string, server interface{}, clientName string, client interface{}) (
+	serverConn, clientConn *StreamConn, err error) {
+	serverMethods, err := streamMethods(serverName, server)
+	if err != nil {
+		return nil, nil, err
+	}
+	clientMethods, err := streamMethods(clientName, client)
+	if err != nil {
+		return nil, nil, err
+	}
+	c0, c1 := net.Pipe()
+	errc := make(chan error, 1)
+	go func() {
+		var err error
+		serverConn, err = acceptStream(c0, serverMethods, 0)
+		errc <- err
+	}()
+	clientConn, err = connectStream(c1, clientMethods, 0, streamMinVersion, StreamVersion, []string{streamCompression})
+	if serverErr := <-errc; err == nil {
+		err = serverErr
+	}
+	if err != nil {
+		c0.Close()
+		c1.Close()
+		return nil, nil, err
+	}
+	return serverConn, clientConn, nil
+}
+
+func streamMethods(name string, receiver interface{}) (map[string]*streamMethod, error) {
+	methods := make(map[string]*streamMethod)
+	if receiver == nil {
+		return methods, nil
+	}
+	errorType := reflect.TypeOf((*error)(nil)).Elem()
+	connType := reflect.TypeOf((*StreamConn)(nil))
+	rcvr := reflect.ValueOf(receiver)
+	typ := rcvr.Type()
+	for i := 0; i < typ.NumMethod(); i++ {
+		method := typ.Method(i)
+		mtyp := method.Type
+		// The receiver is the first argument.
+		first := 1
+		withConn := mtyp.NumIn() == 4 && mtyp.In(1) == connType
+		if withConn {
+			first++
+		}
+		if mtyp.NumIn() != first+2 || mtyp.NumOut() != 1 || mtyp.Out(0) != errorType ||
+			mtyp.In(first).Kind() != reflect.Ptr || mtyp.In(first+1).Kind() != reflect.Ptr {
+			continue
+		}
+		methods[name+"."+method.Name] = &streamMethod{
+			rcvr:      rcvr,
+			fn:        method.Func,
+			withConn:  withConn,
+			argType:   mtyp.In(first).Elem(),
+			replyType: mtyp.In(first + 1).Elem(),
+		}
+	}
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("%v has no suitable methods", name)
+	}
+	return methods, nil
+}
+
+func newStreamConn(rw io.ReadWriteCloser, methods map[string]*streamMethod, callTimeout time.Duration) *StreamConn {
+	sc := &StreamConn{
+		rw:          rw,
+		r:           bufio.NewReader(rw),
+		methods:     methods,
+		callTimeout: callTimeout,
+		pending:     make(map[uint64]*streamCall),
+		done:        make(chan struct{}),
+		credits:     make(chan struct{}, streamWindow),
+		pushes:      make(chan *streamRequest, streamWindow),
+		calls:       make(chan struct{}, streamMaxCalls),
+	}
+	sc.dec = gob.NewDecoder(&sc.rbuf)
+	sc.enc = gob.NewEncoder(&sc.wbuf)
+	for i := 0; i < streamWindow; i++ {
+		sc.credits <- struct{}{}
+	}
+	return sc
+}
+
+func connectStream(rw io.ReadWriteCloser, methods map[string]*streamMethod, callTimeout time.Duration,
+	minVersion, maxVersion int, compression []string) (*StreamConn, error) {
+	sc := newStreamConn(rw, methods, callTimeout)
+	hello := &streamHello{
+		Magic:       streamMagic,
+		MinVersion:  minVersion,
+		MaxVersion:  maxVersion,
+		Compression: compression,
+	}
+	welcome := new(streamWelcome)
+	err := sc.writeFrame(frameHello, 0, hello, nil)
+	if err == nil {
+		err = sc.readHandshake(frameWelcome, welcome)
+	}
+	if err == nil && welcome.Error != "" {
+		err = errors.New(welcome.Error)
+	}
+	if err != nil {
+		rw.Close()
+		return nil, fmt.Errorf("stream handshake failed: %w", err)
+	}
+	sc.version = welcome.Version
+	sc.compress = welcome.Compression == streamCompression
+	sc.start()
+	return sc, nil
+}
+
+func acceptStream(rw io.ReadWriteCloser, methods map[string]*streamMethod,
+	callTimeout time.Duration) (*StreamConn, error) {
+	sc := newStreamConn(rw, methods, callTimeout)
+	hello := new(streamHello)
+	if err := sc.readHandshake(frameHello, hello); err != nil {
+		rw.Close()
+		return nil, err
+	}
+	welcome := negotiateStream(hello)
+	err := sc.writeFrame(frameWelcome, 0, welcome, nil)
+	if err == nil && welcome.Error != "" {
+		err = errors.New(welcome.Error)
+	}
+	if err != nil {
+		rw.Close()
+		return nil, err
+	}
+	sc.version = welcome.Version
+	sc.compress = welcome.Compression == streamCompression
+	sc.start()
+	return sc, nil
+}
+
+func negotiateStream(hello *streamHello) *streamWelcome {
+	if hello.Magic != streamMagic {
+		return &streamWelcome{Error: fmt.Sprintf("bad stream magic %q", hello.Magic)}
+	}
+	version := StreamVersion
+	if hello.MaxVersion < version {
+		version = hello.MaxVersion
+	}
+	if version < hello.MinVersion || version < streamMinVersion {
+		return &streamWelcome{Error: fmt.Sprintf("unsupported stream version: peer speaks %v-%v, we speak %v-%v",
+			hello.MinVersion, hello.MaxVersion, streamMinVersion, StreamVersion)}
+	}
+	welcome := &streamWelcome{Version: version}
+	for _, c := range hello.Compression {
+		if c == streamCompression {
+			welcome.Compression = c
+		}
+	}
+	return welcome
+}
+
+// Version returns the negotiated protocol version.
+func (sc *StreamConn) Version() int {
+	return sc.version
+}
+
+// Done is closed when the connection is closed.
+func (sc *StreamConn) Done() <-chan struct{} {
+	return sc.done
+}
+
+// Call invokes the method of the peer and waits for the reply, reply may be nil.
+func (sc *StreamConn) Call(method string, args, reply interface{}) error {
+	call := &streamCall{done: make(chan struct{})}
+	if reply != nil {
+		// Decode into a fresh value, so that a late reply does not race with the caller after a timeout.
+		call.reply = reflect.New(reflect.TypeOf(reply).Elem())
+	}
+	sc.mu.Lock()
+	if sc.err != nil {
+		sc.mu.Unlock()
+		return sc.err
+	}
+	sc.seq++
+	seq := sc.seq
+	sc.pending[seq] = call
+	sc.mu.Unlock()
+	defer func() {
+		sc.mu.Lock()
+		delete(sc.pending, seq)
+		sc.mu.Unlock()
+	}()
+	if err := sc.writeFrame(frameCall, seq, &streamMsg{Method: method}, args); err != nil {
+		return err
+	}
+	var timeout <-chan time.Time
+	if sc.callTimeout != 0 {
+		timer := time.NewTimer(sc.callTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-call.done:
+		if call.err != nil {
+			return call.err
+		}
+		if reply != nil {
+			reflect.ValueOf(reply).Elem().Set(call.reply.Elem())
+		}
+		return nil
+	case <-sc.done:
+		return sc.closeErr()
+	case <-timeout:
+		return fmt.Errorf("%v: timed out after %v", method, sc.callTimeout)
+	}
+}
+
+// Push sends a one-way message to the method of the peer. The peer handles pushes one by one
+// in the order they were sent, Push blocks while the peer is streamWindow pushes behind.
+func (sc *StreamConn) Push(method string, args interface{}) error {
+	select {
+	case <-sc.credits:
+	case <-sc.done:
+		return sc.closeErr()
+	}
+	return sc.writeFrame(framePush, 0, &streamMsg{Method: method}, args)
+}
+
+func (sc *StreamConn) Close() error {
+	sc.closeWithError(ErrStreamClosed)
+	return nil
+}
+
+func (sc *StreamConn) closeWithError(err error) {
+	sc.closeOnce.Do(func() {
+		sc.mu.Lock()
+		sc.err = err
+		sc.mu.Unlock()
+		close(sc.done)
+		sc.rw.Close()
+	})
+}
+
+func (sc *StreamConn) closeErr() error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.err
+}
+
+func (sc *StreamConn) start() {
+	go sc.readLoop()
+	go sc.pushLoop()
+}
+
+func (sc *StreamConn) readLoop() {
+	for {
+		err := sc.handleFrame()
+		if err == nil {
+			continue
+		}
+		if err == io.EOF || errors.Is(err, net.ErrClosed) || errors.Is(err, io.ErrClosedPipe) {
+			err = ErrStreamClosed
+		}
+		sc.closeWithError(err)
+		return
+	}
+}
+
+func (sc *StreamConn) handleFrame() error {
+	kind, seq, err := sc.readFrame()
+	if err != nil {
+		return err
+	}
+	if kind == frameCredit {
+		for i := uint64(0); i < seq; i++ {
+			select {
+			case sc.credits <- struct{}{}:
+			default:
+				return errors.New("stream peer returned too many credits")
+			}
+		}
+		return nil
+	}
+	msg := new(streamMsg)
+	if err := sc.decode(msg); err != nil {
+		return err
+	}
+	switch kind {
+	case frameCall:
+		req, err := sc.readRequest(msg)
+		if err != nil {
+			return err
+		}
+		select {
+		case sc.calls <- struct{}{}:
+		case <-sc.done:
+			return sc.closeErr()
+		}
+		go sc.serveCall(seq, req)
+	case frameReply:
+		sc.mu.Lock()
+		call := sc.pending[seq]
+		delete(sc.pending, seq)
+		sc.mu.Unlock()
+		if err := sc.readReply(call, msg); err != nil {
+			return err
+		}
+	case framePush:
+		req, err := sc.readRequest(msg)
+		if err != nil {
+			return err
+		}
+		select {
+		case sc.pushes <- req:
+		default:
+			return errors.New("stream peer exceeded the push window")
+		}
+	default:
+		return fmt.Errorf("unexpected stream frame kind %v", kind)
+	}
+	if sc.rbuf.Len() != 0 {
+		return fmt.Errorf("%v trailing bytes in stream frame", sc.rbuf.Len())
+	}
+	return nil
+}
+
+func (sc *StreamConn) readRequest(msg *streamMsg) (*streamRequest, error) {
+	req := &streamRequest{
+		name:   msg.Method,
+		method: sc.methods[msg.Method],
+	}
+	var args interface{}
+	if req.method != nil {
+		req.args = reflect.New(req.method.argType)
+		args = req.args.Interface()
+	}
+	// The arguments of unknown methods are still decoded (and discarded) to keep the gob stream in sync.
+	if err := sc.decode(args); err != nil {
+		return nil, fmt.Errorf("failed to decode %v arguments: %w", msg.Method, err)
+	}
+	return req, nil
+}
+
+func (sc *StreamConn) readReply(call *streamCall, msg *streamMsg) error {
+	if msg.Error == "" {
+		// The call may have already timed out, but the reply still needs to be decoded.
+		var reply interface{}
+		if call != nil && call.reply.IsValid() {
+			reply = call.reply.Interface()
+		}
+		if err := sc.decode(reply); err != nil {
+			return fmt.Errorf("failed to decode %v reply: %w", msg.Method, err)
+		}
+	} else if call != nil {
+		call.err = errors.New(msg.Error)
+	}
+	if call != nil {
+		close(call.done)
+	}
+	return nil
+}
+
+func (sc *StreamConn) serveCall(seq uint64, req *streamRequest) {
+	defer func() { <-sc.calls }()
+	msg := &streamMsg{Method: req.name}
+	var body interface{}
+	reply, err := sc.serve(req)
+	if err != nil {
+		msg.Error = err.Error()
+	} else {
+		body = reply.Interface()
+	}
+	sc.writeFrame(frameReply, seq, msg, body)
+}
+
+// pushLoop handles the pushes of the peer and returns the credits for them.
+func (sc *StreamConn) pushLoop() {
+	handled := uint64(0)
+	for {
+		select {
+		case req := <-sc.pushes:
+			if _, err := sc.serve(req); err != nil {
+				log.Logf(0, "failed to handle %v push: %v", req.name, err)
+			}
+			handled++
+		case <-sc.done:
+			return
+		}
+		// Return the credits in batches, but don't hold them when the queue is empty.
+		if handled >= streamWindow/4 || len(sc.pushes) == 0 {
+			if sc.writeFrame(frameCredit, handled, nil, nil) != nil {
+				return
+			}
+			handled = 0
+		}
+	}
+}
+
+func (sc *StreamConn) serve(req *streamRequest) (reflect.Value, error) {
+	m := req.method
+	if m == nil {
+		return reflect.Value{}, fmt.Errorf("unknown method %v", req.name)
+	}
+	reply := reflect.New(m.replyType)
+	in := []reflect.Value{m.rcvr}
+	if m.withConn {
+		in = append(in, reflect.ValueOf(sc))
+	}
+	in = append(in, req.args, reply)
+	if err := m.fn.Call(in)[0].Interface(); err != nil {
+		return reflect.Value{}, err.(error)
+	}
+	return reply, nil
+}
+
+// writeFrame sends the header msg followed by body, either of them may be nil.
+func (sc *StreamConn) writeFrame(kind uint8, seq uint64, msg, body interface{}) error {
+	sc.wmu.Lock()
+	defer sc.wmu.Unlock()
+	sc.wbuf.Reset()
+	for _, v := range []interface{}{msg, body} {
+		if v == nil {
+			continue
+		}
+		if err := sc.enc.Encode(v); err != nil {
+			// The encoder may have already recorded new types as sent, the peer would get out of sync.
+			err = fmt.Errorf("failed to encode %T: %w", v, err)
+			sc.closeWithError(err)
+			return err
+		}
+	}
+	payload := sc.wbuf.Bytes()
+	flags := uint8(0)
+	if sc.compress && len(payload) >= streamCompressMin {
+		var err error
+		if payload, err = compressFrame(payload); err != nil {
+			return err
+		}
+		flags |= frameCompressed
+	}
+	if len(payload) > streamMaxFrame {
+		err := fmt.Errorf("stream frame is too large: %v bytes", len(payload))
+		sc.closeWithError(err)
+		return err
+	}
+	frame := make([]byte, frameHeaderSize, frameHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(frame[0:], uint32(len(payload)))
+	frame[4] = kind
+	frame[5] = flags
+	binary.BigEndian.PutUint64(frame[6:], seq)
+	frame = append(frame, payload...)
+	if _, err := sc.rw.Write(frame); err != nil {
+		// If the connection is already closed, report why.
+		sc.closeWithError(err)
+		return sc.closeErr()
+	}
+	return nil
+}
+
+// readFrame reads the next frame and leaves its payload in rbuf for dec.
+func (sc *StreamConn) readFrame() (kind uint8, seq uint64, err error) {
+	var hdr [frameHeaderSize]byte
+	if _, err := io.ReadFull(sc.r, hdr[:]); err != nil {
+		return 0, 0, err
+	}
+	size := binary.BigEndian.Uint32(hdr[0:])
+	if size > streamMaxFrame {
+		return 0, 0, fmt.Errorf("stream frame is too large: %v bytes", size)
+	}
+	kind, flags := hdr[4], hdr[5]
+	seq = binary.BigEndian.Uint64(hdr[6:])
+	sc.rbuf.Reset()
+	if flags&frameCompressed == 0 {
+		if _, err := io.CopyN(&sc.rbuf, sc.r, int64(size)); err != nil {
+			return 0, 0, err
+		}
+		return kind, seq, nil
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(sc.r, payload); err != nil {
+		return 0, 0, err
+	}
+	if err := decompressFrame(&sc.rbuf, payload); err != nil {
+		return 0, 0, err
+	}
+	return kind, seq, nil
+}
+
+func (sc *StreamConn) readHandshake(want uint8, msg interface{}) error {
+	kind, _, err := sc.readFrame()
+	if err != nil {
+		return err
+	}
+	if kind != want {
+		return fmt.Errorf("unexpected stream frame kind %v in handshake", kind)
+	}
+	return sc.decode(msg)
+}
+
+// decode reads the next value of the gob stream from the current frame, v may be nil to skip it.
+func (sc *StreamConn) decode(v interface{}) error {
+	if err := sc.dec.Decode(v); err != nil {
+		return fmt.Errorf("failed to decode stream frame: %w", err)
+	}
+	return nil
+}
+
+func compressFrame(data []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	w, err := flate.NewWriter(buf, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decompressFrame(dst *bytes.Buffer, data []byte) error {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer r.Close()
+	n, err := io.Copy(dst, io.LimitReader(r, streamMaxFrame+1))
+	if err != nil {
+		return fmt.Errorf("failed to decompress stream frame: %w", err)
+	}
+	if n > streamMaxFrame {
+		return fmt.Errorf("decompressed stream frame is too large")
+	}
+	return nil
+}
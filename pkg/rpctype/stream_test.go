@@ -0,0 +1,258 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package rpctype
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testArgs struct {
+	Val  int
+	Data []byte
+}
+
+type testReply struct {
+	Val int
+}
+
+type testServer struct {
+	mu      sync.Mutex
+	conn    *StreamConn
+	block   chan struct{}
+	pushes  []int
+	blocked int
+}
+
+func (ts *testServer) Connect(conn *StreamConn, args *testArgs, reply *testReply) error {
+	ts.mu.Lock()
+	ts.conn = conn
+	ts.mu.Unlock()
+	reply.Val = args.Val + 1
+	return nil
+}
+
+func (ts *testServer) Echo(args *testArgs, reply *testArgs) error {
+	*reply = *args
+	return nil
+}
+
+func (ts *testServer) Fail(args *testArgs, reply *testReply) error {
+	return fmt.Errorf("failed with %v", args.Val)
+}
+
+func (ts *testServer) Block(args *testArgs, reply *testReply) error {
+	ts.mu.Lock()
+	ts.blocked++
+	ts.mu.Unlock()
+	<-ts.block
+	return nil
+}
+
+func (ts *testServer) numBlocked() int {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.blocked
+}
+
+func (ts *testServer) Push(args *testArgs, reply *int) error {
+	if ts.block != nil {
+		<-ts.block
+	}
+	ts.mu.Lock()
+	ts.pushes = append(ts.pushes, args.Val)
+	ts.mu.Unlock()
+	return nil
+}
+
+func (ts *testServer) pushed() []int {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return append([]int{}, ts.pushes...)
+}
+
+func newTestLoopback(t *testing.T, server, client *testServer) (*StreamConn, *StreamConn) {
+	serverConn, clientConn, err := StreamLoopback("Server", server, "Client", client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		serverConn.Close()
+		clientConn.Close()
+	})
+	return serverConn, clientConn
+}
+
+func TestStreamCall(t *testing.T) {
+	server, client := new(testServer), new(testServer)
+	serverConn, clientConn := newTestLoopback(t, server, client)
+	if serverConn.Version() != StreamVersion || clientConn.Version() != StreamVersion {
+		t.Fatalf("negotiated versions %v/%v", serverConn.Version(), clientConn.Version())
+	}
+	var reply testReply
+	if err := clientConn.Call("Server.Connect", &testArgs{Val: 1}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Val != 2 {
+		t.Fatalf("got reply %v, want 2", reply.Val)
+	}
+	// The server calls back over the connection it got in Connect.
+	var echo testArgs
+	if err := server.conn.Call("Client.Echo", &testArgs{Val: 3, Data: []byte("data")}, &echo); err != nil {
+		t.Fatal(err)
+	}
+	if echo.Val != 3 || string(echo.Data) != "data" {
+		t.Fatalf("got echo %+v", echo)
+	}
+	if err := clientConn.Call("Server.Echo", &testArgs{Val: 4}, nil); err != nil {
+		t.Fatal(err)
+	}
+	err := clientConn.Call("Server.Fail", &testArgs{Val: 5}, &reply)
+	if err == nil || err.Error() != "failed with 5" {
+		t.Fatalf("got error %v", err)
+	}
+	err = clientConn.Call("Server.Missing", &testArgs{}, &reply)
+	if err == nil || !strings.Contains(err.Error(), "unknown method") {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func TestStreamPush(t *testing.T) {
+	server := &testServer{block: make(chan struct{})}
+	_, clientConn := newTestLoopback(t, server, new(testServer))
+	// The server handles none of the pushes yet, so the window fills up and the next push blocks.
+	for i := 0; i < streamWindow; i++ {
+		if err := clientConn.Push("Server.Push", &testArgs{Val: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pushed := make(chan error)
+	go func() {
+		pushed <- clientConn.Push("Server.Push", &testArgs{Val: streamWindow})
+	}()
+	select {
+	case err := <-pushed:
+		t.Fatalf("push over the window did not block: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(server.block)
+	if err := <-pushed; err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < streamWindow; i++ {
+		if err := clientConn.Push("Server.Push", &testArgs{Val: streamWindow + 1 + i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Pushes and calls are not ordered with respect to each other,
+	// so wait for the pushes to be handled.
+	for start := time.Now(); len(server.pushed()) != 2*streamWindow+1; {
+		if time.Since(start) > 10*time.Second {
+			t.Fatalf("handled %v pushes", len(server.pushed()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for i, val := range server.pushed() {
+		if val != i {
+			t.Fatalf("push %v has value %v", i, val)
+		}
+	}
+}
+
+func TestStreamMaxCalls(t *testing.T) {
+	server := &testServer{block: make(chan struct{})}
+	_, clientConn := newTestLoopback(t, server, new(testServer))
+	called := make(chan error)
+	for i := 0; i < streamMaxCalls+1; i++ {
+		go func() {
+			called <- clientConn.Call("Server.Block", &testArgs{}, nil)
+		}()
+	}
+	for start := time.Now(); server.numBlocked() != streamMaxCalls; {
+		if time.Since(start) > 10*time.Second {
+			t.Fatalf("%v calls are being served", server.numBlocked())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if blocked := server.numBlocked(); blocked != streamMaxCalls {
+		t.Fatalf("%v calls are being served, want at most %v", blocked, streamMaxCalls)
+	}
+	close(server.block)
+	for i := 0; i < streamMaxCalls+1; i++ {
+		if err := <-called; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestStreamClose(t *testing.T) {
+	server := &testServer{block: make(chan struct{})}
+	defer close(server.block)
+	serverConn, clientConn := newTestLoopback(t, server, new(testServer))
+	called := make(chan error)
+	go func() {
+		called <- clientConn.Call("Server.Block", &testArgs{}, nil)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	serverConn.Close()
+	if err := <-called; !errors.Is(err, ErrStreamClosed) {
+		t.Fatalf("got error %v", err)
+	}
+	<-clientConn.Done()
+	if err := clientConn.Push("Server.Push", &testArgs{}); !errors.Is(err, ErrStreamClosed) {
+		t.Fatalf("got error %v", err)
+	}
+}
+
+func TestStreamVersionMismatch(t *testing.T) {
+	methods, err := streamMethods("Server", new(testServer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c0, c1 := net.Pipe()
+	errc := make(chan error, 1)
+	go func() {
+		_, err := acceptStream(c0, methods, 0)
+		errc <- err
+	}()
+	_, err = connectStream(c1, nil, 0, StreamVersion+1, StreamVersion+2, nil)
+	if err == nil || !strings.Contains(err.Error(), "unsupported stream version") {
+		t.Fatalf("got client error %v", err)
+	}
+	if err := <-errc; err == nil {
+		t.Fatalf("server accepted a bad version")
+	}
+}
+
+func TestStreamTCP(t *testing.T) {
+	server := new(testServer)
+	serv, err := NewStreamServer("127.0.0.1:0", "Server", server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go serv.Serve()
+	client, err := DialStream(serv.Addr().String(), 1, "Client", new(testServer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	// Large payloads are compressed.
+	args := &testArgs{Val: 1, Data: make([]byte, 1<<20)}
+	var echo testArgs
+	if err := client.Call("Server.Echo", args, &echo); err != nil {
+		t.Fatal(err)
+	}
+	if len(echo.Data) != len(args.Data) {
+		t.Fatalf("got %v bytes back", len(echo.Data))
+	}
+	if total := serv.TotalBytes.Load(); total == 0 || total > uint64(len(args.Data))/10 {
+		t.Fatalf("transferred %v bytes", total)
+	}
+}
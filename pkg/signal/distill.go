@@ -0,0 +1,161 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package signal
+
+import (
+	"container/heap"
+)
+
+// DistillConfig configures Distill, zero values stand for the defaults.
+type DistillConfig struct {
+	// Number of inputs kept for each rare signal element (default 2).
+	Redundancy int
+	// Signal elements covered by at most this many inputs are rare (default 10).
+	RareLimit int
+	// Maximum number of inputs to keep (default 0, no limit).
+	Budget int
+}
+
+const (
+	DefaultDistillRedundancy = 2
+	DefaultDistillRareLimit  = 10
+)
+
+// DistillInput is an input of Distill, Cost is how expensive the input is to keep
+// (e.g. to execute), cheaper inputs are preferred.
+type DistillInput struct {
+	Signal  Signal
+	Cost    float64
+	Context interface{}
+}
+
+// Distill is an alternative to Minimize. It selects a subset of inputs that covers
+// the whole signal with a weighted greedy set cover: on each step it takes the input
+// that covers the most of the not yet covered signal per unit of cost. Then it takes more
+// inputs until each rare signal element is covered by cfg.Redundancy inputs, so that
+// the signal is not lost if one of the inputs becomes flaky.
+// If the result exceeds cfg.Budget, the least efficient inputs are dropped,
+// the ones taken for redundancy first.
+// The result is ordered by the selection order and depends only on the order of inputs.
+func Distill(inputs []DistillInput, cfg DistillConfig) []interface{} {
+	if cfg.Redundancy <= 0 {
+		cfg.Redundancy = DefaultDistillRedundancy
+	}
+	if cfg.RareLimit <= 0 {
+		cfg.RareLimit = DefaultDistillRareLimit
+	}
+	count := make(map[elemType]int)
+	for _, inp := range inputs {
+		for e := range inp.Signal {
+			count[e]++
+		}
+	}
+	need := make(map[elemType]int, len(count))
+	for e := range count {
+		need[e] = 1
+	}
+	selected := make([]bool, len(inputs))
+	order := distillCover(inputs, need, selected)
+	// All signal is covered once now, ask for the rest of the rare signal copies.
+	for e, n := range count {
+		if n > cfg.RareLimit {
+			continue
+		}
+		if n > cfg.Redundancy {
+			n = cfg.Redundancy
+		}
+		need[e] = n - 1
+	}
+	order = append(order, distillCover(inputs, need, selected)...)
+	if cfg.Budget > 0 && len(order) > cfg.Budget {
+		order = order[:cfg.Budget]
+	}
+	result := make([]interface{}, len(order))
+	for i, idx := range order {
+		result[i] = inputs[idx].Context
+	}
+	return result
+}
+
+// distillCover greedily selects inputs until need is satisfied or no input helps anymore.
+// need is the number of times each element still needs to be covered.
+func distillCover(inputs []DistillInput, need map[elemType]int, selected []bool) []int {
+	gain := func(idx int) int {
+		res := 0
+		for e := range inputs[idx].Signal {
+			if need[e] > 0 {
+				res++
+			}
+		}
+		return res
+	}
+	queue := &distillQueue{}
+	for idx := range inputs {
+		if selected[idx] {
+			continue
+		}
+		if g := gain(idx); g != 0 {
+			queue.items = append(queue.items, distillItem{idx, float64(g) / distillCost(inputs[idx])})
+		}
+	}
+	heap.Init(queue)
+	var order []int
+	for queue.Len() != 0 {
+		// Gains only decrease as inputs are selected, so the scores in the queue
+		// are upper bounds. Recompute the score of the top input and take it
+		// only if it's still not worse than the next best upper bound.
+		item := heap.Pop(queue).(distillItem)
+		g := gain(item.idx)
+		if g == 0 {
+			continue
+		}
+		item.score = float64(g) / distillCost(inputs[item.idx])
+		if queue.Len() != 0 && queue.less(queue.items[0], item) {
+			heap.Push(queue, item)
+			continue
+		}
+		selected[item.idx] = true
+		order = append(order, item.idx)
+		for e := range inputs[item.idx].Signal {
+			if need[e] > 0 {
+				need[e]--
+			}
+		}
+	}
+	return order
+}
+
+func distillCost(inp DistillInput) float64 {
+	if inp.Cost <= 0 {
+		return 1
+	}
+	return inp.Cost
+}
+
+type distillItem struct {
+	idx   int
+	score float64
+}
+
+type distillQueue struct {
+	items []distillItem
+}
+
+func (q *distillQueue) less(a, b distillItem) bool {
+	if a.score != b.score {
+		return a.score > b.score
+	}
+	return a.idx < b.idx
+}
+
+func (q *distillQueue) Len() int           { return len(q.items) }
+func (q *distillQueue) Less(i, j int) bool { return q.less(q.items[i], q.items[j]) }
+func (q *distillQueue) Swap(i, j int)      { q.items[i], q.items[j] = q.items[j], q.items[i] }
+func (q *distillQueue) Push(x interface{}) { q.items = append(q.items, x.(distillItem)) }
+
+func (q *distillQueue) Pop() interface{} {
+	last := q.items[len(q.items)-1]
+	q.items = q.items[:len(q.items)-1]
+	return last
+}
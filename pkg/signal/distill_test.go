@@ -0,0 +1,38 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package signal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDistill(t *testing.T) {
+	inputs := []DistillInput{
+		{Signal: FromRaw([]uint32{1, 2}, 0), Context: "a"},
+		{Signal: FromRaw([]uint32{1}, 0), Context: "b"},
+		{Signal: FromRaw([]uint32{2}, 0), Context: "c"},
+		{Signal: FromRaw([]uint32{3}, 0), Context: "d"},
+		{Signal: FromRaw([]uint32{3}, 0), Cost: 2, Context: "e"},
+	}
+	// Elements 1, 2 and 3 are rare, so each of them gets a second input.
+	assert.Equal(t, []interface{}{"a", "d", "b", "c", "e"}, Distill(inputs, DistillConfig{}))
+	assert.Equal(t, []interface{}{"a", "d"}, Distill(inputs, DistillConfig{Redundancy: 1}))
+	assert.Equal(t, []interface{}{"a", "d", "b"}, Distill(inputs, DistillConfig{Budget: 3}))
+	assert.Equal(t, []interface{}{"a"}, Distill(inputs, DistillConfig{Budget: 1}))
+	// Nothing is rare.
+	assert.Equal(t, []interface{}{"a", "d"}, Distill(inputs, DistillConfig{RareLimit: 1}))
+	assert.Empty(t, Distill(nil, DistillConfig{}))
+}
+
+func TestDistillCost(t *testing.T) {
+	inputs := []DistillInput{
+		{Signal: FromRaw([]uint32{1, 2, 3}, 0), Cost: 10, Context: "slow"},
+		{Signal: FromRaw([]uint32{1, 2}, 0), Cost: 1, Context: "fast1"},
+		{Signal: FromRaw([]uint32{3}, 0), Cost: 1, Context: "fast2"},
+	}
+	assert.Equal(t, []interface{}{"fast1", "fast2"}, Distill(inputs, DistillConfig{Redundancy: 1}))
+	assert.Equal(t, []interface{}{"fast1", "fast2", "slow"}, Distill(inputs, DistillConfig{}))
+}
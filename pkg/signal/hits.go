@@ -0,0 +1,86 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package signal
+
+import (
+	"sync/atomic"
+)
+
+const (
+	hitCountsBits = 20
+	// An element is rare if it was hit by at most 1/RareHitsRatio of the executions.
+	RareHitsRatio = 1000
+)
+
+// HitCounts counts how many executions have hit each signal element.
+// The counters are kept in a fixed-size table indexed by a hash of the element,
+// so the counts of colliding elements are merged and are only an upper bound.
+// This keeps the updates cheap: no allocations and no locks on the execution path.
+// The zero value is ready to use, all methods are safe for concurrent use.
+type HitCounts struct {
+	table [1 << hitCountsBits]atomic.Uint32
+	// The last execution that has updated the table entry, it makes every execution
+	// count an entry only once even if several calls hit it.
+	// Concurrent executions can still race on an entry and count it twice.
+	last  [1 << hitCountsBits]atomic.Uint32
+	execs atomic.Uint64
+}
+
+// Record accounts a single execution with the raw signal of its calls.
+func (hc *HitCounts) Record(raws ...[]uint32) {
+	// Execution ids start from 1, so that the zero value of last matches no execution.
+	exec := uint32(hc.execs.Add(1))
+	if exec == 0 {
+		exec = 1
+	}
+	for _, raw := range raws {
+		for _, elem := range raw {
+			idx := hitCountsIndex(elem)
+			if hc.last[idx].Swap(exec) == exec {
+				continue
+			}
+			counter := &hc.table[idx]
+			if counter.Add(1) == 0 {
+				// Saturate instead of wrapping around.
+				counter.Store(^uint32(0))
+			}
+		}
+	}
+}
+
+// Count returns the number of executions that have hit the element.
+func (hc *HitCounts) Count(elem uint32) uint32 {
+	return hc.table[hitCountsIndex(elem)].Load()
+}
+
+// Execs returns the number of recorded executions.
+func (hc *HitCounts) Execs() uint64 {
+	return hc.execs.Load()
+}
+
+// RareCount returns the number of rare elements in the raw signal: the ones that were hit
+// only by a small share of the executions. The elements that were never hit are the rarest ones
+// (e.g. the new signal of an execution that is not recorded yet).
+func (hc *HitCounts) RareCount(raw []uint32) int {
+	limit := hc.rareLimit()
+	rare := 0
+	for _, elem := range raw {
+		if count := uint64(hc.Count(elem)); count <= limit {
+			rare++
+		}
+	}
+	return rare
+}
+
+func (hc *HitCounts) rareLimit() uint64 {
+	if limit := hc.Execs() / RareHitsRatio; limit > 1 {
+		return limit
+	}
+	return 1
+}
+
+func hitCountsIndex(elem uint32) uint32 {
+	// Fibonacci hashing: signal elements are often close to each other.
+	return (elem * 2654435769) >> (32 - hitCountsBits)
+}
@@ -0,0 +1,28 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package signal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHitCounts(t *testing.T) {
+	hc := new(HitCounts)
+	assert.Equal(t, 1, hc.RareCount([]uint32{1}), "never hit")
+	for i := 0; i < 10*RareHitsRatio; i++ {
+		// The elements hit by several calls (or several times by one call)
+		// are counted once per execution.
+		hc.Record([]uint32{1, 2, 1}, []uint32{3, 1})
+		if i%RareHitsRatio == 0 {
+			hc.Record([]uint32{4})
+		}
+	}
+	assert.Equal(t, uint64(10*RareHitsRatio+10), hc.Execs())
+	assert.Equal(t, uint32(10*RareHitsRatio), hc.Count(1))
+	assert.Equal(t, uint32(10), hc.Count(4))
+	assert.Zero(t, hc.Count(5))
+	assert.Equal(t, 2, hc.RareCount([]uint32{1, 3, 4, 5}))
+}
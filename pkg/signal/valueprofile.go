@@ -0,0 +1,19 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package signal
+
+import (
+	"math/bits"
+)
+
+// ValueProfile returns the value profile signal element of the comparison of op1 and op2
+// at the given PC: the comparison site combined with the number of bits the operands differ in.
+// This way each step towards satisfying a comparison is new signal (like libFuzzer's
+// -use_value_profile). The elements form a separate namespace, they must not be mixed
+// with the coverage signal.
+func ValueProfile(pc uint32, op1, op2 uint64) uint32 {
+	// Fibonacci hashing spreads close PCs over the high bits,
+	// the low 7 bits hold the distance (0-64).
+	return (pc*2654435769)<<7 | uint32(bits.OnesCount64(op1^op2))
+}
@@ -0,0 +1,22 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package signal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValueProfile(t *testing.T) {
+	// The distance between the operands is a part of the element.
+	assert.NotEqual(t, ValueProfile(0x1000, 0xf0, 0xff), ValueProfile(0x1000, 0xf0, 0xf1))
+	assert.Equal(t, ValueProfile(0x1000, 0xf0, 0xf1), ValueProfile(0x1000, 0xf1, 0xf0))
+	// The values are not, only the distance.
+	assert.Equal(t, ValueProfile(0x1000, 0x10, 0x11), ValueProfile(0x1000, 0x20, 0x21))
+	// And so is the comparison site.
+	assert.NotEqual(t, ValueProfile(0x1000, 1, 2), ValueProfile(0x1004, 1, 2))
+	assert.Equal(t, uint32(0), ValueProfile(0x1000, 1, 1)&0x7f)
+	assert.Equal(t, uint32(64), ValueProfile(0x1000, 0, ^uint64(0))&0x7f)
+}
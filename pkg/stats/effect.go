@@ -0,0 +1,41 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package stats
+
+import "math"
+
+// VarghaDelaneyA12 is the Vargha-Delaney A12 effect size: the probability that a value
+// drawn from a is larger than a value drawn from b (ties count as a half).
+// 0.5 means no difference, 1.0 means that all values of a are larger.
+func VarghaDelaneyA12(a, b *Sample) float64 {
+	if len(a.Xs) == 0 || len(b.Xs) == 0 {
+		return 0.5
+	}
+	var wins float64
+	for _, x := range a.Xs {
+		for _, y := range b.Xs {
+			if x > y {
+				wins++
+			} else if x == y {
+				wins += 0.5
+			}
+		}
+	}
+	return wins / float64(len(a.Xs)*len(b.Xs))
+}
+
+// A12Magnitude classifies the A12 effect size using the conventional thresholds
+// proposed by Vargha and Delaney.
+func A12Magnitude(a12 float64) string {
+	switch d := math.Abs(a12 - 0.5); {
+	case d < 0.06:
+		return "negligible"
+	case d < 0.14:
+		return "small"
+	case d < 0.21:
+		return "medium"
+	default:
+		return "large"
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package stats
+
+import (
+	"math"
+	"testing"
+)
+
+func TestVarghaDelaneyA12(t *testing.T) {
+	tests := []struct {
+		a         []float64
+		b         []float64
+		a12       float64
+		magnitude string
+	}{
+		{
+			a:         []float64{4, 5, 6},
+			b:         []float64{1, 2, 3},
+			a12:       1,
+			magnitude: "large",
+		},
+		{
+			a:         []float64{1, 2, 3},
+			b:         []float64{1, 2, 3},
+			a12:       0.5,
+			magnitude: "negligible",
+		},
+		{
+			a:         []float64{1, 2},
+			b:         []float64{2, 3},
+			a12:       0.125,
+			magnitude: "large",
+		},
+		{
+			a:         []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+			b:         []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 9},
+			a12:       0.51,
+			magnitude: "negligible",
+		},
+	}
+	for _, test := range tests {
+		a12 := VarghaDelaneyA12(&Sample{Xs: test.a}, &Sample{Xs: test.b})
+		if math.Abs(a12-test.a12) > 1e-9 {
+			t.Errorf("A12(%v, %v): got %v, expected %v", test.a, test.b, a12, test.a12)
+		}
+		if magnitude := A12Magnitude(a12); magnitude != test.magnitude {
+			t.Errorf("A12(%v, %v): got %v effect, expected %v", test.a, test.b, magnitude, test.magnitude)
+		}
+	}
+}
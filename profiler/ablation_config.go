@@ -1,26 +1,25 @@
 package profiler
 
 import (
-	"encoding/json"
-	"os"
-	"sync"
+	"sync/atomic"
 )
 
 type AblationConfiguration struct {
-	// create the configuration only once
-	Once sync.Once
 	// flags disable modes
 	DisableModeGenerate bool `json:"disable_mode_generate"`
 	DisableModeHints    bool `json:"disable_mode_hints"`
 	DisableModeMutate   bool `json:"disable_mode_mutate"`
 	DisableModeSmash    bool `json:"disable_mode_smash"`
+	DisableModeNgram    bool `json:"disable_mode_ngram"`
 	// flags disable mutators
-	AnyMutatorEnabled        bool
 	DisableMutatorInsertCall bool `json:"disable_mutator_insert_call"`
 	DisableMutatorMutateArg  bool `json:"disable_mutator_mutate_arg"`
 	DisableMutatorRemoveCall bool `json:"disable_mutator_remove_call"`
 	DisableMutatorSplice     bool `json:"disable_mutator_splice"`
 	DisableMutatorSquashAny  bool `json:"disable_mutator_squash_any"`
+
+	DisableMutatorRewireResources bool `json:"disable_mutator_rewire_resources"`
+	DisableMutatorCrossover       bool `json:"disable_mutator_crossover"`
 	// flags disable stages
 	DisableStageCollide  bool `json:"disable_stage_collide"`
 	DisableStageMinimize bool `json:"disable_stage_minimize"`
@@ -28,31 +27,29 @@ type AblationConfiguration struct {
 	ReduceMutatorInsertCall bool `json:"reduce_mutator_insert_call"`
 	ReduceMutatorMutateArg  bool `json:"reduce_mutator_mutate_arg"`
 	ReduceMutatorSplice     bool `json:"reduce_mutator_splice"`
+	// relative probabilities of the mutators keyed by mutator name, e.g. {"splice": 0.004},
+	// mutators that are not present keep their default weight (see prog.DefaultMutatorWeights)
+	MutatorWeights map[string]float64 `json:"mutator_weights,omitempty"`
+	// adapt the mutator weights online depending on how much new signal each mutator yields
+	AdaptiveMutatorWeights bool `json:"adaptive_mutator_weights"`
 }
 
-var (
-	AblationConfig = AblationConfiguration{
-		AnyMutatorEnabled: true,
-	}
-)
-
-func SetupAblationConfig(filename string, cfg *AblationConfiguration) error {
-	file, err := os.Open(filename)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
+// The configuration currently in effect. It is replaced as a whole (never modified
+// in place) so that readers always observe a consistent set of flags, even when
+// syz-manager pushes a new configuration while the fuzzer is running.
+var ablationConfig atomic.Pointer[AblationConfiguration]
 
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(cfg); err != nil {
-		return err
-	}
+func init() {
+	ablationConfig.Store(&AblationConfiguration{})
+}
 
-	cfg.AnyMutatorEnabled = !(cfg.DisableMutatorInsertCall &&
-		cfg.DisableMutatorMutateArg &&
-		cfg.DisableMutatorRemoveCall &&
-		cfg.DisableMutatorSplice &&
-		cfg.DisableMutatorSquashAny)
+// Ablation returns the ablation configuration currently in effect.
+// The returned value must not be modified.
+func Ablation() *AblationConfiguration {
+	return ablationConfig.Load()
+}
 
-	return nil
+// SetAblation replaces the ablation configuration currently in effect.
+func SetAblation(cfg AblationConfiguration) {
+	ablationConfig.Store(&cfg)
 }
@@ -0,0 +1,131 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+// crossoverArg is a struct, array or union argument of the call with the index call.
+type crossoverArg struct {
+	arg  Arg
+	call int
+	base *PointerArg // pointer to the heap object containing the argument
+}
+
+type crossoverKey struct {
+	typ Type
+	dir Dir
+}
+
+// crossoverArgs returns the struct, array and union arguments of the program calls
+// except for the calls with IDs in skip.
+func (p *Prog) crossoverArgs(skip map[int]bool) []crossoverArg {
+	var args []crossoverArg
+	for i, c := range p.Calls {
+		if skip[c.Meta.ID] {
+			continue
+		}
+		ForeachArg(c, func(arg Arg, ctx *ArgCtx) {
+			switch arg.(type) {
+			case *GroupArg, *UnionArg:
+				args = append(args, crossoverArg{arg, i, ctx.Base})
+			}
+		})
+	}
+	return args
+}
+
+// crossover is a structure-aware counterpart of splice: instead of whole calls it transplants
+// a struct, array or union argument of a random corpus program into an argument of the same
+// type in the program. Resources the transplanted argument refers to are relinked to the
+// compatible resources produced by the preceding calls of the program (or reset to the default
+// values), so the argument stays meaningful in the new context.
+func (ctx *mutator) crossover() bool {
+	p, r := ctx.p, ctx.r
+	if len(ctx.corpus) == 0 {
+		return false
+	}
+	dsts := p.crossoverArgs(ctx.noMutate)
+	if len(dsts) == 0 {
+		return false
+	}
+	// The source arguments are taken from a copy, corpus programs must not be changed.
+	p0 := ctx.corpus[r.Intn(len(ctx.corpus))].Clone()
+	srcs := make(map[crossoverKey][]Arg)
+	for _, src := range p0.crossoverArgs(nil) {
+		key := crossoverKey{src.arg.Type(), src.arg.Dir()}
+		srcs[key] = append(srcs[key], src.arg)
+	}
+	for _, i := range r.Perm(len(dsts)) {
+		dst := dsts[i]
+		cands := srcs[crossoverKey{dst.arg.Type(), dst.arg.Dir()}]
+		if len(cands) == 0 {
+			continue
+		}
+		ctx.transplant(dst, cands[r.Intn(len(cands))])
+		return true
+	}
+	return false
+}
+
+func (ctx *mutator) transplant(dst crossoverArg, src Arg) {
+	p, r := ctx.p, ctx.r
+	c := p.Calls[dst.call]
+	// Cut the links of the source argument resources to the rest of its program.
+	producers, _ := p.resourceArgs()
+	var results []*ResultArg
+	inside := make(map[*ResultArg]bool)
+	ForeachSubArg(src, func(arg Arg, _ *ArgCtx) {
+		if a, ok := arg.(*ResultArg); ok {
+			results = append(results, a)
+			inside[a] = true
+		}
+	})
+	for _, a := range results {
+		for use := range a.uses {
+			if !inside[use] {
+				delete(a.uses, use)
+			}
+		}
+		if a.Res == nil || inside[a.Res] {
+			continue
+		}
+		var candidates []*ResultArg
+		for _, prod := range producers {
+			if prod.call < dst.call && ctx.compatibleResource(a, prod.arg) {
+				candidates = append(candidates, prod.arg)
+			}
+		}
+		if len(candidates) != 0 {
+			res := candidates[r.Intn(len(candidates))]
+			replaceResultArg(a, MakeResultArg(a.Type(), a.Dir(), res, 0))
+		} else {
+			replaceResultArg(a, a.Type().DefaultArg(a.Dir()).(*ResultArg))
+		}
+	}
+	// Note: we need to call analyze before we replace the argument,
+	// the heap object containing it can grow out of bounds of the data area.
+	s := analyze(ctx.ct, ctx.corpus, p, c)
+	var baseSize uint64
+	if dst.base != nil {
+		baseSize = dst.base.Res.Size()
+	}
+	removeArg(dst.arg)
+	switch a := dst.arg.(type) {
+	case *GroupArg:
+		*a = *src.(*GroupArg)
+	case *UnionArg:
+		*a = *src.(*UnionArg)
+	}
+	if base := dst.base; base != nil && baseSize < base.Res.Size() {
+		newArg := r.allocAddr(s, base.Type(), base.Dir(), base.Res.Size(), base.Res)
+		*base = *newArg
+	}
+	// The transplanted argument may not satisfy the conditions of its new parents.
+	calls, _ := r.patchConditionalFields(c, s)
+	p.insertBefore(c, calls)
+	idx := dst.call + len(calls)
+	for len(p.Calls) > ctx.ncalls {
+		idx--
+		p.RemoveCall(idx)
+	}
+	p.Target.assignSizesCall(c)
+}
@@ -0,0 +1,110 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestCrossover(t *testing.T) {
+	target, rs, _ := initRandomTargetTest(t, "test", "64")
+	tests := []struct {
+		prog   string
+		corpus string
+		goal   string
+	}{
+		// Transplant a nested struct.
+		{
+			prog:   `test$struct(&(0x7f0000000000)={0x1, {0x2}})`,
+			corpus: `test$struct(&(0x7f0000000000)={0x3, {0x4}})`,
+			goal:   `test$struct(&(0x7f0000000000)={0x1, {0x4}})`,
+		},
+		// The transplanted resource is relinked to the resource of the program.
+		{
+			prog: `
+r0 = test$res2()
+test$syz_union4(@f1=0x1)
+`,
+			corpus: `
+test$res2()
+r0 = test$res2()
+test$syz_union4(@f4=r0)
+`,
+			goal: `
+r0 = test$res2()
+test$syz_union4(@f4=r0)
+`,
+		},
+		// There is nothing to link the transplanted resource to.
+		{
+			prog: `test$syz_union4(@f1=0x1)`,
+			corpus: `
+r0 = test$res2()
+test$syz_union4(@f4=r0)
+`,
+			goal: `test$syz_union4(@f4=0xffffffffffffffff)`,
+		},
+	}
+	for ti, test := range tests {
+		test := test
+		t.Run(fmt.Sprint(ti), func(t *testing.T) {
+			var progs []*Prog
+			for _, text := range []string{test.prog, test.corpus, test.goal} {
+				p, err := target.Deserialize([]byte(text), Strict)
+				if err != nil {
+					t.Fatal(err)
+				}
+				progs = append(progs, p)
+			}
+			p, corpus, want := progs[0], progs[1:2], progs[2].Serialize()
+			corpusData := corpus[0].Serialize()
+			ct := target.DefaultChoiceTable()
+			r := newRand(target, rs)
+			for i := 0; i < 1e3; i++ {
+				p1 := p.Clone()
+				ctx := &mutator{p: p1, r: r, ncalls: 10, ct: ct, corpus: corpus}
+				if !ctx.crossover() {
+					t.Fatalf("crossover failed:\n%s", test.prog)
+				}
+				if err := p1.validate(); err != nil {
+					t.Fatalf("invalid program after crossover: %v\n%s", err, p1.Serialize())
+				}
+				if !bytes.Equal(corpusData, corpus[0].Serialize()) {
+					t.Fatalf("crossover changed the corpus program")
+				}
+				if bytes.Equal(want, p1.Serialize()) {
+					return
+				}
+			}
+			t.Fatalf("failed to achieve goal, original:%s\ngoal:%s", test.prog, test.goal)
+		})
+	}
+}
+
+func TestCrossoverRandom(t *testing.T) {
+	testEachTargetRandom(t, func(t *testing.T, target *Target, rs rand.Source, iters int) {
+		ct := target.DefaultChoiceTable()
+		r := newRand(target, rs)
+		var corpus []*Prog
+		for i := 0; i < 10; i++ {
+			corpus = append(corpus, target.Generate(rs, 10, ct))
+		}
+		for i := 0; i < iters; i++ {
+			p := target.Generate(rs, 10, ct)
+			ctx := &mutator{p: p, r: r, ncalls: 20, ct: ct, corpus: corpus}
+			ctx.crossover()
+			if err := p.validate(); err != nil {
+				t.Fatalf("invalid program after crossover: %v\n%s", err, p.Serialize())
+			}
+		}
+		for _, p := range corpus {
+			if err := p.validate(); err != nil {
+				t.Fatalf("crossover broke a corpus program: %v\n%s", err, p.Serialize())
+			}
+		}
+	})
+}
@@ -55,7 +55,7 @@ func TestConditionalResources(t *testing.T) {
 	}
 	for i := 0; i < iters; i++ {
 		p := target.Generate(rs, 10, ct)
-		p.Mutate(rs, 10, ct, nil, nil)
+		p.Mutate(rs, 10, ct, nil, nil, DefaultMutatorWeights)
 	}
 }
 
@@ -71,7 +71,7 @@ func TestMutateConditionalFields(t *testing.T) {
 	for i := 0; i < iters; i++ {
 		prog := genConditionalFieldProg(target, ct, r)
 		for j := 0; j < 5; j++ {
-			prog.Mutate(rs, 10, ct, nil, nil)
+			prog.Mutate(rs, 10, ct, nil, nil, DefaultMutatorWeights)
 			hasAny := bytes.Contains(prog.Serialize(), []byte("ANY="))
 			if hasAny {
 				// No sense to verify these.
@@ -1,5 +1,3 @@
-//go:build !profiling
-
 // Copyright 2015 syzkaller project authors. All rights reserved.
 // Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
 
@@ -11,8 +9,10 @@ import (
 	"math"
 	"math/rand"
 	"sort"
+	"time"
 
 	"github.com/google/syzkaller/pkg/image"
+	"github.com/google/syzkaller/profiler"
 )
 
 // Maximum length of generated binary blobs inserted into the program.
@@ -26,7 +26,57 @@ const maxBlobLen = uint64(100 << 10)
 // ct:          ChoiceTable for syscalls.
 // noMutate:    Set of IDs of syscalls which should not be mutated.
 // corpus:      The entire corpus, including original program p.
-func (p *Prog) Mutate(rs rand.Source, ncalls int, ct *ChoiceTable, noMutate map[int]bool, corpus []*Prog) {
+// weights:     Relative probabilities of the mutators (see DefaultMutatorWeights).
+func (p *Prog) Mutate(rs rand.Source, ncalls int, ct *ChoiceTable, noMutate map[int]bool, corpus []*Prog,
+	weights MutatorWeights) {
+	p.mutate(rs, ncalls, ct, noMutate, corpus, weights, nil, nil)
+}
+
+// MutateWithMutators is Mutate that also returns how many times each mutator was applied.
+func (p *Prog) MutateWithMutators(rs rand.Source, ncalls int, ct *ChoiceTable, noMutate map[int]bool,
+	corpus []*Prog, weights MutatorWeights) map[MutatorIndex]int {
+	observer := map[MutatorIndex]int{}
+	p.mutate(rs, ncalls, ct, noMutate, corpus, weights, observer, nil)
+	return observer
+}
+
+// MutatorAnalysis describes the applications of a single mutator during mutation(s):
+// how many times it changed the program (or did nothing) and how long it took.
+type MutatorAnalysis struct {
+	NFails      uint64
+	NSuccess    uint64
+	TimeFails   time.Duration
+	TimeSuccess time.Duration
+}
+
+func (a *MutatorAnalysis) record(ok bool, delta time.Duration) {
+	if ok {
+		a.NSuccess++
+		a.TimeSuccess += delta
+	} else {
+		a.NFails++
+		a.TimeFails += delta
+	}
+}
+
+// MutateWithObserver is Mutate that also returns how many times each mutator was applied
+// and how each of them performed. Timing the mutators is not free, so it's meant for profiling,
+// use MutateWithMutators otherwise.
+func (p *Prog) MutateWithObserver(rs rand.Source, ncalls int, ct *ChoiceTable, noMutate map[int]bool, corpus []*Prog,
+	weights MutatorWeights) (map[MutatorIndex]int, map[MutatorIndex]MutatorAnalysis) {
+	observer := map[MutatorIndex]int{} // count utilization of mutators
+	analysis := map[MutatorIndex]MutatorAnalysis{}
+	p.mutate(rs, ncalls, ct, noMutate, corpus, weights, observer, analysis)
+	return observer, analysis
+}
+
+// mutate fills observer and analysis if they are not nil.
+// Mutators disabled in the ablation configuration are never applied.
+func (p *Prog) mutate(rs rand.Source, ncalls int, ct *ChoiceTable, noMutate map[int]bool, corpus []*Prog,
+	weights MutatorWeights, observer map[MutatorIndex]int, analysis map[MutatorIndex]MutatorAnalysis) {
+	if err := weights.Validate(); err != nil {
+		panic(err)
+	}
 	r := newRand(p.Target, rs)
 	if ncalls < len(p.Calls) {
 		ncalls = len(p.Calls)
@@ -38,21 +88,56 @@ func (p *Prog) Mutate(rs rand.Source, ncalls int, ct *ChoiceTable, noMutate map[
 		ct:       ct,
 		noMutate: noMutate,
 		corpus:   corpus,
-	}
-	for stop, ok := false, false; !stop; stop = ok && len(p.Calls) != 0 && r.oneOf(3) {
-		switch {
-		case r.oneOf(5):
+		ablation: profiler.Ablation(),
+	}
+	weights = weights.WithoutDisabledMutators(ctx.ablation)
+
+	// Some mutators can fail on every attempt (e.g. insertCall when the program already
+	// has ncalls calls, or crossover with an empty corpus). If only such mutators are enabled,
+	// give up rather than spin forever. Other mutators are not applied instead,
+	// that would break the experiments that enable only some of them.
+	const maxFailures = 100
+	failures := 0
+	if weights.total() == 0 {
+		// All mutators have been disabled, there is nothing to apply.
+		failures = maxFailures
+	}
+	for stop, ok := false, false; !stop && failures < maxFailures; stop = ok && len(p.Calls) != 0 && r.oneOf(3) {
+		idx := weights.choose(r)
+		if observer != nil {
+			observer[idx]++
+		}
+		var start time.Time
+		if analysis != nil {
+			start = time.Now()
+		}
+		switch idx {
+		case MutatorIndexSquashAny:
 			// Not all calls have anything squashable,
 			// so this has lower priority in reality.
 			ok = ctx.squashAny()
-		case r.nOutOf(1, 100):
+		case MutatorIndexSplice:
 			ok = ctx.splice()
-		case r.nOutOf(20, 31):
+		case MutatorIndexInsertCall:
 			ok = ctx.insertCall()
-		case r.nOutOf(10, 11):
+		case MutatorIndexMutateArg:
 			ok = ctx.mutateArg()
-		default:
+		case MutatorIndexRemoveCall:
 			ok = ctx.removeCall()
+		case MutatorIndexRewireResources:
+			ok = ctx.rewireResources()
+		case MutatorIndexCrossover:
+			ok = ctx.crossover()
+		}
+		if analysis != nil {
+			stats := analysis[idx]
+			stats.record(ok, time.Since(start))
+			analysis[idx] = stats
+		}
+		if ok {
+			failures = 0
+		} else {
+			failures++
 		}
 	}
 	p.sanitizeFix()
@@ -71,6 +156,8 @@ type mutator struct {
 	ct       *ChoiceTable // ChoiceTable for syscalls.
 	noMutate map[int]bool // Set of IDs of syscalls which should not be mutated.
 	corpus   []*Prog      // The entire corpus, including original program p.
+	// The ablation configuration may be replaced concurrently, so the mutation takes it once.
+	ablation *profiler.AblationConfiguration
 }
 
 // This function selects a random other program p0 out of the corpus, and
@@ -82,6 +169,9 @@ func (ctx *mutator) splice() bool {
 		return false
 	}
 	p0 := ctx.corpus[r.Intn(len(ctx.corpus))]
+	if ctx.ablation.ReduceMutatorSplice {
+		p0 = ctx.corpus[0]
+	}
 	p0c := p0.Clone()
 	idx := r.Intn(len(p.Calls))
 	p.Calls = append(p.Calls[:idx], append(p0c.Calls, p.Calls[idx:]...)...)
@@ -145,7 +235,13 @@ func (ctx *mutator) insertCall() bool {
 	if len(p.Calls) >= ctx.ncalls {
 		return false
 	}
+
 	idx := r.biasedRand(len(p.Calls)+1, 5)
+	// choose index fully randomly if the reduction is activated
+	if ctx.ablation.ReduceMutatorInsertCall {
+		idx = r.Intn(len(p.Calls) + 1)
+	}
+
 	var c *Call
 	if idx < len(p.Calls) {
 		c = p.Calls[idx]
@@ -178,6 +274,10 @@ func (ctx *mutator) mutateArg() bool {
 	}
 
 	idx := chooseCall(p, r)
+	if ctx.ablation.ReduceMutatorMutateArg {
+		idx = chooseCallRandomly(p, r)
+	}
+
 	if idx < 0 {
 		return false
 	}
@@ -195,6 +295,9 @@ func (ctx *mutator) mutateArg() bool {
 		}
 		s := analyze(ctx.ct, ctx.corpus, p, c)
 		arg, argCtx := ma.chooseArg(r.Rand)
+		if ctx.ablation.ReduceMutatorMutateArg {
+			arg, argCtx = ma.chooseArgRandomly(r.Rand)
+		}
 		calls, ok1 := p.Target.mutateArg(r, s, arg, argCtx, &updateSizes)
 		if !ok1 {
 			ok = false
@@ -219,6 +322,11 @@ func (ctx *mutator) mutateArg() bool {
 	return true
 }
 
+// Select a call randomly
+func chooseCallRandomly(p *Prog, r *randGen) int {
+	return r.Intn(len(p.Calls))
+}
+
 // Select a call based on the complexity of the arguments.
 func chooseCall(p *Prog, r *randGen) int {
 	var prioSum float64
@@ -566,6 +674,12 @@ func (ma *mutationArgs) collectArg(arg Arg, ctx *ArgCtx) {
 	ma.args = append(ma.args, mutationArg{arg, *ctx, ma.prioSum})
 }
 
+func (ma *mutationArgs) chooseArgRandomly(r *rand.Rand) (Arg, ArgCtx) {
+	idx := r.Intn(len(ma.args))
+	arg := ma.args[idx]
+	return arg.arg, arg.ctx
+}
+
 func (ma *mutationArgs) chooseArg(r *rand.Rand) (Arg, ArgCtx) {
 	goal := ma.prioSum * r.Float64()
 	chosenIdx := sort.Search(len(ma.args), func(i int) bool { return ma.args[i].priority >= goal })
@@ -0,0 +1,64 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestMutateWithObserverAnalysis(t *testing.T) {
+	target, rs, iters := initTest(t)
+	ct := target.DefaultChoiceTable()
+	var corpus []*Prog
+	for i := 0; i < 10; i++ {
+		corpus = append(corpus, target.Generate(rs, 10, ct))
+	}
+	var total [MutatorCount]MutatorAnalysis
+	for i := 0; i < iters; i++ {
+		p := target.Generate(rs, 10, ct)
+		observer, analysis := p.MutateWithObserver(rs, 10, ct, nil, corpus, DefaultMutatorWeights)
+		for idx, count := range observer {
+			a := analysis[idx]
+			if got := a.NSuccess + a.NFails; got != uint64(count) {
+				t.Fatalf("mutator %v: applied %v times, analysed %v times", idx, count, got)
+			}
+			total[idx].NSuccess += a.NSuccess
+			total[idx].NFails += a.NFails
+		}
+		if len(analysis) != len(observer) {
+			t.Fatalf("analysis %v does not match observer %v", analysis, observer)
+		}
+	}
+	for idx, a := range total {
+		if a.NSuccess == 0 && DefaultMutatorWeights[idx] > 0.01 && iters > 100 {
+			t.Errorf("mutator %v never succeeded: %+v", MutatorIndex(idx), a)
+		}
+	}
+}
+
+func TestMutateWithMutators(t *testing.T) {
+	target, rs, iters := initTest(t)
+	ct := target.DefaultChoiceTable()
+	var corpus []*Prog
+	for i := 0; i < 10; i++ {
+		corpus = append(corpus, target.Generate(rs, 10, ct))
+	}
+	for i := 0; i < iters; i++ {
+		p0 := target.Generate(rs, 10, ct)
+		p1 := p0.Clone()
+		seed := rs.Int63()
+		// The analysis does not affect the mutations.
+		observer0, _ := p0.MutateWithObserver(rand.NewSource(seed), 10, ct, nil, corpus, DefaultMutatorWeights)
+		observer1 := p1.MutateWithMutators(rand.NewSource(seed), 10, ct, nil, corpus, DefaultMutatorWeights)
+		if !reflect.DeepEqual(observer0, observer1) {
+			t.Fatalf("observers differ: %v vs %v", observer0, observer1)
+		}
+		if data0, data1 := p0.Serialize(), p1.Serialize(); !bytes.Equal(data0, data1) {
+			t.Fatalf("programs differ:\n%s\nvs\n%s", data0, data1)
+		}
+	}
+}
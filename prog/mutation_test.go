@@ -10,6 +10,7 @@ import (
 	"testing"
 
 	"github.com/google/syzkaller/pkg/testutil"
+	"github.com/google/syzkaller/profiler"
 )
 
 func TestMutationFlags(t *testing.T) {
@@ -147,11 +148,12 @@ func TestMutateArgument(t *testing.T) {
 			for i := 0; i < 1e5; i++ {
 				p1 := p.Clone()
 				ctx := &mutator{
-					p:      p1,
-					r:      newRand(p1.Target, rs),
-					ncalls: 2 * len(p.Calls),
-					ct:     ct,
-					corpus: nil,
+					p:        p1,
+					r:        newRand(p1.Target, rs),
+					ncalls:   2 * len(p.Calls),
+					ct:       ct,
+					corpus:   nil,
+					ablation: profiler.Ablation(),
 				}
 				ctx.mutateArg()
 				data1 := p1.Serialize()
@@ -174,11 +176,12 @@ func TestSizeMutateArg(t *testing.T) {
 		for it := 0; it < 10; it++ {
 			p1 := p.Clone()
 			ctx := &mutator{
-				p:      p1,
-				r:      r,
-				ncalls: 2 * len(p.Calls),
-				ct:     ct,
-				corpus: nil,
+				p:        p1,
+				r:        r,
+				ncalls:   2 * len(p.Calls),
+				ct:       ct,
+				corpus:   nil,
+				ablation: profiler.Ablation(),
 			}
 			ctx.mutateArg()
 			ForeachArg(p.Calls[0], func(arg Arg, ctx *ArgCtx) {
@@ -221,7 +224,7 @@ func TestMutateRandom(t *testing.T) {
 			// There is a chance that mutation will produce the same program.
 			// So we check that at least 1 out of 20 mutations actually change the program.
 			for try := 0; try < 20; try++ {
-				p1.Mutate(rs, 10, ct, nil, nil)
+				p1.Mutate(rs, 10, ct, nil, nil, DefaultMutatorWeights)
 				data := p.Serialize()
 				if !bytes.Equal(data0, data) {
 					t.Fatalf("program changed after mutate\noriginal:\n%s\n\nnew:\n%s\n",
@@ -251,7 +254,7 @@ func TestMutateCorpus(t *testing.T) {
 	}
 	for i := 0; i < iters; i++ {
 		p1 := target.Generate(rs, 10, ct)
-		p1.Mutate(rs, 10, ct, nil, corpus)
+		p1.Mutate(rs, 10, ct, nil, corpus, DefaultMutatorWeights)
 	}
 }
 
@@ -383,7 +386,7 @@ func BenchmarkMutate(b *testing.B) {
 	b.RunParallel(func(pb *testing.PB) {
 		rs := rand.NewSource(0)
 		for pb.Next() {
-			p.Clone().Mutate(rs, progLen, ct, nil, nil)
+			p.Clone().Mutate(rs, progLen, ct, nil, nil, DefaultMutatorWeights)
 		}
 	})
 }
@@ -422,7 +425,7 @@ func runMutationTests(t *testing.T, tests [][2]string, valid bool) {
 			}
 			for i := 0; i < iters; i++ {
 				p1 := p.Clone()
-				p1.Mutate(rs, len(goal.Calls), ct, nil, nil)
+				p1.Mutate(rs, len(goal.Calls), ct, nil, nil, DefaultMutatorWeights)
 				data1 := p1.Serialize()
 				if bytes.Equal(want, data1) {
 					if !valid {
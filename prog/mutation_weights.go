@@ -0,0 +1,149 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/syzkaller/profiler"
+)
+
+type MutatorIndex int
+
+const (
+	MutatorIndexSquashAny MutatorIndex = iota
+	MutatorIndexSplice
+	MutatorIndexInsertCall
+	MutatorIndexMutateArg
+	MutatorIndexRemoveCall
+	MutatorIndexRewireResources
+	MutatorIndexCrossover
+	MutatorCount
+)
+
+var mutatorNames = [MutatorCount]string{
+	MutatorIndexSquashAny:  "squash_any",
+	MutatorIndexSplice:     "splice",
+	MutatorIndexInsertCall: "insert_call",
+	MutatorIndexMutateArg:  "mutate_arg",
+	MutatorIndexRemoveCall: "remove_call",
+
+	MutatorIndexRewireResources: "rewire_resources",
+	MutatorIndexCrossover:       "crossover",
+}
+
+func (idx MutatorIndex) String() string {
+	if idx < 0 || idx >= MutatorCount {
+		return fmt.Sprintf("mutator#%d", int(idx))
+	}
+	return mutatorNames[idx]
+}
+
+// MutatorWeights holds the relative probability of each mutator (indexed by MutatorIndex)
+// to be applied on every iteration of Mutate. The weights don't need to sum up to 1.
+// If the chosen mutators keep failing to change the program, Mutate gives up instead of applying others.
+type MutatorWeights [MutatorCount]float64
+
+// DefaultMutatorWeights give the same probabilities as the historical cascade of Mutate:
+// squashAny with 1/5, then splice with 1/100 of the rest, insertCall with 20/31
+// of the rest, mutateArg with 10/11 of the rest and removeCall otherwise.
+// rewireResources and crossover are disabled by default, they can be enabled with mutator_weights.
+var DefaultMutatorWeights = MutatorWeights{
+	MutatorIndexSquashAny:  1.0 / 5,
+	MutatorIndexSplice:     4.0 / 5 * 1 / 100,
+	MutatorIndexInsertCall: 4.0 / 5 * 99 / 100 * 20 / 31,
+	MutatorIndexMutateArg:  4.0 / 5 * 99 / 100 * 11 / 31 * 10 / 11,
+	MutatorIndexRemoveCall: 4.0 / 5 * 99 / 100 * 11 / 31 * 1 / 11,
+
+	MutatorIndexRewireResources: 0,
+	MutatorIndexCrossover:       0,
+}
+
+// ParseMutatorWeights returns DefaultMutatorWeights with the weights of the mutators present
+// in named (e.g. {"splice": 0.004}) replaced by the given values.
+func ParseMutatorWeights(named map[string]float64) (MutatorWeights, error) {
+	weights := DefaultMutatorWeights
+	for name, weight := range named {
+		idx := MutatorIndex(0)
+		for ; idx < MutatorCount; idx++ {
+			if mutatorNames[idx] == name {
+				break
+			}
+		}
+		if idx == MutatorCount {
+			return weights, fmt.Errorf("unknown mutator %q", name)
+		}
+		weights[idx] = weight
+	}
+	if err := weights.Validate(); err != nil {
+		return weights, err
+	}
+	return weights, nil
+}
+
+func (w *MutatorWeights) Validate() error {
+	for idx, weight := range w {
+		if math.IsNaN(weight) || math.IsInf(weight, 0) || weight < 0 {
+			return fmt.Errorf("bad weight %v for mutator %v", weight, MutatorIndex(idx))
+		}
+	}
+	if w.total() == 0 {
+		return fmt.Errorf("all mutator weights are zero")
+	}
+	return nil
+}
+
+func (w *MutatorWeights) total() float64 {
+	total := 0.0
+	for _, weight := range w {
+		total += weight
+	}
+	return total
+}
+
+// choose returns a random mutator with probability proportional to its weight.
+// The weights must not all be zero.
+func (w *MutatorWeights) choose(r *randGen) MutatorIndex {
+	x := r.Float64() * w.total()
+	last := MutatorIndex(-1)
+	for idx, weight := range w {
+		if weight == 0 {
+			continue
+		}
+		if x < weight {
+			return MutatorIndex(idx)
+		}
+		x -= weight
+		last = MutatorIndex(idx)
+	}
+	// We can get here only due to floating point rounding.
+	return last
+}
+
+// WithoutDisabledMutators returns the weights with the mutators disabled via ablation set to 0,
+// disabled mutators are never chosen.
+// NOTE: mutateArg mutator also uses p.insertBefore which will not
+// be disabled even with the ablation flag for insert call mutator set.
+// NOTE: splice uses p.removeCall (also called by the removeCall, insertCall
+// and mutateArg mutators) if the resulting program is too long.
+// I decided not to disable this call even if the tag disable_removecall
+// is set. I will however not count in the mutator stats
+func (w MutatorWeights) WithoutDisabledMutators(ablation *profiler.AblationConfiguration) MutatorWeights {
+	for idx, disabled := range map[MutatorIndex]bool{
+		MutatorIndexSquashAny:  ablation.DisableMutatorSquashAny,
+		MutatorIndexSplice:     ablation.DisableMutatorSplice,
+		MutatorIndexInsertCall: ablation.DisableMutatorInsertCall,
+		MutatorIndexMutateArg:  ablation.DisableMutatorMutateArg,
+		MutatorIndexRemoveCall: ablation.DisableMutatorRemoveCall,
+
+		MutatorIndexRewireResources: ablation.DisableMutatorRewireResources,
+		MutatorIndexCrossover:       ablation.DisableMutatorCrossover,
+	} {
+		if disabled {
+			w[idx] = 0
+		}
+	}
+	return w
+}
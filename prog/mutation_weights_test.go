@@ -0,0 +1,109 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestDefaultMutatorWeights(t *testing.T) {
+	if err := DefaultMutatorWeights.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if total := DefaultMutatorWeights.total(); math.Abs(total-1) > 1e-9 {
+		t.Fatalf("default weights sum up to %v", total)
+	}
+}
+
+func TestParseMutatorWeights(t *testing.T) {
+	halfSplice := DefaultMutatorWeights
+	halfSplice[MutatorIndexSplice] /= 2
+	onlyInsert := MutatorWeights{MutatorIndexInsertCall: 1}
+	tests := []struct {
+		named  map[string]float64
+		result *MutatorWeights // nil if error is expected
+	}{
+		{nil, &DefaultMutatorWeights},
+		{map[string]float64{"splice": DefaultMutatorWeights[MutatorIndexSplice] / 2}, &halfSplice},
+		{map[string]float64{"squash_any": 0, "splice": 0, "insert_call": 1, "mutate_arg": 0,
+			"remove_call": 0, "rewire_resources": 0, "crossover": 0}, &onlyInsert},
+		{map[string]float64{"squash_any": 0, "splice": 0, "insert_call": 0, "mutate_arg": 0,
+			"remove_call": 0, "rewire_resources": 0, "crossover": 0}, nil},
+		{map[string]float64{"splice": -1}, nil},
+		{map[string]float64{"splice": math.Inf(1)}, nil},
+		{map[string]float64{"foo": 1}, nil},
+	}
+	for i, test := range tests {
+		weights, err := ParseMutatorWeights(test.named)
+		if test.result == nil {
+			if err == nil {
+				t.Errorf("#%v: expected an error for %v", i, test.named)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%v: unexpected error: %v", i, err)
+			continue
+		}
+		if weights != *test.result {
+			t.Errorf("#%v: got %v, want %v", i, weights, *test.result)
+		}
+	}
+}
+
+func TestMutatorWeightsChoose(t *testing.T) {
+	target, rs, _ := initTest(t)
+	r := newRand(target, rs)
+	weights := MutatorWeights{
+		MutatorIndexSplice:     1,
+		MutatorIndexMutateArg:  3,
+		MutatorIndexRemoveCall: 0,
+	}
+	const iters = 10000
+	var counts [MutatorCount]int
+	for i := 0; i < iters; i++ {
+		counts[weights.choose(r)]++
+	}
+	for idx, count := range counts {
+		want := weights[idx] / weights.total() * iters
+		if math.Abs(float64(count)-want) > iters/20 {
+			t.Errorf("mutator %v was chosen %v times, want ~%v", MutatorIndex(idx), count, want)
+		}
+	}
+}
+
+func TestMutateFailingMutators(t *testing.T) {
+	target, rs, iters := initTest(t)
+	ct := target.DefaultChoiceTable()
+	tests := []struct {
+		name    string
+		weights MutatorWeights
+		corpus  bool
+	}{
+		// The program already has ncalls calls, so insertCall always fails.
+		{"insert_call", MutatorWeights{MutatorIndexInsertCall: 1}, true},
+		// There is nothing to take the calls from.
+		{"splice", MutatorWeights{MutatorIndexSplice: 1}, false},
+		{"crossover", MutatorWeights{MutatorIndexCrossover: 1}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var corpus []*Prog
+			if test.corpus {
+				corpus = append(corpus, target.Generate(rs, 10, ct))
+			}
+			for i := 0; i < iters/10; i++ {
+				p := target.Generate(rs, 10, ct)
+				// Mutate must terminate and must not apply the mutators that are not enabled.
+				data := p.Serialize()
+				p.Mutate(rs, len(p.Calls), ct, nil, corpus, test.weights)
+				if mutated := p.Serialize(); !bytes.Equal(data, mutated) {
+					t.Fatalf("the program was mutated:\n%s\n\nmutated:\n%s", data, mutated)
+				}
+			}
+		})
+	}
+}
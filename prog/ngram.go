@@ -0,0 +1,272 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// Call-to-call priorities only capture pairs of calls, while the interesting setup sequences
+// (e.g. socket, bind, listen, accept, write) are often several calls deep. NgramMiner extracts
+// such sequences from corpus programs: an n-gram is a sequence of calls where every call
+// except for the first one consumes a resource produced by an earlier call of the sequence.
+// The calls don't need to be adjacent in the program. The n-grams that occur in several
+// programs serve as templates for generation of new programs (see GenerateFromNgram).
+
+const (
+	NgramMinLen = 3
+	NgramMaxLen = 6
+	// An n-gram becomes a template once it occurs in that many programs.
+	NgramMinCount = 2
+)
+
+// Ngram is a sequence of calls connected by resources.
+type Ngram struct {
+	// Key describes the calls and the resource flow between them,
+	// e.g. "socket() -> r0; bind(r0); accept(r0) -> r1; write(r1)".
+	Key   string
+	Calls []string
+	// Count is the number of programs that contain the sequence.
+	Count int
+	// template is the sequence cut out of one of these programs.
+	template *Prog
+}
+
+// Template returns a program consisting only of the n-gram calls (nil if there is no template yet).
+func (ngram *Ngram) Template() *Prog {
+	if ngram.template == nil {
+		return nil
+	}
+	return ngram.template.Clone()
+}
+
+// NgramMiner accumulates the n-grams of programs, it's not safe for concurrent use.
+type NgramMiner struct {
+	ngrams    map[string]*Ngram
+	templates []*Ngram // n-grams with templates, in the order they got them
+	progs     int
+}
+
+func NewNgramMiner() *NgramMiner {
+	return &NgramMiner{ngrams: make(map[string]*Ngram)}
+}
+
+// Add mines the n-grams of the program.
+func (m *NgramMiner) Add(p *Prog) {
+	m.progs++
+	seen := make(map[string]bool)
+	argCalls := make(map[*ResultArg]int)
+	for i, c := range p.Calls {
+		ForeachArg(c, func(arg Arg, _ *ArgCtx) {
+			if a, ok := arg.(*ResultArg); ok {
+				argCalls[a] = i
+			}
+		})
+	}
+	for _, seq := range ngramSequences(p) {
+		key := ngramKey(p, seq, argCalls)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		ngram := m.ngrams[key]
+		if ngram == nil {
+			ngram = &Ngram{Key: key}
+			for _, idx := range seq {
+				ngram.Calls = append(ngram.Calls, p.Calls[idx].Meta.Name)
+			}
+			m.ngrams[key] = ngram
+		}
+		ngram.Count++
+		if ngram.template == nil && ngram.Count >= NgramMinCount {
+			ngram.template = cutCalls(p, seq)
+			m.templates = append(m.templates, ngram)
+		}
+	}
+}
+
+// Progs returns the number of mined programs.
+func (m *NgramMiner) Progs() int {
+	return m.progs
+}
+
+// Len returns the number of distinct n-grams seen so far.
+func (m *NgramMiner) Len() int {
+	return len(m.ngrams)
+}
+
+// Prune forgets the n-grams that occurred in fewer than minCount programs. It bounds the memory
+// of a long-running miner at the price of missing the n-grams that would become frequent later.
+// The n-grams that already have templates remain available to Choose.
+func (m *NgramMiner) Prune(minCount int) {
+	for key, ngram := range m.ngrams {
+		if ngram.Count < minCount {
+			delete(m.ngrams, key)
+		}
+	}
+}
+
+// Ngrams returns the n-grams that occurred at least minCount times,
+// the most frequent and the longest ones go first.
+func (m *NgramMiner) Ngrams(minCount int) []*Ngram {
+	var res []*Ngram
+	for _, ngram := range m.ngrams {
+		if ngram.Count >= minCount {
+			res = append(res, ngram)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		a, b := res[i], res[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if len(a.Calls) != len(b.Calls) {
+			return len(a.Calls) > len(b.Calls)
+		}
+		return a.Key < b.Key
+	})
+	return res
+}
+
+// Choose returns a random n-gram with a template (nil if there are none).
+// The choice is uniform, so that the rare deep sequences get the same chance
+// as the frequent short ones.
+func (m *NgramMiner) Choose(r *rand.Rand) *Ngram {
+	if len(m.templates) == 0 {
+		return nil
+	}
+	return m.templates[r.Intn(len(m.templates))]
+}
+
+// ngramSequences returns the call index sequences of the program n-grams. For every call
+// the sequence is extended with the following calls that consume resources of the sequence.
+func ngramSequences(p *Prog) [][]int {
+	produced := make([][]*ResultArg, len(p.Calls))
+	consumed := make([][]*ResultArg, len(p.Calls))
+	for i, c := range p.Calls {
+		ForeachArg(c, func(arg Arg, _ *ArgCtx) {
+			a, ok := arg.(*ResultArg)
+			if !ok {
+				return
+			}
+			if len(a.uses) != 0 {
+				produced[i] = append(produced[i], a)
+			}
+			if a.Res != nil {
+				consumed[i] = append(consumed[i], a.Res)
+			}
+		})
+	}
+	var res [][]int
+	for i := range p.Calls {
+		if len(produced[i]) == 0 {
+			continue
+		}
+		seq := []int{i}
+		resources := make(map[*ResultArg]bool)
+		for _, a := range produced[i] {
+			resources[a] = true
+		}
+		for j := i + 1; j < len(p.Calls) && len(seq) < NgramMaxLen; j++ {
+			connected := false
+			for _, a := range consumed[j] {
+				connected = connected || resources[a]
+			}
+			if !connected {
+				continue
+			}
+			seq = append(seq, j)
+			for _, a := range produced[j] {
+				resources[a] = true
+			}
+			if len(seq) >= NgramMinLen {
+				res = append(res, append([]int{}, seq...))
+			}
+		}
+	}
+	return res
+}
+
+// ngramKey formats the calls of the sequence with the resources they pass to each other.
+// argCalls maps the resource arguments of the program to the indices of their calls.
+func ngramKey(p *Prog, seq []int, argCalls map[*ResultArg]int) string {
+	inSeq := make(map[int]bool)
+	for _, idx := range seq {
+		inSeq[idx] = true
+	}
+	// Only the resources consumed by the sequence calls get names.
+	names := make(map[*ResultArg]string)
+	name := func(a *ResultArg) string {
+		if names[a] == "" {
+			names[a] = fmt.Sprintf("r%v", len(names))
+		}
+		return names[a]
+	}
+	var calls []string
+	for _, idx := range seq {
+		c := p.Calls[idx]
+		var ins, outs []string
+		ForeachArg(c, func(arg Arg, _ *ArgCtx) {
+			a, ok := arg.(*ResultArg)
+			if !ok {
+				return
+			}
+			if a.Res != nil && names[a.Res] != "" {
+				ins = append(ins, names[a.Res])
+			}
+			for use := range a.uses {
+				if inSeq[argCalls[use]] {
+					outs = append(outs, name(a))
+					break
+				}
+			}
+		})
+		str := fmt.Sprintf("%v(%v)", c.Meta.Name, strings.Join(ins, ", "))
+		if len(outs) != 0 {
+			str += " -> " + strings.Join(outs, ", ")
+		}
+		calls = append(calls, str)
+	}
+	return strings.Join(calls, "; ")
+}
+
+// cutCalls returns a copy of the program with only the given calls.
+func cutCalls(p *Prog, keep []int) *Prog {
+	p = p.Clone()
+	kept := make(map[int]bool)
+	for _, idx := range keep {
+		kept[idx] = true
+	}
+	for i := len(p.Calls) - 1; i >= 0; i-- {
+		if !kept[i] {
+			p.RemoveCall(i)
+		}
+	}
+	return p
+}
+
+// GenerateFromNgram generates a program with ncalls calls around the calls of the n-gram template.
+func (target *Target) GenerateFromNgram(rs rand.Source, ncalls int, ct *ChoiceTable, ngram *Ngram) *Prog {
+	p := ngram.Template()
+	r := newRand(target, rs)
+	for len(p.Calls) < ncalls {
+		// Most of the calls go after the template, so that they can use its resources.
+		idx := r.biasedRand(len(p.Calls)+1, 5)
+		var c *Call
+		if idx < len(p.Calls) {
+			c = p.Calls[idx]
+		}
+		s := analyze(ct, nil, p, c)
+		p.insertBefore(c, r.generateCall(s, p, idx))
+	}
+	for len(p.Calls) > ncalls {
+		p.RemoveCall(ncalls - 1)
+	}
+	p.sanitizeFix()
+	p.debugValidate()
+	return p
+}
@@ -0,0 +1,107 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestNgramMiner(t *testing.T) {
+	target, rs, iters := initRandomTargetTest(t, "test", "64")
+	progs := []string{`
+r0 = mutate5(&(0x7f0000000000)='./file0\x00', 0x0)
+mutate6(r0, &(0x7f0000000000)="00", 0x1)
+mutate6(r0, &(0x7f0000000000)="01", 0x1)
+`, `
+r0 = mutate5(&(0x7f0000000000)='./file1\x00', 0x0)
+mutate7(&(0x7f0000000000)='123', 0x3)
+mutate6(r0, &(0x7f0000000000)="02", 0x1)
+r1 = mutate5(&(0x7f0000000000)='./file2\x00', 0x0)
+mutate6(r0, &(0x7f0000000000)="03", 0x1)
+mutate6(r1, &(0x7f0000000000)="04", 0x1)
+`}
+	miner := NewNgramMiner()
+	for _, text := range progs {
+		p, err := target.Deserialize([]byte(text), Strict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		miner.Add(p)
+	}
+	if miner.Progs() != len(progs) {
+		t.Fatalf("mined %v programs, want %v", miner.Progs(), len(progs))
+	}
+	ngrams := miner.Ngrams(2)
+	const key = "mutate5() -> r0; mutate6(r0); mutate6(r0)"
+	if len(ngrams) != 1 || ngrams[0].Key != key || ngrams[0].Count != 2 {
+		for _, ngram := range ngrams {
+			t.Logf("%v: %q", ngram.Count, ngram.Key)
+		}
+		t.Fatalf("want a single n-gram %q", key)
+	}
+	// mutate5 -> mutate6 on r1 is too short to be an n-gram.
+	if all := miner.Ngrams(1); len(all) != 1 {
+		for _, ngram := range all {
+			t.Logf("%v: %q", ngram.Count, ngram.Key)
+		}
+		t.Fatalf("got %v n-grams, want 1", len(all))
+	}
+	ngram := miner.Choose(rand.New(rs))
+	if ngram != ngrams[0] {
+		t.Fatalf("chose %v", ngram)
+	}
+	miner.Prune(NgramMinCount + 1)
+	if miner.Len() != 0 {
+		t.Fatalf("%v n-grams left after pruning", miner.Len())
+	}
+	if miner.Choose(rand.New(rs)) != ngram {
+		t.Fatalf("pruning dropped the template")
+	}
+	// The template is cut out of the program where the n-gram got enough occurrences.
+	const template = `r0 = mutate5(&(0x7f0000000000)='./file1\x00', 0x0)
+mutate6(r0, &(0x7f0000000000)="02", 0x1)
+mutate6(r0, &(0x7f0000000000)="03", 0x1)
+`
+	if got, want := string(ngram.Template().Serialize()), template; got != want {
+		t.Fatalf("wrong template:\n%s\nwant:\n%s", got, want)
+	}
+	ct := target.DefaultChoiceTable()
+	for i := 0; i < iters; i++ {
+		p := target.GenerateFromNgram(rs, 10, ct, ngram)
+		if len(p.Calls) != 10 {
+			t.Fatalf("generated %v calls, want 10", len(p.Calls))
+		}
+		if err := p.validate(); err != nil {
+			t.Fatalf("invalid program: %v\n%s", err, p.Serialize())
+		}
+	}
+}
+
+func TestNgramMinerRandom(t *testing.T) {
+	testEachTargetRandom(t, func(t *testing.T, target *Target, rs rand.Source, iters int) {
+		ct := target.DefaultChoiceTable()
+		miner := NewNgramMiner()
+		for i := 0; i < iters; i++ {
+			p := target.Generate(rs, 10, ct)
+			data := p.Serialize()
+			miner.Add(p)
+			if string(data) != string(p.Serialize()) {
+				t.Fatalf("mining changed the program")
+			}
+		}
+		for _, ngram := range miner.Ngrams(NgramMinCount) {
+			if len(ngram.Calls) < NgramMinLen || len(ngram.Calls) > NgramMaxLen {
+				t.Fatalf("bad n-gram length: %q", ngram.Key)
+			}
+			template := ngram.Template()
+			if len(template.Calls) != len(ngram.Calls) {
+				t.Fatalf("template for %q has %v calls", ngram.Key, len(template.Calls))
+			}
+			if err := template.validate(); err != nil {
+				t.Fatalf("invalid template: %v\n%s", err, template.Serialize())
+			}
+		}
+	})
+}
@@ -5,6 +5,7 @@ package prog
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
 	"sort"
 )
@@ -25,9 +26,15 @@ import (
 // constants.
 
 func (target *Target) CalculatePriorities(corpus []*Prog) [][]int32 {
+	return target.CalculatePrioritiesWithPrior(corpus, nil)
+}
+
+// CalculatePrioritiesWithPrior is like CalculatePriorities, but the dynamic component
+// is learned from both the corpus and the prior matrix (see LearnPrioMatrix).
+func (target *Target) CalculatePrioritiesWithPrior(corpus []*Prog, prior *CompactPrioMatrix) [][]int32 {
 	static := target.calcStaticPriorities()
-	if len(corpus) != 0 {
-		dynamic := target.calcDynamicPrio(corpus)
+	if len(corpus) != 0 || prior.progs() != 0 {
+		dynamic := target.calcDynamicPrio(corpus, prior)
 		for i, prios := range dynamic {
 			dst := static[i]
 			for j, p := range prios {
@@ -143,7 +150,132 @@ func noteUsage(uses map[string]map[int]weights, c *Syscall, weight int32, dir Di
 	uses[id][c.ID] = callWeight
 }
 
-func (target *Target) calcDynamicPrio(corpus []*Prog) [][]int32 {
+// PrioMatrix is the dynamic component of the priorities before normalization:
+// Counts[X][Y] is the number of times call Y follows call X in the programs.
+// Calls are referenced by name, so that the matrix can be persisted and shared
+// between fuzzing sessions with different descriptions or sets of enabled calls.
+type PrioMatrix struct {
+	// Number of programs the matrix was learned from.
+	Progs  int                           `json:"progs"`
+	Counts map[string]map[string]float64 `json:"counts"`
+}
+
+// LearnPrioMatrix counts the call pairs in the corpus programs and adds the prior counts on top.
+// The prior is a matrix learned in the past (e.g. saved by the previous run or received from
+// other managers), it fades out as the corpus grows and is ignored once the corpus has at least
+// as many programs as the prior was learned from (see priorWeight).
+func (target *Target) LearnPrioMatrix(corpus []*Prog, prior *PrioMatrix) *PrioMatrix {
+	m := &PrioMatrix{
+		Progs:  len(corpus),
+		Counts: make(map[string]map[string]float64),
+	}
+	for _, p := range corpus {
+		for idx0, c0 := range p.Calls {
+			for _, c1 := range p.Calls[idx0+1:] {
+				m.add(c0.Meta.Name, c1.Meta.Name, 1)
+			}
+		}
+	}
+	if weight := priorWeight(len(corpus), prior.progs()); weight > 0 {
+		for call0, counts := range prior.Counts {
+			for call1, count := range counts {
+				m.add(call0, call1, count*weight)
+			}
+		}
+		m.Progs = prior.Progs
+	}
+	return m
+}
+
+// Merge adds the counts of another matrix (e.g. learned by another manager) to the matrix.
+func (m *PrioMatrix) Merge(other *PrioMatrix) {
+	if other == nil {
+		return
+	}
+	if m.Counts == nil {
+		m.Counts = make(map[string]map[string]float64)
+	}
+	for call0, counts := range other.Counts {
+		for call1, count := range counts {
+			m.add(call0, call1, count)
+		}
+	}
+	m.Progs += other.Progs
+}
+
+func (m *PrioMatrix) add(call0, call1 string, count float64) {
+	counts := m.Counts[call0]
+	if counts == nil {
+		counts = make(map[string]float64)
+		m.Counts[call0] = counts
+	}
+	counts[call1] += count
+}
+
+func (m *PrioMatrix) progs() int {
+	if m == nil {
+		return 0
+	}
+	return m.Progs
+}
+
+// CompactPrioMatrix is a PrioMatrix resolved for a target: the calls are referenced by Syscall.ID
+// and only the non-zero counts are stored. It's the form the prior is used and sent to the fuzzers in.
+type CompactPrioMatrix struct {
+	Progs  int
+	Counts []PrioCount
+}
+
+// PrioCount is the number of times call Call1 follows call Call0 in the programs.
+type PrioCount struct {
+	Call0 int
+	Call1 int
+	Count float64
+}
+
+// CompactPrioMatrix converts the matrix for the target, the unknown calls are dropped.
+func (target *Target) CompactPrioMatrix(m *PrioMatrix) *CompactPrioMatrix {
+	if m.progs() == 0 {
+		return nil
+	}
+	res := &CompactPrioMatrix{Progs: m.Progs}
+	for call0, counts := range m.Counts {
+		c0 := target.SyscallMap[call0]
+		if c0 == nil {
+			continue
+		}
+		for call1, count := range counts {
+			if c1 := target.SyscallMap[call1]; c1 != nil && count != 0 {
+				res.Counts = append(res.Counts, PrioCount{c0.ID, c1.ID, count})
+			}
+		}
+	}
+	sort.Slice(res.Counts, func(i, j int) bool {
+		if res.Counts[i].Call0 != res.Counts[j].Call0 {
+			return res.Counts[i].Call0 < res.Counts[j].Call0
+		}
+		return res.Counts[i].Call1 < res.Counts[j].Call1
+	})
+	return res
+}
+
+func (m *CompactPrioMatrix) progs() int {
+	if m == nil {
+		return 0
+	}
+	return m.Progs
+}
+
+// priorWeight returns the weight of the prior learned from priorProgs programs
+// for a corpus of corpusProgs programs.
+func priorWeight(corpusProgs, priorProgs int) float64 {
+	if priorProgs == 0 {
+		return 0
+	}
+	return 1 - float64(corpusProgs)/float64(priorProgs)
+}
+
+func (target *Target) calcDynamicPrio(corpus []*Prog, prior *CompactPrioMatrix) [][]int32 {
 	prios := make([][]int32, len(target.Syscalls))
 	for i := range prios {
 		prios[i] = make([]int32, len(target.Syscalls))
@@ -155,6 +287,13 @@ func (target *Target) calcDynamicPrio(corpus []*Prog) [][]int32 {
 			}
 		}
 	}
+	if weight := priorWeight(len(corpus), prior.progs()); weight > 0 {
+		const maxCount = math.MaxInt32 / prioHigh
+		for _, pc := range prior.Counts {
+			count := float64(prios[pc.Call0][pc.Call1]) + math.Round(pc.Count*weight)
+			prios[pc.Call0][pc.Call1] = int32(math.Min(count, maxCount))
+		}
+	}
 	normalizePrio(prios)
 	return prios
 }
@@ -189,6 +328,12 @@ type ChoiceTable struct {
 }
 
 func (target *Target) BuildChoiceTable(corpus []*Prog, enabled map[*Syscall]bool) *ChoiceTable {
+	return target.BuildChoiceTableWithPrior(corpus, enabled, nil)
+}
+
+// BuildChoiceTableWithPrior is like BuildChoiceTable, but uses CalculatePrioritiesWithPrior.
+func (target *Target) BuildChoiceTableWithPrior(corpus []*Prog, enabled map[*Syscall]bool,
+	prior *CompactPrioMatrix) *ChoiceTable {
 	if enabled == nil {
 		enabled = make(map[*Syscall]bool)
 		for _, c := range target.Syscalls {
@@ -225,7 +370,7 @@ func (target *Target) BuildChoiceTable(corpus []*Prog, enabled map[*Syscall]bool
 			}
 		}
 	}
-	prios := target.CalculatePriorities(corpus)
+	prios := target.CalculatePrioritiesWithPrior(corpus, prior)
 	run := make([][]int32, len(target.Syscalls))
 	// ChoiceTable.runs[][] contains cumulated sum of weighted priority numbers.
 	// This helps in quick binary search with biases when generating programs.
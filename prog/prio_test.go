@@ -94,3 +94,49 @@ func TestPrioDeterminism(t *testing.T) {
 		}
 	}
 }
+
+func TestPrioMatrix(t *testing.T) {
+	target, rs, _ := initTest(t)
+	ct := target.DefaultChoiceTable()
+	var corpus []*Prog
+	for i := 0; i < 100; i++ {
+		corpus = append(corpus, target.Generate(rs, 10, ct))
+	}
+	m := target.LearnPrioMatrix(corpus, nil)
+	if m.Progs != len(corpus) {
+		t.Fatalf("learned from %v programs, want %v", m.Progs, len(corpus))
+	}
+	// The prior learned from the corpus must give the same priorities as the corpus itself.
+	want := target.CalculatePriorities(corpus)
+	if got := target.CalculatePrioritiesWithPrior(nil, target.CompactPrioMatrix(m)); !reflect.DeepEqual(got, want) {
+		t.Fatal("priorities calculated from the prior differ from the corpus priorities")
+	}
+	// The prior fades out as the corpus grows.
+	half := target.LearnPrioMatrix(corpus[:50], m)
+	if half.Progs != m.Progs {
+		t.Fatalf("half corpus with the prior: %v programs, want %v", half.Progs, m.Progs)
+	}
+	full := target.LearnPrioMatrix(corpus, m)
+	if !reflect.DeepEqual(full, m) {
+		t.Fatal("the prior is not ignored for the full corpus")
+	}
+	// Unknown calls are ignored.
+	m.Merge(&PrioMatrix{Progs: 1, Counts: map[string]map[string]float64{"foo": {"bar": 1e6}}})
+	if m.Progs != len(corpus)+1 {
+		t.Fatalf("merged matrix has %v programs, want %v", m.Progs, len(corpus)+1)
+	}
+	compact := target.CompactPrioMatrix(m)
+	if compact.Progs != m.Progs {
+		t.Fatalf("compact matrix has %v programs, want %v", compact.Progs, m.Progs)
+	}
+	for _, pc := range compact.Counts {
+		if want := m.Counts[target.Syscalls[pc.Call0].Name][target.Syscalls[pc.Call1].Name]; pc.Count != want {
+			t.Fatalf("compact count %+v, want %v", pc, want)
+		}
+	}
+	// The prior fades out the same way without the intermediate matrix.
+	want = target.calcDynamicPrio(nil, target.CompactPrioMatrix(target.LearnPrioMatrix(corpus[:50], m)))
+	if got := target.calcDynamicPrio(corpus[:50], compact); !reflect.DeepEqual(got, want) {
+		t.Fatal("the compact prior fades out differently")
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+// resourceRef is a resource argument of the call with the index call.
+type resourceRef struct {
+	arg  *ResultArg
+	call int
+}
+
+// resourceArgs returns the resource arguments of the program calls in the program order:
+// the ones that produce resources (including return values) and the ones that consume them.
+// Inout arguments are both producers and consumers.
+func (p *Prog) resourceArgs() (producers, consumers []resourceRef) {
+	for i, c := range p.Calls {
+		ForeachArg(c, func(arg Arg, _ *ArgCtx) {
+			a, ok := arg.(*ResultArg)
+			if !ok {
+				return
+			}
+			if a.Dir() != DirIn {
+				producers = append(producers, resourceRef{a, i})
+			}
+			if a.Dir() != DirOut && a != c.Ret {
+				consumers = append(consumers, resourceRef{a, i})
+			}
+		})
+	}
+	return
+}
+
+// rewireResources changes the producer-consumer relations of the program resources,
+// rather than the resource values. Races and use-after-free bugs depend on such relations
+// (e.g. two calls operate on the same fd), but random resource choice rarely builds them.
+// It either makes a resource argument use another compatible resource produced by an earlier
+// call (preferring the resources that are already in use, so that the calls share them),
+// or moves a producer call in front of a consumer that gets no resource from any call.
+func (ctx *mutator) rewireResources() bool {
+	producers, consumers := ctx.p.resourceArgs()
+	if len(producers) == 0 || len(consumers) == 0 {
+		return false
+	}
+	if ctx.r.bin() {
+		return ctx.shareResource(producers, consumers) || ctx.moveProducer(producers, consumers)
+	}
+	return ctx.moveProducer(producers, consumers) || ctx.shareResource(producers, consumers)
+}
+
+func (ctx *mutator) shareResource(producers, consumers []resourceRef) bool {
+	p, r := ctx.p, ctx.r
+	for _, i := range r.Perm(len(consumers)) {
+		cons := consumers[i]
+		if ctx.noMutate[p.Calls[cons.call].Meta.ID] {
+			continue
+		}
+		var candidates, shared []*ResultArg
+		for _, prod := range producers {
+			if prod.call >= cons.call || prod.arg == cons.arg.Res ||
+				!ctx.compatibleResource(cons.arg, prod.arg) {
+				continue
+			}
+			candidates = append(candidates, prod.arg)
+			if len(prod.arg.uses) != 0 {
+				shared = append(shared, prod.arg)
+			}
+		}
+		if len(shared) != 0 && !r.oneOf(3) {
+			candidates = shared
+		}
+		if len(candidates) == 0 {
+			continue
+		}
+		res := candidates[r.Intn(len(candidates))]
+		replaceResultArg(cons.arg, MakeResultArg(cons.arg.Type(), cons.arg.Dir(), res, 0))
+		return true
+	}
+	return false
+}
+
+func (ctx *mutator) moveProducer(producers, consumers []resourceRef) bool {
+	p, r := ctx.p, ctx.r
+	producerCall := make(map[*ResultArg]int, len(producers))
+	for _, prod := range producers {
+		producerCall[prod.arg] = prod.call
+	}
+	for _, i := range r.Perm(len(consumers)) {
+		cons := consumers[i]
+		if cons.arg.Res != nil || ctx.noMutate[p.Calls[cons.call].Meta.ID] {
+			continue
+		}
+		for _, j := range r.Perm(len(producers)) {
+			prod := producers[j]
+			if prod.call <= cons.call || !ctx.compatibleResource(cons.arg, prod.arg) ||
+				!p.canMoveCall(prod.call, cons.call, producerCall) {
+				continue
+			}
+			p.moveCall(prod.call, cons.call)
+			replaceResultArg(cons.arg, MakeResultArg(cons.arg.Type(), cons.arg.Dir(), prod.arg, 0))
+			return true
+		}
+	}
+	return false
+}
+
+func (ctx *mutator) compatibleResource(cons, prod *ResultArg) bool {
+	return ctx.p.Target.isCompatibleResource(cons.Type().(*ResourceType).Desc.Name, prod.Type().Name())
+}
+
+// canMoveCall returns whether the call with index from can be moved to the index to (to < from),
+// i.e. whether all resources the call consumes are produced before the index to.
+func (p *Prog) canMoveCall(from, to int, producerCall map[*ResultArg]int) bool {
+	ok := true
+	ForeachArg(p.Calls[from], func(arg Arg, ctx *ArgCtx) {
+		if a, isRes := arg.(*ResultArg); isRes && a.Res != nil && producerCall[a.Res] >= to {
+			ok = false
+			ctx.Stop = true
+		}
+	})
+	return ok
+}
+
+// moveCall moves the call with index from to the index to (to < from).
+func (p *Prog) moveCall(from, to int) {
+	c := p.Calls[from]
+	copy(p.Calls[to+1:from+1], p.Calls[to:from])
+	p.Calls[to] = c
+}
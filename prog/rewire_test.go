@@ -0,0 +1,91 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestRewireResources(t *testing.T) {
+	target, rs, _ := initRandomTargetTest(t, "test", "64")
+	tests := [][2]string{
+		// Use the resource produced by an earlier call.
+		{`
+r0 = mutate5(&(0x7f0000000000)='./file0\x00', 0x0)
+mutate6(0xffffffffffffffff, &(0x7f0000000000)="00", 0x1)
+`, `
+r0 = mutate5(&(0x7f0000000000)='./file0\x00', 0x0)
+mutate6(r0, &(0x7f0000000000)="00", 0x1)
+`},
+		// Share the resource that is already in use.
+		{`
+r0 = mutate5(&(0x7f0000000000)='./file0\x00', 0x0)
+r1 = mutate5(&(0x7f0000000000)='./file1\x00', 0x0)
+mutate6(r0, &(0x7f0000000000)="00", 0x1)
+mutate6(r1, &(0x7f0000000000)="00", 0x1)
+`, `
+r0 = mutate5(&(0x7f0000000000)='./file0\x00', 0x0)
+mutate5(&(0x7f0000000000)='./file1\x00', 0x0)
+mutate6(r0, &(0x7f0000000000)="00", 0x1)
+mutate6(r0, &(0x7f0000000000)="00", 0x1)
+`},
+		// Move the producer in front of the consumer.
+		{`
+mutate6(0xffffffffffffffff, &(0x7f0000000000)="00", 0x1)
+r0 = mutate5(&(0x7f0000000000)='./file0\x00', 0x0)
+mutate6(r0, &(0x7f0000000000)="01", 0x1)
+`, `
+r0 = mutate5(&(0x7f0000000000)='./file0\x00', 0x0)
+mutate6(r0, &(0x7f0000000000)="00", 0x1)
+mutate6(r0, &(0x7f0000000000)="01", 0x1)
+`},
+	}
+	for ti, test := range tests {
+		test := test
+		t.Run(fmt.Sprint(ti), func(t *testing.T) {
+			p, err := target.Deserialize([]byte(test[0]), Strict)
+			if err != nil {
+				t.Fatal(err)
+			}
+			goal, err := target.Deserialize([]byte(test[1]), Strict)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := goal.Serialize()
+			r := newRand(target, rs)
+			for i := 0; i < 1e3; i++ {
+				p1 := p.Clone()
+				ctx := &mutator{p: p1, r: r}
+				if !ctx.rewireResources() {
+					t.Fatalf("failed to rewire:\n%s", test[0])
+				}
+				if err := p1.validate(); err != nil {
+					t.Fatalf("invalid program after rewiring: %v\n%s", err, p1.Serialize())
+				}
+				if bytes.Equal(want, p1.Serialize()) {
+					return
+				}
+			}
+			t.Fatalf("failed to achieve goal, original:%s\ngoal:%s", test[0], test[1])
+		})
+	}
+}
+
+func TestRewireResourcesRandom(t *testing.T) {
+	testEachTargetRandom(t, func(t *testing.T, target *Target, rs rand.Source, iters int) {
+		ct := target.DefaultChoiceTable()
+		r := newRand(target, rs)
+		for i := 0; i < iters; i++ {
+			p := target.Generate(rs, 20, ct)
+			ctx := &mutator{p: p, r: r}
+			ctx.rewireResources()
+			if err := p.validate(); err != nil {
+				t.Fatalf("invalid program after rewiring: %v\n%s", err, p.Serialize())
+			}
+		}
+	})
+}
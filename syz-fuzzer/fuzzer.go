@@ -1,5 +1,3 @@
-//go:build !profiling
-
 // Copyright 2015 syzkaller project authors. All rights reserved.
 // Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
 
@@ -7,6 +5,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"math/rand"
@@ -15,6 +14,7 @@ import (
 	"os"
 	"runtime"
 	"runtime/debug"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -27,8 +27,11 @@ import (
 	"github.com/google/syzkaller/pkg/ipc/ipcconfig"
 	"github.com/google/syzkaller/pkg/log"
 	"github.com/google/syzkaller/pkg/osutil"
+	"github.com/google/syzkaller/pkg/profevent"
+	"github.com/google/syzkaller/pkg/replay"
 	"github.com/google/syzkaller/pkg/rpctype"
 	"github.com/google/syzkaller/pkg/tool"
+	"github.com/google/syzkaller/profiler"
 	"github.com/google/syzkaller/prog"
 	_ "github.com/google/syzkaller/sys"
 	"github.com/google/syzkaller/sys/targets"
@@ -41,7 +44,7 @@ type FuzzerTool struct {
 	fuzzer            *fuzzer.Fuzzer
 	procs             []*Proc
 	gate              *ipc.Gate
-	manager           *rpctype.RPCClient
+	manager           *rpctype.StreamConn
 	target            *prog.Target
 	triagedCandidates uint32
 	timeouts          targets.Timeouts
@@ -51,6 +54,20 @@ type FuzzerTool struct {
 
 	bufferTooSmall uint64
 	resetAccState  bool
+
+	// Profiling events waiting to be sent to the manager on the next poll.
+	profEvents *profevent.Buffer
+	// Set only in the deterministic mode.
+	replay *replay.Recorder
+	// Seed of the randomness of procs.
+	procSeed int64
+	// When the seed scheduler energies were last sent to the manager.
+	lastSeedEnergy time.Time
+	// The coverage filter procs use: its generation << 1 | whether it's enabled.
+	// Procs restart their executors when the generation changes, so that they map the new bitmap.
+	coverFilter      atomic.Uint64
+	coverFilterMu    sync.Mutex
+	coverFilterEpoch int
 }
 
 type OutputType int
@@ -62,6 +79,14 @@ const (
 	OutputFile
 )
 
+// rateOrDefault maps an unset scheduling rate to 0, which stands for the default in fuzzer.SchedulingPolicy.
+func rateOrDefault(rate *float64) float64 {
+	if rate == nil {
+		return 0
+	}
+	return *rate
+}
+
 func createIPCConfig(features *host.Features, config *ipc.Config) {
 	if features[host.FeatureExtraCoverage].Enabled {
 		config.Flags |= ipc.FlagExtraCover
@@ -99,6 +124,14 @@ func createIPCConfig(features *host.Features, config *ipc.Config) {
 // It coincides with prog.MaxPids.
 const gateSize = prog.MaxPids
 
+// Maximum number of profiling events sent to the manager in a single poll,
+// events in excess are dropped (this mostly affects bursts of new PC events).
+const maxProfilingEvents = 10000
+
+// The seed scheduler energies and the metadata of the corpus programs
+// are sent to the manager only this often.
+const seedEnergyPeriod = time.Minute
+
 // TODO: split into smaller methods.
 // nolint: funlen, gocyclo
 func main() {
@@ -166,9 +199,10 @@ func main() {
 	machineInfo, modules := collectMachineInfos(target)
 
 	log.Logf(0, "dialing manager at %v", *flagManager)
-	manager, err := rpctype.NewRPCClient(*flagManager, timeouts.Scale)
+	pushes := new(ManagerPushes)
+	manager, err := rpctype.DialStream(*flagManager, timeouts.Scale, "Fuzzer", pushes)
 	if err != nil {
-		log.SyzFatalf("failed to create an RPC client: %v ", err)
+		log.SyzFatalf("failed to connect to the manager: %v ", err)
 	}
 
 	log.Logf(1, "connecting to manager...")
@@ -185,10 +219,9 @@ func main() {
 	if err != nil {
 		log.SyzFatalf("%v", err)
 	}
+	profiler.SetAblation(r.Ablation)
 	if r.CoverFilterBitmap != nil {
-		if err := osutil.WriteFile("syz-cover-bitmap", r.CoverFilterBitmap); err != nil {
-			log.SyzFatalf("failed to write syz-cover-bitmap: %v", err)
-		}
+		writeCoverFilterBitmap(r.CoverFilterBitmap)
 	}
 	if r.CheckResult == nil {
 		checkArgs.gitRevision = r.GitRevision
@@ -226,23 +259,53 @@ func main() {
 		runTest(target, manager, *flagName, config.Executor)
 		return
 	}
-	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	seed := time.Now().UnixNano()
+	if r.Deterministic {
+		seed = r.Seed
+	}
+	rnd := rand.New(rand.NewSource(seed))
 	calls := make(map[*prog.Syscall]bool)
 	for _, id := range r.CheckResult.EnabledCalls[sandbox] {
 		calls[target.Syscalls[id]] = true
 	}
+	profEvents := profevent.NewBuffer(maxProfilingEvents)
+	corpusObj := corpus.NewCorpus(context.Background())
+	var recorder *replay.Recorder
+	if r.Deterministic {
+		log.Logf(0, "deterministic mode, seed %v", seed)
+		recorder = newReplayRecorder(target, seed, calls, r.NoMutateCalls)
+		corpusObj = recordCorpus(recorder)
+	}
+	if err := corpusObj.SetSeedSchedule(r.SeedSchedule); err != nil {
+		log.SyzFatalf("%v", err)
+	}
 	fuzzerObj := fuzzer.NewFuzzer(context.Background(), &fuzzer.Config{
-		Corpus:         corpus.NewCorpus(context.Background()),
-		Coverage:       config.Flags&ipc.FlagSignal > 0,
-		FaultInjection: r.CheckResult.Features[host.FeatureFault].Enabled,
-		Comparisons:    r.CheckResult.Features[host.FeatureComparisons].Enabled,
-		Collide:        execOpts.Flags&ipc.FlagThreaded > 0,
-		EnabledCalls:   calls,
-		NoMutateCalls:  r.NoMutateCalls,
-		LeakChecking:   r.CheckResult.Features[host.FeatureLeak].Enabled,
-		FetchRawCover:  *flagRawCover,
-		MinCandidates:  uint(*flagProcs * 2),
-		NewInputs:      make(chan corpus.NewInput),
+		Corpus:              corpusObj,
+		Coverage:            config.Flags&ipc.FlagSignal > 0,
+		FaultInjection:      r.CheckResult.Features[host.FeatureFault].Enabled,
+		Comparisons:         r.CheckResult.Features[host.FeatureComparisons].Enabled,
+		Collide:             execOpts.Flags&ipc.FlagThreaded > 0,
+		EnabledCalls:        calls,
+		NoMutateCalls:       r.NoMutateCalls,
+		LeakChecking:        r.CheckResult.Features[host.FeatureLeak].Enabled,
+		FetchRawCover:       *flagRawCover,
+		MinCandidates:       uint(*flagProcs * 2),
+		NewInputs:           make(chan corpus.NewInput),
+		Profiling:           r.Profiling,
+		ProfilingEvents:     profEvents.Add,
+		LogNewPCs:           r.LogNewPCs,
+		GenerateProbability: r.GenerateProbability,
+		Replay:              recorder,
+		Policy: fuzzer.SchedulingPolicy{
+			MutateRate:      rateOrDefault(r.Scheduling.MutateRate),
+			SmashMutations:  r.Scheduling.SmashMutations,
+			FaultInjections: r.Scheduling.FaultInjections,
+			HintsRate:       rateOrDefault(r.Scheduling.HintsRate),
+			NgramRate:       r.Scheduling.NgramRate,
+			Adaptive:        r.Scheduling.Adaptive,
+		},
+		ValueProfile: r.ValueProfile,
+		PrioPrior:    r.Prios,
 	}, rnd, target)
 
 	fuzzerTool := &FuzzerTool{
@@ -255,6 +318,9 @@ func main() {
 		config:        config,
 		checkResult:   r.CheckResult,
 		resetAccState: *flagResetAccState,
+		profEvents:    profEvents,
+		replay:        recorder,
+		procSeed:      seed,
 	}
 	fuzzerObj.Config.Logf = func(level int, msg string, args ...interface{}) {
 		// Log 0 messages are most important: send them directly to syz-manager.
@@ -268,6 +334,7 @@ func main() {
 			log.Logf(0, "fuzzer: "+msg, args...)
 		}
 	}
+	pushes.tool.Store(fuzzerTool)
 	fuzzerTool.gate = ipc.NewGate(gateSize,
 		fuzzerTool.useBugFrames(r, *flagProcs))
 	for needCandidates, more := true, true; more; needCandidates = false {
@@ -277,8 +344,9 @@ func main() {
 		log.Logf(0, "fetching corpus: %v, signal %v/%v (executing program)",
 			stat.Progs, stat.Signal, stat.MaxSignal)
 	}
+	fuzzerTool.coverFilterEpoch = r.CoverFilterEpoch
 	if r.CoverFilterBitmap != nil {
-		execOpts.Flags |= ipc.FlagEnableCoverageFilter
+		fuzzerTool.coverFilter.Store(1)
 	}
 
 	log.Logf(0, "starting %v fuzzer processes", *flagProcs)
@@ -294,9 +362,42 @@ func main() {
 	for i := 0; i < *flagProcs*2; i++ {
 		go fuzzerTool.sendInputsWorker(fuzzerObj.Config.NewInputs)
 	}
+
+	fuzzerTool.logAblation()
 	fuzzerTool.pollLoop()
 }
 
+func newReplayRecorder(target *prog.Target, seed int64, calls map[*prog.Syscall]bool,
+	noMutateCalls map[int]bool) *replay.Recorder {
+	cfg := &replay.Config{
+		OS:   target.OS,
+		Arch: target.Arch,
+		Seed: seed,
+	}
+	for call := range calls {
+		cfg.EnabledCalls = append(cfg.EnabledCalls, call.Name)
+	}
+	for id := range noMutateCalls {
+		cfg.NoMutateCalls = append(cfg.NoMutateCalls, target.Syscalls[id].Name)
+	}
+	sort.Strings(cfg.EnabledCalls)
+	sort.Strings(cfg.NoMutateCalls)
+	return replay.NewRecorder(cfg)
+}
+
+// recordCorpus returns a corpus that records new programs in the order they are added.
+func recordCorpus(recorder *replay.Recorder) *corpus.Corpus {
+	updates := make(chan corpus.NewItemEvent)
+	go func() {
+		for ev := range updates {
+			if !ev.Exists {
+				recorder.AddedToCorpus(ev.ProgData)
+			}
+		}
+	}()
+	return corpus.NewMonitoredCorpus(context.Background(), updates)
+}
+
 func collectMachineInfos(target *prog.Target) ([]byte, []host.KernelModule) {
 	machineInfo, err := host.CollectMachineInfo()
 	if err != nil {
@@ -388,28 +489,115 @@ func (tool *FuzzerTool) pollLoop() {
 
 func (tool *FuzzerTool) poll(needCandidates bool, stats map[string]uint64) bool {
 	fuzzer := tool.fuzzer
+	events, dropped := tool.profEvents.Drain()
+	if dropped != 0 {
+		log.Logf(0, "dropped %v profiling events", dropped)
+	}
 	a := &rpctype.PollArgs{
-		Name:           tool.name,
-		NeedCandidates: needCandidates,
-		MaxSignal:      fuzzer.Cover.GrabNewSignal().Serialize(),
-		Stats:          stats,
+		Name:            tool.name,
+		NeedCandidates:  needCandidates,
+		MaxSignal:       fuzzer.Cover.GrabNewSignal().Serialize(),
+		Stats:           stats,
+		ProfilingEvents: events,
+		MutatorWeights:  fuzzer.Stats().MutatorWeights,
+	}
+	if tool.replay != nil {
+		a.ReplayRecords = tool.replay.Drain()
+	}
+	if time.Since(tool.lastSeedEnergy) > seedEnergyPeriod*tool.timeouts.Scale {
+		a.SeedEnergy = fuzzer.Config.Corpus.Energies()
+		a.ProgMeta = fuzzer.Config.Corpus.GrabMetaUpdates()
+		tool.lastSeedEnergy = time.Now()
 	}
 	r := &rpctype.PollRes{}
 	if err := tool.manager.Call("Manager.Poll", a, r); err != nil {
 		log.SyzFatalf("Manager.Poll call failed: %v", err)
 	}
-	maxSignal := r.MaxSignal.Deserialize()
-	log.Logf(1, "poll: candidates=%v inputs=%v signal=%v",
-		len(r.Candidates), len(r.NewInputs), maxSignal.Len())
-	fuzzer.Cover.AddMaxSignal(maxSignal)
-	for _, inp := range r.NewInputs {
-		tool.inputFromOtherFuzzer(inp)
-	}
-	tool.addCandidates(r.Candidates)
+	more := tool.update("poll", &rpctype.PushArgs{
+		Candidates:  r.Candidates,
+		NewInputs:   r.NewInputs,
+		MaxSignal:   r.MaxSignal,
+		Ablation:    r.Ablation,
+		CoverFilter: r.CoverFilter,
+	})
 	if needCandidates && len(r.Candidates) == 0 && atomic.LoadUint32(&tool.triagedCandidates) == 0 {
 		atomic.StoreUint32(&tool.triagedCandidates, 1)
 	}
-	return len(r.NewInputs) != 0 || len(r.Candidates) != 0 || maxSignal.Len() != 0
+	return more
+}
+
+// update applies what the manager sent in a poll reply or a push.
+func (tool *FuzzerTool) update(source string, a *rpctype.PushArgs) bool {
+	maxSignal := a.MaxSignal.Deserialize()
+	log.Logf(1, "%v: candidates=%v inputs=%v signal=%v",
+		source, len(a.Candidates), len(a.NewInputs), maxSignal.Len())
+	tool.fuzzer.Cover.AddMaxSignal(maxSignal)
+	if a.Ablation != nil {
+		profiler.SetAblation(*a.Ablation)
+		tool.logAblation()
+	}
+	if a.CoverFilter != nil {
+		tool.updateCoverFilter(a.CoverFilter)
+	}
+	for _, inp := range a.NewInputs {
+		tool.inputFromOtherFuzzer(inp)
+	}
+	tool.addCandidates(a.Candidates)
+	return len(a.NewInputs) != 0 || len(a.Candidates) != 0 || maxSignal.Len() != 0
+}
+
+func (tool *FuzzerTool) updateCoverFilter(update *rpctype.CoverFilterUpdate) {
+	tool.coverFilterMu.Lock()
+	defer tool.coverFilterMu.Unlock()
+	// Poll replies and pushes are not ordered with respect to each other.
+	if update.Epoch <= tool.coverFilterEpoch {
+		return
+	}
+	tool.coverFilterEpoch = update.Epoch
+	state := (tool.coverFilter.Load()>>1 + 1) << 1
+	if update.Bitmap != nil {
+		writeCoverFilterBitmap(update.Bitmap)
+		state |= 1
+	}
+	// The old bitmap stays in place if filtering is disabled: procs that have not
+	// noticed the change yet may still restart executors with the filter enabled.
+	tool.coverFilter.Store(state)
+	log.Logf(0, "switched to coverage filter epoch %v (enabled=%v)", update.Epoch, update.Bitmap != nil)
+}
+
+// writeCoverFilterBitmap replaces the bitmap atomically, so that executors
+// starting concurrently map either the old or the new one.
+func writeCoverFilterBitmap(bitmap []byte) {
+	const file = "syz-cover-bitmap"
+	if err := osutil.WriteFile(file+".tmp", bitmap); err != nil {
+		log.SyzFatalf("failed to write %v: %v", file, err)
+	}
+	if err := os.Rename(file+".tmp", file); err != nil {
+		log.SyzFatalf("failed to write %v: %v", file, err)
+	}
+}
+
+// ManagerPushes receives the updates the manager pushes between polls.
+type ManagerPushes struct {
+	// Set once the fuzzer is ready, the manager does not push anything before the first poll.
+	tool atomic.Pointer[FuzzerTool]
+}
+
+func (mp *ManagerPushes) Push(a *rpctype.PushArgs, r *int) error {
+	tool := mp.tool.Load()
+	if tool == nil {
+		return fmt.Errorf("the fuzzer is not ready yet")
+	}
+	tool.update("push", a)
+	return nil
+}
+
+func (tool *FuzzerTool) logAblation() {
+	configJSON, err := json.Marshal(profiler.Ablation())
+	if err != nil {
+		log.Logf(0, "failed to display ablation configuration: %v", err)
+	}
+	tool.fuzzer.Logf(0, "read ablation configuration: %s", configJSON)
 }
 
 func (tool *FuzzerTool) sendInputsWorker(ch <-chan corpus.NewInput) {
@@ -445,6 +633,8 @@ func (tool *FuzzerTool) addCandidates(candidates []rpctype.Candidate) {
 			Prog:      p,
 			Smashed:   candidate.Smashed,
 			Minimized: candidate.Minimized,
+
+			ValueProfile: candidate.ValueProfile,
 		})
 	}
 	if len(inputs) > 0 {
@@ -457,11 +647,15 @@ func (tool *FuzzerTool) inputFromOtherFuzzer(inp rpctype.Input) {
 	if p == nil {
 		return
 	}
+	valueProfile := inp.ValueProfile.Deserialize()
+	tool.fuzzer.Cover.AddMaxValueProfile(valueProfile)
 	tool.fuzzer.Config.Corpus.Save(corpus.NewInput{
-		Prog:   p,
-		Call:   inp.Call,
-		Signal: inp.Signal.Deserialize(),
-		Cover:  inp.Cover,
+		Prog:         p,
+		Call:         inp.Call,
+		Signal:       inp.Signal.Deserialize(),
+		Cover:        inp.Cover,
+		ValueProfile: valueProfile,
+		ExecTime:     inp.ExecTime,
 	})
 }
 
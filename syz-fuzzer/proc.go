@@ -25,6 +25,8 @@ type Proc struct {
 	pid      int
 	env      *ipc.Env
 	execOpts *ipc.ExecOpts
+	// The coverage filter generation the executor uses (see FuzzerTool.coverFilter).
+	coverFilterGen uint64
 }
 
 func newProc(tool *FuzzerTool, execOpts *ipc.ExecOpts, pid int) (*Proc, error) {
@@ -42,7 +44,7 @@ func newProc(tool *FuzzerTool, execOpts *ipc.ExecOpts, pid int) (*Proc, error) {
 }
 
 func (proc *Proc) loop() {
-	rnd := rand.New(rand.NewSource(time.Now().UnixNano() + int64(proc.pid)))
+	rnd := rand.New(rand.NewSource(proc.tool.procSeed + int64(proc.pid)))
 	for {
 		req := proc.tool.fuzzer.NextInput()
 		opts := *proc.execOpts
@@ -54,10 +56,23 @@ func (proc *Proc) loop() {
 		}
 		if req.NeedHints {
 			opts.Flags |= ipc.FlagCollectComps
+			if proc.tool.fuzzer.Config.ValueProfile {
+				// Comparison PCs are needed only for the value profile signal.
+				opts.Flags |= ipc.FlagCollectCompsPC
+			}
 		}
 		if req.NeedRawCover {
 			opts.Flags &= ^ipc.FlagDedupCover
 		}
+		coverFilter := proc.tool.coverFilter.Load()
+		if coverFilter&1 != 0 {
+			opts.Flags |= ipc.FlagEnableCoverageFilter
+		}
+		if gen := coverFilter >> 1; gen != proc.coverFilterGen {
+			// The executor maps the bitmap only on start.
+			proc.coverFilterGen = gen
+			proc.env.ForceRestart()
+		}
 		// Do not let too much state accumulate.
 		const restartIn = 600
 		restart := rnd.Intn(restartIn) == 0
@@ -65,19 +80,21 @@ func (proc *Proc) loop() {
 			(req.NeedCover || req.NeedSignal || req.NeedHints) {
 			proc.env.ForceRestart()
 		}
-		info := proc.executeRaw(&opts, req.Prog)
+		info, elapsed := proc.executeRaw(&opts, req.Prog)
 		proc.tool.fuzzer.Done(req, &fuzzer.Result{
-			Info: info,
+			Info:    info,
+			Elapsed: elapsed,
 		})
 	}
 }
 
-func (proc *Proc) executeRaw(opts *ipc.ExecOpts, p *prog.Prog) *ipc.ProgInfo {
+func (proc *Proc) executeRaw(opts *ipc.ExecOpts, p *prog.Prog) (*ipc.ProgInfo, time.Duration) {
 	proc.tool.checkDisabledCalls(p)
 	for try := 0; ; try++ {
 		var output []byte
 		var info *ipc.ProgInfo
 		var hanged bool
+		var elapsed time.Duration
 		// On a heavily loaded VM, syz-executor may take significant time to start.
 		// Let's do it outside of the gate ticket.
 		err := proc.env.RestartIfNeeded(p.Target)
@@ -85,7 +102,9 @@ func (proc *Proc) executeRaw(opts *ipc.ExecOpts, p *prog.Prog) *ipc.ProgInfo {
 			// Limit concurrency.
 			ticket := proc.tool.gate.Enter()
 			proc.logProgram(opts, p)
+			start := time.Now()
 			output, info, hanged, err = proc.env.Exec(opts, p)
+			elapsed = time.Since(start)
 			proc.tool.gate.Leave(ticket)
 		}
 		if err != nil {
@@ -94,7 +113,7 @@ func (proc *Proc) executeRaw(opts *ipc.ExecOpts, p *prog.Prog) *ipc.ProgInfo {
 				// but so far we don't have a better handling than counting this.
 				// This error is observed a lot on the seeded syz_mount_image calls.
 				atomic.AddUint64(&proc.tool.bufferTooSmall, 1)
-				return nil
+				return nil, 0
 			}
 			if try > 10 {
 				log.SyzFatalf("executor %v failed %v times: %v", proc.pid, try, err)
@@ -105,7 +124,7 @@ func (proc *Proc) executeRaw(opts *ipc.ExecOpts, p *prog.Prog) *ipc.ProgInfo {
 			continue
 		}
 		log.Logf(2, "result hanged=%v: %s", hanged, output)
-		return info
+		return info, elapsed
 	}
 }
 
@@ -43,7 +43,7 @@ func testImage(hostAddr string, args *checkArgs) {
 	}
 }
 
-func runTest(target *prog.Target, manager *rpctype.RPCClient, name, executor string) {
+func runTest(target *prog.Target, manager *rpctype.StreamConn, name, executor string) {
 	pollReq := &rpctype.RunTestPollReq{Name: name}
 	for {
 		req := new(rpctype.RunTestPollRes)
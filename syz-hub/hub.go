@@ -107,6 +107,16 @@ func (hub *Hub) Sync(a *rpctype.HubSyncArgs, r *rpctype.HubSyncRes) error {
 		}
 	}
 	r.More = more
+	if a.Prios != nil {
+		if err := hub.st.SavePrios(name, a.Prios); err != nil {
+			log.Logf(0, "save prios error: %v", err)
+		}
+	}
+	if a.NeedPrios {
+		if r.Prios, err = hub.st.Prios(name); err != nil {
+			log.Logf(0, "sync error: %v", err)
+		}
+	}
 	for _, repro := range a.Repros {
 		if err := hub.st.AddRepro(name, repro); err != nil {
 			log.Logf(0, "add repro error: %v", err)
@@ -4,6 +4,7 @@
 package state
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -41,6 +42,7 @@ type Manager struct {
 	corpusSeqFile string
 	reproSeqFile  string
 	domainFile    string
+	priosFile     string
 	ownRepros     map[string]bool
 	Connected     time.Time
 	Added         int
@@ -50,6 +52,8 @@ type Manager struct {
 	RecvRepros    int
 	Calls         map[string]struct{}
 	Corpus        *db.DB
+	// Call-to-call priorities learned by the manager.
+	Prios *prog.PrioMatrix
 }
 
 // Make creates State and initializes it from dir.
@@ -145,6 +149,7 @@ func (st *State) createManager(name string) (*Manager, error) {
 		corpusSeqFile: filepath.Join(dir, "seq"),
 		reproSeqFile:  filepath.Join(dir, "repro.seq"),
 		domainFile:    filepath.Join(dir, "domain"),
+		priosFile:     filepath.Join(dir, "prios.json"),
 		ownRepros:     make(map[string]bool),
 	}
 	mgr.corpusSeq = loadSeqFile(mgr.corpusSeqFile)
@@ -160,6 +165,13 @@ func (st *State) createManager(name string) (*Manager, error) {
 	}
 	domainData, _ := os.ReadFile(mgr.domainFile)
 	mgr.Domain = string(domainData)
+	if priosData, err := os.ReadFile(mgr.priosFile); err == nil {
+		mgr.Prios = new(prog.PrioMatrix)
+		if err := json.Unmarshal(priosData, mgr.Prios); err != nil {
+			log.Logf(0, "failed to parse %v: %v", mgr.priosFile, err)
+			mgr.Prios = nil
+		}
+	}
 	corpus, _, err := loadDB(mgr.corpusFile, name, false)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open manager corpus %v: %w", mgr.corpusFile, err)
@@ -297,6 +309,59 @@ func (st *State) PendingRepro(name string) ([]byte, error) {
 	return repro, nil
 }
 
+// SavePrios stores the call-to-call priorities learned by the manager.
+func (st *State) SavePrios(name string, prios *prog.PrioMatrix) error {
+	mgr := st.Managers[name]
+	if mgr == nil || mgr.Connected.IsZero() {
+		return fmt.Errorf("unconnected manager %v", name)
+	}
+	data, err := json.Marshal(prios)
+	if err != nil {
+		return err
+	}
+	mgr.Prios = prios
+	writeFile(mgr.priosFile, data)
+	return nil
+}
+
+// Prios returns the merged priorities learned by all other managers,
+// restricted to the calls supported by the manager.
+func (st *State) Prios(name string) (*prog.PrioMatrix, error) {
+	mgr := st.Managers[name]
+	if mgr == nil || mgr.Connected.IsZero() {
+		return nil, fmt.Errorf("unconnected manager %v", name)
+	}
+	var res *prog.PrioMatrix
+	for _, other := range st.Managers {
+		if other == mgr || other.Prios == nil {
+			continue
+		}
+		filtered := &prog.PrioMatrix{
+			Progs:  other.Prios.Progs,
+			Counts: make(map[string]map[string]float64),
+		}
+		for call0, counts := range other.Prios.Counts {
+			if _, ok := mgr.Calls[call0]; !ok {
+				continue
+			}
+			for call1, count := range counts {
+				if _, ok := mgr.Calls[call1]; !ok {
+					continue
+				}
+				if filtered.Counts[call0] == nil {
+					filtered.Counts[call0] = make(map[string]float64)
+				}
+				filtered.Counts[call0][call1] = count
+			}
+		}
+		if res == nil {
+			res = new(prog.PrioMatrix)
+		}
+		res.Merge(filtered)
+	}
+	return res, nil
+}
+
 func (st *State) pendingInputs(mgr *Manager) ([]rpctype.HubInput, int, error) {
 	if mgr.corpusSeq == st.corpusSeq {
 		return nil, 0, nil
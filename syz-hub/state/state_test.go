@@ -9,6 +9,7 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/syzkaller/pkg/rpctype"
+	"github.com/google/syzkaller/prog"
 )
 
 type TestState struct {
@@ -123,6 +124,52 @@ func TestRepro(t *testing.T) {
 	expectPendingRepro("foo", "")
 }
 
+func TestPrios(t *testing.T) {
+	st := MakeTestState(t)
+
+	st.Connect("foo", "", false, []string{"open", "read", "write"}, nil)
+	st.Connect("bar", "", false, []string{"open", "read", "close"}, nil)
+	st.Connect("baz", "", false, []string{"open", "read"}, nil)
+
+	expectPrios := func(name string, want *prog.PrioMatrix) {
+		t.Helper()
+		prios, err := st.state.Prios(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, prios); diff != "" {
+			t.Fatal(diff)
+		}
+	}
+	expectPrios("foo", nil)
+	if err := st.state.SavePrios("bar", &prog.PrioMatrix{
+		Progs: 10,
+		Counts: map[string]map[string]float64{
+			"open":  {"read": 5, "close": 3},
+			"close": {"open": 1},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.state.SavePrios("baz", &prog.PrioMatrix{
+		Progs:  2,
+		Counts: map[string]map[string]float64{"open": {"read": 1}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// Own priorities are not returned and the calls unsupported by the manager are dropped.
+	want := &prog.PrioMatrix{
+		Progs:  12,
+		Counts: map[string]map[string]float64{"open": {"read": 6}},
+	}
+	expectPrios("foo", want)
+
+	// Check how persistence works.
+	st.Reload()
+	st.Connect("foo", "", false, []string{"open", "read", "write"}, nil)
+	expectPrios("foo", want)
+}
+
 func TestDomain(t *testing.T) {
 	st := MakeTestState(t)
 
@@ -0,0 +1,81 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/google/syzkaller/pkg/config"
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/profiler"
+	"github.com/google/syzkaller/prog"
+)
+
+func (mgr *Manager) currentAblation() (profiler.AblationConfiguration, int) {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	return mgr.ablation, mgr.ablationVersion
+}
+
+// updateAblation applies a (possibly partial) JSON ablation configuration on top
+// of the current one. Fuzzers receive the result right away (or on the next poll in the deterministic mode).
+func (mgr *Manager) updateAblation(data []byte) (profiler.AblationConfiguration, error) {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	cfg := mgr.ablation
+	// The current map may be in use by fuzzers' RPCs, don't decode into it.
+	cfg.MutatorWeights = make(map[string]float64)
+	for name, weight := range mgr.ablation.MutatorWeights {
+		cfg.MutatorWeights[name] = weight
+	}
+	if err := config.LoadData(data, &cfg); err != nil {
+		return cfg, err
+	}
+	if _, err := prog.ParseMutatorWeights(cfg.MutatorWeights); err != nil {
+		return cfg, fmt.Errorf("bad mutator_weights: %w", err)
+	}
+	mgr.ablation = cfg
+	mgr.ablationVersion++
+	return cfg, nil
+}
+
+// httpAblation serves the current ablation configuration.
+// A POST request with a JSON body changes the configuration, e.g.:
+//
+//	curl -d '{"disable_mutator_splice": true}' http://manager/ablation
+func (mgr *Manager) httpAblation(w http.ResponseWriter, r *http.Request) {
+	var cfg profiler.AblationConfiguration
+	switch r.Method {
+	case http.MethodGet:
+		cfg, _ = mgr.currentAblation()
+	case http.MethodPost:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to read body: %v", err), http.StatusBadRequest)
+			return
+		}
+		cfg, err = mgr.updateAblation(data)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("bad ablation configuration: %v", err), http.StatusBadRequest)
+			return
+		}
+		log.Logf(0, "ablation configuration updated: %+v", cfg)
+		if mgr.serv != nil {
+			mgr.serv.wakeFuzzers()
+		}
+	default:
+		http.Error(w, "only GET and POST are supported", http.StatusMethodNotAllowed)
+		return
+	}
+	data, err := json.MarshalIndent(cfg, "", "\t")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to encode json: %v", err),
+			http.StatusInternalServerError)
+		return
+	}
+	w.Write(data)
+}
@@ -0,0 +1,479 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/google/syzkaller/pkg/config"
+	"github.com/google/syzkaller/pkg/corpus"
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/mgrconfig"
+	"github.com/google/syzkaller/pkg/report"
+	"github.com/google/syzkaller/prog"
+)
+
+// The JSON API mirrors the web UI pages for dashboards and scripts, e.g.:
+//
+//	curl http://manager/api/v1/corpus?call=openat
+//	curl -X POST http://manager/api/v1/repro/start?id=<crash id>
+//
+// Read-only endpoints accept GET, the actions accept POST.
+// Errors are returned as {"error": "..."} with a non-200 status.
+const apiPrefix = "/api/v1/"
+
+func (mgr *Manager) apiHandlers() map[string]http.HandlerFunc {
+	return map[string]http.HandlerFunc{
+		"stats":           apiGet(mgr.apiStats),
+		"syscalls":        apiGet(mgr.apiSyscalls),
+		"corpus":          apiGet(mgr.apiCorpus),
+		"input":           apiGet(mgr.apiInput),
+		"crashes":         apiGet(mgr.apiCrashes),
+		"crash":           apiGet(mgr.apiCrash),
+		"prio":            apiGet(mgr.apiPrio),
+		"rawcover":        apiGet(mgr.apiRawCover),
+		"corpus.db":       mgr.apiDownloadCorpus,
+		"corpus/minimize": apiPost(mgr.apiMinimize),
+		"repro/start":     apiPost(mgr.apiStartRepro),
+		"repro/stop":      apiPost(mgr.apiStopRepro),
+		"coverfilter":     apiGet(mgr.apiCoverFilter),
+		"coverfilter/set": apiPost(mgr.apiSetCoverFilter),
+	}
+}
+
+// apiError is an error with the HTTP status to return.
+type apiError struct {
+	status int
+	err    error
+}
+
+func (err *apiError) Error() string {
+	return err.err.Error()
+}
+
+func apiErrorf(status int, msg string, args ...interface{}) error {
+	return &apiError{status, fmt.Errorf(msg, args...)}
+}
+
+type apiHandler func(r *http.Request) (interface{}, error)
+
+func apiGet(handler apiHandler) http.HandlerFunc {
+	return apiMethod(http.MethodGet, handler)
+}
+
+func apiPost(handler apiHandler) http.HandlerFunc {
+	return apiMethod(http.MethodPost, handler)
+}
+
+func apiMethod(method string, handler apiHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			apiReply(w, nil, apiErrorf(http.StatusMethodNotAllowed, "only %v is supported", method))
+			return
+		}
+		res, err := handler(r)
+		apiReply(w, res, err)
+	}
+}
+
+func apiReply(w http.ResponseWriter, res interface{}, err error) {
+	status := http.StatusOK
+	if err != nil {
+		status = http.StatusInternalServerError
+		if apiErr, ok := err.(*apiError); ok {
+			status = apiErr.status
+		}
+		res = struct {
+			Error string `json:"error"`
+		}{err.Error()}
+	}
+	data, err := json.MarshalIndent(res, "", "\t")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to encode json: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ctApplicationJSON)
+	w.WriteHeader(status)
+	w.Write(append(data, '\n'))
+}
+
+type APIStat struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func (mgr *Manager) apiStats(r *http.Request) (interface{}, error) {
+	var res []APIStat
+	for _, stat := range mgr.collectStats() {
+		res = append(res, APIStat{stat.Name, stat.Value})
+	}
+	return res, nil
+}
+
+type APISyscall struct {
+	Name   string `json:"name"`
+	ID     *int   `json:"id,omitempty"`
+	Inputs int    `json:"inputs"`
+	Cover  int    `json:"cover"`
+}
+
+func (mgr *Manager) apiSyscalls(r *http.Request) (interface{}, error) {
+	res := []APISyscall{}
+	for c, cc := range mgr.collectSyscallInfo() {
+		var syscallID *int
+		if syscall, ok := mgr.target.SyscallMap[c]; ok {
+			syscallID = &syscall.ID
+		}
+		res = append(res, APISyscall{
+			Name:   c,
+			ID:     syscallID,
+			Inputs: cc.Count,
+			Cover:  len(cc.Cover),
+		})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res, nil
+}
+
+type APIInput struct {
+	Sig    string           `json:"sig"`
+	Call   string           `json:"call"`
+	Short  string           `json:"short"`
+	Signal int              `json:"signal"`
+	Cover  int              `json:"cover"`
+	Energy *float64         `json:"energy,omitempty"`
+	Prog   string           `json:"prog,omitempty"`
+	Meta   *corpus.ItemMeta `json:"meta,omitempty"`
+}
+
+func makeAPIInput(inp *corpus.Item) APIInput {
+	return APIInput{
+		Sig:    inp.Sig,
+		Call:   inp.StringCall(),
+		Short:  inp.Prog.String(),
+		Signal: inp.Signal.Len(),
+		Cover:  len(inp.Cover),
+	}
+}
+
+func (mgr *Manager) apiCorpus(r *http.Request) (interface{}, error) {
+	var energy map[string]float64
+	if mgr.serv != nil {
+		// Must be done before locking mgr.mu, serv.mu is locked first.
+		energy = mgr.serv.seedEnergy()
+	}
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	call := r.FormValue("call")
+	res := []APIInput{}
+	for _, inp := range mgr.corpus.Items() {
+		if call != "" && call != inp.StringCall() {
+			continue
+		}
+		apiInput := makeAPIInput(inp)
+		if e, ok := energy[inp.Sig]; ok {
+			apiInput.Energy = &e
+		}
+		res = append(res, apiInput)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		a, b := res[i], res[j]
+		if a.Cover != b.Cover {
+			return a.Cover > b.Cover
+		}
+		return a.Sig < b.Sig
+	})
+	return res, nil
+}
+
+func (mgr *Manager) apiInput(r *http.Request) (interface{}, error) {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	inp := mgr.corpus.Item(r.FormValue("sig"))
+	if inp == nil {
+		return nil, apiErrorf(http.StatusNotFound, "can't find the input")
+	}
+	res := makeAPIInput(inp)
+	res.Prog = string(inp.ProgData)
+	res.Meta = &inp.Meta
+	return res, nil
+}
+
+type APICrashType struct {
+	ID          string     `json:"id"`
+	Title       string     `json:"title"`
+	Count       int        `json:"count"`
+	LastTime    time.Time  `json:"last_time"`
+	Active      bool       `json:"active"`
+	ReproStatus string     `json:"repro_status,omitempty"`
+	Strace      string     `json:"strace,omitempty"`
+	Crashes     []APICrash `json:"crashes,omitempty"`
+}
+
+type APICrash struct {
+	Index  int       `json:"index"`
+	Time   time.Time `json:"time"`
+	Active bool      `json:"active"`
+	Log    string    `json:"log"`
+	Report string    `json:"report,omitempty"`
+	Tag    string    `json:"tag,omitempty"`
+}
+
+func makeAPICrashType(crash *UICrashType) APICrashType {
+	res := APICrashType{
+		ID:          crash.ID,
+		Title:       crash.Description,
+		Count:       crash.Count,
+		LastTime:    crash.LastTime,
+		Active:      crash.Active,
+		ReproStatus: crash.Triaged,
+		Strace:      crash.Strace,
+	}
+	for _, c := range crash.Crashes {
+		res.Crashes = append(res.Crashes, APICrash(*c))
+	}
+	return res
+}
+
+func (mgr *Manager) apiCrashes(r *http.Request) (interface{}, error) {
+	crashes, err := mgr.collectCrashes(mgr.cfg.Workdir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect crashes: %w", err)
+	}
+	res := []APICrashType{}
+	for _, crash := range crashes {
+		res = append(res, makeAPICrashType(crash))
+	}
+	return res, nil
+}
+
+func (mgr *Manager) apiCrash(r *http.Request) (interface{}, error) {
+	crash, err := mgr.findCrash(r.FormValue("id"))
+	if err != nil {
+		return nil, err
+	}
+	return makeAPICrashType(crash), nil
+}
+
+func (mgr *Manager) findCrash(id string) (*UICrashType, error) {
+	if !isAlphanumeric(id) {
+		return nil, apiErrorf(http.StatusBadRequest, "bad crash id %q", id)
+	}
+	crash := readCrash(mgr.cfg.Workdir, id, nil, mgr.startTime, true)
+	if crash == nil {
+		return nil, apiErrorf(http.StatusNotFound, "can't find crash %q", id)
+	}
+	return crash, nil
+}
+
+type APIPrio struct {
+	Call string `json:"call"`
+	Prio int32  `json:"prio"`
+}
+
+func (mgr *Manager) apiPrio(r *http.Request) (interface{}, error) {
+	callName := r.FormValue("call")
+	call := mgr.target.SyscallMap[callName]
+	if call == nil {
+		return nil, apiErrorf(http.StatusBadRequest, "unknown call: %q", callName)
+	}
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	var progs []*prog.Prog
+	for _, inp := range mgr.corpus.Items() {
+		progs = append(progs, inp.Prog)
+	}
+	prios := mgr.target.CalculatePrioritiesWithPrior(progs, mgr.prioPriorLocked())
+	var res []APIPrio
+	for i, p := range prios[call.ID] {
+		res = append(res, APIPrio{mgr.target.Syscalls[i].Name, p})
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Prio > res[j].Prio
+	})
+	return res, nil
+}
+
+type APIRawCover struct {
+	Sig string   `json:"sig,omitempty"`
+	PCs []uint64 `json:"pcs"`
+}
+
+// apiRawCover returns the covered PCs of the input with the given sig or of the whole corpus.
+func (mgr *Manager) apiRawCover(r *http.Request) (interface{}, error) {
+	if !mgr.cfg.Cover {
+		return nil, apiErrorf(http.StatusNotFound, "coverage is not enabled")
+	}
+	mgr.mu.Lock()
+	initialized := mgr.modulesInitialized
+	mgr.mu.Unlock()
+	if !initialized {
+		return nil, apiErrorf(http.StatusServiceUnavailable, "coverage is not ready, try again after fuzzer started")
+	}
+	// Don't hold the mutex while creating the report generator, it takes lots of time.
+	rg, err := getReportGenerator(mgr.cfg, mgr.modules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize coverage information: %w", err)
+	}
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	res := APIRawCover{Sig: r.FormValue("sig")}
+	if res.Sig != "" {
+		inp := mgr.corpus.Item(res.Sig)
+		if inp == nil {
+			return nil, apiErrorf(http.StatusNotFound, "can't find the input")
+		}
+		res.PCs = coverToPCs(rg, inp.Cover)
+	} else {
+		pcs := make(map[uint32]bool)
+		for _, inp := range mgr.corpus.Items() {
+			for _, pc := range inp.Cover {
+				pcs[pc] = true
+			}
+		}
+		cov := make([]uint32, 0, len(pcs))
+		for pc := range pcs {
+			cov = append(cov, pc)
+		}
+		res.PCs = coverToPCs(rg, cov)
+	}
+	sort.Slice(res.PCs, func(i, j int) bool {
+		return res.PCs[i] < res.PCs[j]
+	})
+	return res, nil
+}
+
+func (mgr *Manager) apiDownloadCorpus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiReply(w, nil, apiErrorf(http.StatusMethodNotAllowed, "only GET is supported"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="corpus.db"`)
+	mgr.httpDownloadCorpus(w, r)
+}
+
+type APIMinimize struct {
+	Before int `json:"before"`
+	After  int `json:"after"`
+}
+
+func (mgr *Manager) apiMinimize(r *http.Request) (interface{}, error) {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	if mgr.phase < phaseLoadedCorpus {
+		return nil, apiErrorf(http.StatusServiceUnavailable, "the corpus is not loaded yet")
+	}
+	res := APIMinimize{Before: mgr.corpus.Stats().Progs}
+	// Minimize regardless of how much the corpus has grown since the last time.
+	mgr.lastMinCorpus = 0
+	mgr.minimizeCorpusUnlocked()
+	res.After = mgr.corpus.Stats().Progs
+	log.Logf(0, "minimized corpus on API request: %v -> %v", res.Before, res.After)
+	return res, nil
+}
+
+type APIRepro struct {
+	Title string `json:"title"`
+}
+
+// apiStartRepro queues reproduction of the crash with the given id
+// regardless of the number of the previous attempts.
+func (mgr *Manager) apiStartRepro(r *http.Request) (interface{}, error) {
+	crash, err := mgr.findCrash(r.FormValue("id"))
+	if err != nil {
+		return nil, err
+	}
+	if len(crash.Crashes) == 0 {
+		return nil, apiErrorf(http.StatusNotFound, "crash %q has no logs", crash.ID)
+	}
+	// The crashes are sorted by time, reproduce the latest one.
+	output, err := os.ReadFile(filepath.Join(mgr.cfg.Workdir, crash.Crashes[0].Log))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read crash log: %w", err)
+	}
+	select {
+	case mgr.externalReproQueue <- &Crash{
+		vmIndex: -1,
+		manual:  true,
+		Report: &report.Report{
+			Title:  crash.Description,
+			Output: output,
+		},
+	}:
+	default:
+		return nil, apiErrorf(http.StatusServiceUnavailable, "repro queue is full, try again later")
+	}
+	log.Logf(0, "queued repro of '%v' on API request", crash.Description)
+	return APIRepro{crash.Description}, nil
+}
+
+// apiStopRepro drops the queued reproduction of the crash with the given id.
+// A running reproduction can't be interrupted.
+func (mgr *Manager) apiStopRepro(r *http.Request) (interface{}, error) {
+	crash, err := mgr.findCrash(r.FormValue("id"))
+	if err != nil {
+		return nil, err
+	}
+	reply := make(chan error)
+	mgr.reproStop <- reproStopRequest{crash.Description, reply}
+	if err := <-reply; err != nil {
+		return nil, &apiError{http.StatusConflict, err}
+	}
+	log.Logf(0, "dropped repro of '%v' on API request", crash.Description)
+	return APIRepro{crash.Description}, nil
+}
+
+type reproStopRequest struct {
+	title string
+	reply chan error
+}
+
+// apiCoverFilter returns all coverage filter epochs, the last one is the current one.
+func (mgr *Manager) apiCoverFilter(r *http.Request) (interface{}, error) {
+	if mgr.serv == nil {
+		return []CoverFilterEpoch{}, nil
+	}
+	return mgr.serv.coverFilterHistory(), nil
+}
+
+// apiSetCoverFilter replaces the coverage filter with the one in the request body
+// (in the cover_filter config format), an empty filter disables filtering, e.g.:
+//
+//	curl -d '{"functions": ["^ext4_"]}' http://manager/api/v1/coverfilter/set
+//
+// Fuzzers switch to the new filter right away, the reply is the new filter epoch.
+func (mgr *Manager) apiSetCoverFilter(r *http.Request) (interface{}, error) {
+	if !mgr.cfg.Cover {
+		return nil, apiErrorf(http.StatusNotFound, "coverage is not enabled")
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, apiErrorf(http.StatusBadRequest, "failed to read body: %v", err)
+	}
+	var filter mgrconfig.CovFilterCfg
+	if err := config.LoadData(data, &filter); err != nil {
+		return nil, apiErrorf(http.StatusBadRequest, "bad coverage filter: %v", err)
+	}
+	mgr.mu.Lock()
+	initialized := mgr.modulesInitialized
+	mgr.mu.Unlock()
+	if !initialized || mgr.serv == nil {
+		return nil, apiErrorf(http.StatusServiceUnavailable, "coverage is not ready, try again after fuzzer started")
+	}
+	epoch, err := mgr.setCoverFilter(filter)
+	if err != nil {
+		return nil, &apiError{http.StatusBadRequest, err}
+	}
+	return epoch, nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/pkg/corpus"
+	"github.com/google/syzkaller/pkg/mgrconfig"
+	"github.com/google/syzkaller/pkg/report"
+	"github.com/google/syzkaller/pkg/signal"
+	"github.com/google/syzkaller/prog"
+	"github.com/google/syzkaller/sys/targets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPI(t *testing.T) {
+	target, err := prog.GetTarget(targets.TestOS, targets.TestArch64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	workdir := t.TempDir()
+	mgr := &Manager{
+		cfg:                &mgrconfig.Config{Workdir: workdir},
+		target:             target,
+		corpus:             corpus.NewCorpus(ctx),
+		startTime:          time.Now(),
+		phase:              phaseLoadedCorpus,
+		saturatedCalls:     make(map[string]bool),
+		externalReproQueue: make(chan *Crash, 1),
+	}
+	p, err := target.Deserialize([]byte("mutate0()\nmutate1()\n"), prog.Strict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr.corpus.Save(corpus.NewInput{
+		Prog:   p,
+		Call:   1,
+		Signal: signal.FromRaw([]uint32{1, 2, 3}, 0),
+		Cover:  []uint32{10, 20},
+	})
+	sig := mgr.corpus.Items()[0].Sig
+	const crashID = "0123456789012345678901234567890123456789"
+	crashDir := filepath.Join(workdir, "crashes", crashID)
+	for name, data := range map[string]string{
+		"description": "KASAN: use-after-free in foo\n",
+		"log0":        "crash log",
+	} {
+		if err := os.MkdirAll(crashDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(crashDir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	for name, handler := range mgr.apiHandlers() {
+		mux.HandleFunc(apiPrefix+name, handler)
+	}
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	call := func(method, path string, res interface{}) int {
+		req, err := http.NewRequest(method, server.URL+apiPrefix+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		assert.Equal(t, ctApplicationJSON, resp.Header.Get("Content-Type"))
+		if err := json.NewDecoder(resp.Body).Decode(res); err != nil {
+			t.Fatalf("%v %v: failed to decode reply: %v", method, path, err)
+		}
+		return resp.StatusCode
+	}
+
+	var inputs []APIInput
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "corpus", &inputs))
+	assert.Equal(t, []APIInput{{
+		Sig:    sig,
+		Call:   "mutate1",
+		Short:  p.String(),
+		Signal: 3,
+		Cover:  2,
+	}}, inputs)
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "corpus?call=mutate0", &inputs))
+	assert.Empty(t, inputs)
+
+	var input APIInput
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "input?sig="+sig, &input))
+	assert.Equal(t, string(p.Serialize()), input.Prog)
+
+	var apiErr struct {
+		Error string `json:"error"`
+	}
+	assert.Equal(t, http.StatusNotFound, call(http.MethodGet, "input?sig=foo", &apiErr))
+	assert.Equal(t, "can't find the input", apiErr.Error)
+	assert.Equal(t, http.StatusMethodNotAllowed, call(http.MethodGet, "corpus/minimize", &apiErr))
+	assert.Equal(t, http.StatusBadRequest, call(http.MethodGet, "crash?id=../../etc", &apiErr))
+
+	var crash APICrashType
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "crash?id="+crashID, &crash))
+	assert.Equal(t, "KASAN: use-after-free in foo", crash.Title)
+	assert.Equal(t, 1, crash.Count)
+	assert.Equal(t, "crashes/"+crashID+"/log0", crash.Crashes[0].Log)
+
+	var repro APIRepro
+	assert.Equal(t, http.StatusOK, call(http.MethodPost, "repro/start?id="+crashID, &repro))
+	assert.Equal(t, "KASAN: use-after-free in foo", repro.Title)
+	queued := <-mgr.externalReproQueue
+	assert.True(t, queued.manual)
+	assert.Equal(t, "crash log", string(queued.Output))
+
+	var minimize APIMinimize
+	assert.Equal(t, http.StatusOK, call(http.MethodPost, "corpus/minimize", &minimize))
+	assert.Equal(t, APIMinimize{Before: 1, After: 1}, minimize)
+}
+
+func TestDropRepro(t *testing.T) {
+	newCrash := func(title string) *Crash {
+		return &Crash{Report: &report.Report{Title: title}}
+	}
+	pending := newCrash("pending")
+	pendingRepro := map[*Crash]bool{pending: true}
+	reproducing := map[string]bool{"queued": true, "running": true}
+	reproQueue := []*Crash{newCrash("other"), newCrash("queued")}
+
+	assert.NoError(t, dropRepro("pending", pendingRepro, reproducing, &reproQueue))
+	assert.Empty(t, pendingRepro)
+	assert.NoError(t, dropRepro("queued", pendingRepro, reproducing, &reproQueue))
+	assert.Len(t, reproQueue, 1)
+	assert.Equal(t, "other", reproQueue[0].Title)
+	assert.Equal(t, map[string]bool{"running": true}, reproducing)
+	err := dropRepro("running", pendingRepro, reproducing, &reproQueue)
+	assert.True(t, err != nil && strings.Contains(err.Error(), "already running"), "got %v", err)
+	assert.Error(t, dropRepro("unknown", pendingRepro, reproducing, &reproQueue))
+}
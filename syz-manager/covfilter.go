@@ -11,14 +11,18 @@ import (
 	"regexp"
 	"sort"
 	"strconv"
+	"time"
 
 	"github.com/google/syzkaller/pkg/cover/backend"
 	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/mgrconfig"
+	"github.com/google/syzkaller/pkg/rpctype"
 	"github.com/google/syzkaller/sys/targets"
 )
 
-func (mgr *Manager) createCoverageFilter() (map[uint32]uint32, map[uint32]uint32, error) {
-	if len(mgr.cfg.CovFilter.Functions)+len(mgr.cfg.CovFilter.Files)+len(mgr.cfg.CovFilter.RawPCs) == 0 {
+func (mgr *Manager) createCoverageFilter(filter mgrconfig.CovFilterCfg) (
+	map[uint32]uint32, map[uint32]uint32, error) {
+	if len(filter.Functions)+len(filter.Files)+len(filter.RawPCs) == 0 {
 		return nil, nil, nil
 	}
 	// Always initialize ReportGenerator because RPCServer.NewInput will need it to filter coverage.
@@ -32,7 +36,7 @@ func (mgr *Manager) createCoverageFilter() (map[uint32]uint32, map[uint32]uint32
 			apply(&sym.ObjectUnit)
 		}
 	}
-	if err := covFilterAddFilter(pcs, mgr.cfg.CovFilter.Functions, foreachSymbol); err != nil {
+	if err := covFilterAddFilter(pcs, filter.Functions, foreachSymbol); err != nil {
 		return nil, nil, err
 	}
 	foreachUnit := func(apply func(*backend.ObjectUnit)) {
@@ -40,10 +44,10 @@ func (mgr *Manager) createCoverageFilter() (map[uint32]uint32, map[uint32]uint32
 			apply(&unit.ObjectUnit)
 		}
 	}
-	if err := covFilterAddFilter(pcs, mgr.cfg.CovFilter.Files, foreachUnit); err != nil {
+	if err := covFilterAddFilter(pcs, filter.Files, foreachUnit); err != nil {
 		return nil, nil, err
 	}
-	if err := covFilterAddRawPCs(pcs, mgr.cfg.CovFilter.RawPCs); err != nil {
+	if err := covFilterAddRawPCs(pcs, filter.RawPCs); err != nil {
 		return nil, nil, err
 	}
 	if len(pcs) == 0 {
@@ -67,6 +71,117 @@ func (mgr *Manager) createCoverageFilter() (map[uint32]uint32, map[uint32]uint32
 	return execPCs, pcs, nil
 }
 
+// CoverFilterEpoch is a period of fuzzing with the same coverage filter.
+// The filter can be changed at runtime (see setCoverFilter), so the coverage
+// within the filter is accounted separately for each epoch.
+type CoverFilterEpoch struct {
+	Epoch  int                    `json:"epoch"`
+	Start  time.Time              `json:"start"`
+	Filter mgrconfig.CovFilterCfg `json:"filter"`
+	// Number of PCs in the filter (0 if coverage is not filtered).
+	PCs int `json:"pcs"`
+	// Corpus coverage within the filter when the epoch started.
+	StartCover int `json:"start_cover"`
+	// Coverage within the filter the corpus gained during the epoch.
+	NewCover int `json:"new_cover"`
+	// Number of corpus inputs that contributed to NewCover.
+	NewInputs int `json:"new_inputs"`
+}
+
+// setCoverFilter replaces the coverage filter of the running fuzzers,
+// an empty filter disables filtering.
+func (mgr *Manager) setCoverFilter(filter mgrconfig.CovFilterCfg) (CoverFilterEpoch, error) {
+	// coverFilterMu serializes filter changes, mgr.mu is taken only to install the new filter
+	// since creating the filter may need to create the report generator.
+	mgr.coverFilterMu.Lock()
+	defer mgr.coverFilterMu.Unlock()
+	execPCs, pcs, err := mgr.createCoverageFilter(filter)
+	if err != nil {
+		return CoverFilterEpoch{}, err
+	}
+	if pcs == nil && len(filter.Functions)+len(filter.Files)+len(filter.RawPCs) != 0 {
+		return CoverFilterEpoch{}, fmt.Errorf("the coverage filter matches no PCs")
+	}
+	mgr.mu.Lock()
+	mgr.execCoverFilter, mgr.coverFilter = execPCs, pcs
+	mgr.mu.Unlock()
+	epoch, err := mgr.serv.setCoverFilter(filter, pcs, execPCs)
+	if err != nil {
+		return CoverFilterEpoch{}, err
+	}
+	log.Logf(0, "coverage filter epoch %v: %v PCs, %v already covered", epoch.Epoch, epoch.PCs, epoch.StartCover)
+	return epoch, nil
+}
+
+func (serv *RPCServer) setCoverFilter(filter mgrconfig.CovFilterCfg, pcs, execPCs map[uint32]uint32) (
+	CoverFilterEpoch, error) {
+	serv.mu.Lock()
+	defer serv.mu.Unlock()
+	epoch, err := serv.startCoverFilterEpoch(filter, pcs, execPCs)
+	if err != nil {
+		return CoverFilterEpoch{}, err
+	}
+	for _, f := range serv.fuzzers {
+		f.wakeUp()
+	}
+	return *epoch, nil
+}
+
+// startCoverFilterEpoch must be called with serv.mu held.
+func (serv *RPCServer) startCoverFilterEpoch(filter mgrconfig.CovFilterCfg, pcs, execPCs map[uint32]uint32) (
+	*CoverFilterEpoch, error) {
+	epoch := &CoverFilterEpoch{
+		Epoch:  len(serv.coverFilterEpochs),
+		Start:  time.Now(),
+		Filter: filter,
+		PCs:    len(pcs),
+	}
+	if pcs != nil {
+		// Note: ReportGenerator is already initialized if coverFilter is enabled.
+		rg, err := getReportGenerator(serv.cfg, serv.modules)
+		if err != nil {
+			return nil, err
+		}
+		for pc := range serv.corpusCover {
+			if pcs[uint32(rg.RestorePC(pc))] != 0 {
+				epoch.StartCover++
+			}
+		}
+	}
+	serv.coverFilter, serv.execCoverFilter = pcs, execPCs
+	serv.coverFilterEpochs = append(serv.coverFilterEpochs, epoch)
+	serv.stats.corpusCoverFiltered.set(epoch.StartCover)
+	return epoch, nil
+}
+
+// coverFilterUpdate returns the current coverage filter if the fuzzer does not use it yet.
+// It must be called with serv.mu held.
+func (serv *RPCServer) coverFilterUpdate(f *Fuzzer) *rpctype.CoverFilterUpdate {
+	if len(serv.coverFilterEpochs) == 0 {
+		return nil
+	}
+	epoch := len(serv.coverFilterEpochs) - 1
+	if f.coverFilterEpoch == epoch {
+		return nil
+	}
+	f.coverFilterEpoch = epoch
+	instCoverFilter := f.instModules.DecanonicalizeFilter(serv.execCoverFilter)
+	return &rpctype.CoverFilterUpdate{
+		Epoch:  epoch,
+		Bitmap: createCoverageBitmap(serv.cfg.SysTarget, instCoverFilter),
+	}
+}
+
+func (serv *RPCServer) coverFilterHistory() []CoverFilterEpoch {
+	serv.mu.Lock()
+	defer serv.mu.Unlock()
+	res := make([]CoverFilterEpoch, len(serv.coverFilterEpochs))
+	for i, epoch := range serv.coverFilterEpochs {
+		res[i] = *epoch
+	}
+	return res
+}
+
 func covFilterAddFilter(pcs map[uint32]uint32, filters []string, foreach func(func(*backend.ObjectUnit))) error {
 	res, err := compileRegexps(filters)
 	if err != nil {
@@ -20,6 +20,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/google/syzkaller/pkg/corpus"
 	"github.com/google/syzkaller/pkg/cover"
 	"github.com/google/syzkaller/pkg/html/pages"
 	"github.com/google/syzkaller/pkg/log"
@@ -37,6 +38,7 @@ func (mgr *Manager) initHTTP() {
 	}
 	handle("/", mgr.httpSummary)
 	handle("/config", mgr.httpConfig)
+	handle("/ablation", mgr.httpAblation)
 	handle("/metrics", promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{}).ServeHTTP)
 	handle("/syscalls", mgr.httpSyscalls)
 	handle("/corpus", mgr.httpCorpus)
@@ -55,7 +57,12 @@ func (mgr *Manager) initHTTP() {
 	handle("/filecover", mgr.httpFileCover)
 	handle("/input", mgr.httpInput)
 	handle("/debuginput", mgr.httpDebugInput)
+	handle("/ancestry", mgr.httpAncestry)
+	handle("/lineage", mgr.httpLineage)
 	handle("/modules", mgr.modulesInfo)
+	for name, handler := range mgr.apiHandlers() {
+		handle(apiPrefix+name, handler)
+	}
 	// Browsers like to request this, without special handler this goes to / handler.
 	handle("/favicon.ico", func(w http.ResponseWriter, r *http.Request) {})
 
@@ -116,6 +123,11 @@ func (mgr *Manager) httpSyscalls(w http.ResponseWriter, r *http.Request) {
 }
 
 func (mgr *Manager) collectStats() []UIStat {
+	var mutatorWeights map[string]float64
+	if mgr.serv != nil {
+		// Must be done before locking mgr.mu, serv.mu is locked first.
+		mutatorWeights = mgr.serv.mutatorWeights()
+	}
 	mgr.mu.Lock()
 	defer mgr.mu.Unlock()
 
@@ -160,6 +172,12 @@ func (mgr *Manager) collectStats() []UIStat {
 		secs = uint64(time.Since(mgr.firstConnect))/1e9 + 1
 	}
 	intStats := convertStats(rawStats, secs)
+	for name, share := range mutatorWeights {
+		intStats = append(intStats, UIStat{
+			Name:  "mutator weight: " + name,
+			Value: fmt.Sprintf("%.1f%%", share*100),
+		})
+	}
 	sort.Slice(intStats, func(i, j int) bool {
 		return intStats[i].Name < intStats[j].Name
 	})
@@ -195,22 +213,33 @@ func (mgr *Manager) httpCrash(w http.ResponseWriter, r *http.Request) {
 }
 
 func (mgr *Manager) httpCorpus(w http.ResponseWriter, r *http.Request) {
+	var energy map[string]float64
+	if mgr.serv != nil {
+		// Must be done before locking mgr.mu, serv.mu is locked first.
+		energy = mgr.serv.seedEnergy()
+	}
 	mgr.mu.Lock()
 	defer mgr.mu.Unlock()
 
 	data := UICorpus{
 		Call:     r.FormValue("call"),
 		RawCover: mgr.cfg.RawCover,
+		Schedule: mgr.cfg.SeedSchedule,
+	}
+	if data.Schedule == "" {
+		data.Schedule = corpus.DefaultSeedSchedule
 	}
 	for _, inp := range mgr.corpus.Items() {
 		if data.Call != "" && data.Call != inp.StringCall() {
 			continue
 		}
-		data.Inputs = append(data.Inputs, &UIInput{
+		uiInput := &UIInput{
 			Sig:   inp.Sig,
 			Short: inp.Prog.String(),
 			Cover: len(inp.Cover),
-		})
+		}
+		uiInput.Energy, uiInput.HasEnergy = energy[inp.Sig]
+		data.Inputs = append(data.Inputs, uiInput)
 	}
 	sort.Slice(data.Inputs, func(i, j int) bool {
 		a, b := data.Inputs[i], data.Inputs[j]
@@ -342,12 +371,11 @@ func (mgr *Manager) httpCoverCover(w http.ResponseWriter, r *http.Request, funcF
 			})
 		}
 	}
-	mgr.mu.Unlock()
-
 	var coverFilter map[uint32]uint32
 	if r.FormValue("filter") != "" {
 		coverFilter = mgr.coverFilter
 	}
+	mgr.mu.Unlock()
 
 	params := cover.CoverHandlerParams{
 		Progs:       progs,
@@ -434,7 +462,7 @@ func (mgr *Manager) httpPrio(w http.ResponseWriter, r *http.Request) {
 	for _, inp := range mgr.corpus.Items() {
 		corpus = append(corpus, inp.Prog)
 	}
-	prios := mgr.target.CalculatePriorities(corpus)
+	prios := mgr.target.CalculatePrioritiesWithPrior(corpus, mgr.prioPriorLocked())
 
 	data := &UIPrioData{Call: callName}
 	for i, p := range prios[call.ID] {
@@ -475,6 +503,55 @@ func (mgr *Manager) httpInput(w http.ResponseWriter, r *http.Request) {
 	w.Write(inp.ProgData)
 }
 
+func (mgr *Manager) httpAncestry(w http.ResponseWriter, r *http.Request) {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	sig := r.FormValue("sig")
+	if mgr.corpus.Item(sig) == nil {
+		http.Error(w, "can't find the input", http.StatusInternalServerError)
+		return
+	}
+	graph := mgr.corpus.LineageGraph()
+	data := UIAncestry{
+		Sig:      sig,
+		Children: graph.Node(sig).Children,
+	}
+	for _, node := range graph.Ancestry(sig) {
+		anc := UIAncestor{
+			Sig:      node.Sig,
+			Call:     node.Label,
+			Mutators: strings.Join(node.Mutators, ", "),
+			Missing:  node.Missing,
+		}
+		if item := mgr.corpus.Item(node.Sig); item != nil {
+			anc.Short = item.Prog.String()
+			anc.Added = item.Meta.Added
+		}
+		data.Ancestors = append(data.Ancestors, anc)
+	}
+	sort.Strings(data.Children)
+	executeTemplate(w, ancestryTemplate, data)
+}
+
+func (mgr *Manager) httpLineage(w http.ResponseWriter, r *http.Request) {
+	graph := mgr.corpus.LineageGraph()
+	var err error
+	switch format := r.FormValue("format"); format {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		err = graph.WriteJSON(w)
+	case "dot":
+		w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+		err = graph.WriteDOT(w)
+	default:
+		http.Error(w, fmt.Sprintf("unknown format %q", format), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to export the lineage: %v", err), http.StatusInternalServerError)
+	}
+}
+
 func (mgr *Manager) httpDebugInput(w http.ResponseWriter, r *http.Request) {
 	mgr.mu.Lock()
 	defer mgr.mu.Unlock()
@@ -583,7 +660,10 @@ func (mgr *Manager) httpRawCoverFiles(w http.ResponseWriter, r *http.Request) {
 }
 
 func (mgr *Manager) httpFilterPCs(w http.ResponseWriter, r *http.Request) {
-	if mgr.coverFilter == nil {
+	mgr.mu.Lock()
+	filtered := mgr.coverFilter != nil
+	mgr.mu.Unlock()
+	if !filtered {
 		fmt.Fprintf(w, "cover is not filtered in config.\n")
 		return
 	}
@@ -780,13 +860,16 @@ type UICallType struct {
 type UICorpus struct {
 	Call     string
 	RawCover bool
+	Schedule string
 	Inputs   []*UIInput
 }
 
 type UIInput struct {
-	Sig   string
-	Short string
-	Cover int
+	Sig       string
+	Short     string
+	Cover     int
+	Energy    float64
+	HasEnergy bool
 }
 
 var summaryTemplate = pages.Create(`
@@ -931,10 +1014,12 @@ var corpusTemplate = pages.Create(`
 <body>
 
 <table class="list_table">
-	<caption>Corpus{{if $.Call}} for {{$.Call}}{{end}}:</caption>
+	<caption>Corpus{{if $.Call}} for {{$.Call}}{{end}} (seed schedule: {{$.Schedule}}):</caption>
 	<tr>
 		<th>Coverage</th>
+		<th>Energy</th>
 		<th>Program</th>
+		<th>Ancestry</th>
 	</tr>
 	{{range $inp := $.Inputs}}
 	<tr>
@@ -944,13 +1029,70 @@ var corpusTemplate = pages.Create(`
 		/ <a href="/debuginput?sig={{$inp.Sig}}">[raw]</a>
 	{{end}}
 		</td>
+		<td>{{if $inp.HasEnergy}}{{printf "%.3g" $inp.Energy}}{{else}}-{{end}}</td>
 		<td><a href="/input?sig={{$inp.Sig}}">{{$inp.Short}}</a></td>
+		<td><a href="/ancestry?sig={{$inp.Sig}}">[ancestry]</a></td>
 	</tr>
 	{{end}}
 </table>
 </body></html>
 `)
 
+type UIAncestry struct {
+	Sig       string
+	Ancestors []UIAncestor
+	Children  []string
+}
+
+type UIAncestor struct {
+	Sig      string
+	Call     string
+	Short    string
+	Mutators string
+	Added    time.Time
+	Missing  bool
+}
+
+var ancestryTemplate = pages.Create(`
+<!doctype html>
+<html>
+<head>
+	<title>syzkaller input ancestry</title>
+	{{HEAD}}
+</head>
+<body>
+
+<table class="list_table">
+	<caption>Ancestry of {{$.Sig}} (<a href="/lineage?format=dot">corpus lineage</a>):</caption>
+	<tr>
+		<th>Input</th>
+		<th>Call</th>
+		<th>Added</th>
+		<th>Derived by</th>
+		<th>Program</th>
+	</tr>
+	{{range $anc := $.Ancestors}}
+	<tr>
+		<td>{{if $anc.Missing}}{{$anc.Sig}}{{else}}<a href="/ancestry?sig={{$anc.Sig}}">{{$anc.Sig}}</a>{{end}}</td>
+		<td>{{$anc.Call}}</td>
+		<td>{{if not $anc.Added.IsZero}}{{formatTime $anc.Added}}{{end}}</td>
+		<td>{{$anc.Mutators}}</td>
+		<td>{{if $anc.Missing}}(no longer in the corpus){{else}}<a href="/input?sig={{$anc.Sig}}">{{$anc.Short}}</a>{{end}}</td>
+	</tr>
+	{{end}}
+</table>
+
+{{if $.Children}}
+<table class="list_table">
+	<caption>Derived inputs:</caption>
+	{{range $child := $.Children}}
+	<tr><td><a href="/ancestry?sig={{$child}}">{{$child}}</a></td></tr>
+	{{end}}
+</table>
+{{end}}
+</body></html>
+`)
+
 type UIPrioData struct {
 	Call  string
 	Prios []UIPrio
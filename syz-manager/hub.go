@@ -68,6 +68,9 @@ type HubConnector struct {
 	hubReproQueue  chan *Crash
 	needMoreRepros chan chan bool
 	keyGet         keyGetter
+	// The learned priorities last sent to the hub.
+	sentPrios *prog.PrioMatrix
+	needPrios bool
 }
 
 // HubManagerView restricts interface between HubConnector and Manager.
@@ -75,6 +78,8 @@ type HubManagerView interface {
 	getMinimizedCorpus() (corpus, repros [][]byte)
 	addNewCandidates(candidates []rpctype.Candidate)
 	hubIsUnreachable()
+	learnedPrios() *prog.PrioMatrix
+	importPrios(prios *prog.PrioMatrix)
 }
 
 func (hc *HubConnector) loop() {
@@ -146,6 +151,8 @@ func (hc *HubConnector) connect(corpus [][]byte) (*rpctype.RPCClient, error) {
 	}
 	hc.hubCorpus = hubCorpus
 	hc.fresh = false
+	hc.sentPrios = nil
+	hc.needPrios = true
 	return hub, nil
 }
 
@@ -182,11 +189,24 @@ func (hc *HubConnector) sync(hub *rpctype.RPCClient, corpus [][]byte) error {
 		a.NeedRepros = <-needReproReply
 	}
 	a.Repros = hc.newRepros
+	// The priorities are exchanged on the first sync after connect and then whenever they are updated.
+	if prios := hc.mgr.learnedPrios(); prios != hc.sentPrios {
+		a.Prios = prios
+		hc.needPrios = true
+	}
+	a.NeedPrios = hc.needPrios
 	for {
 		r := new(rpctype.HubSyncRes)
 		if err := hub.Call("Hub.Sync", a, r); err != nil {
 			return err
 		}
+		if r.Prios != nil {
+			hc.mgr.importPrios(r.Prios)
+		}
+		if a.Prios != nil {
+			hc.sentPrios = a.Prios
+		}
+		hc.needPrios = false
 		minimized, smashed, progDropped := hc.processProgs(r.Inputs)
 		reproDropped := hc.processRepros(r.Repros)
 		hc.stats.hubSendProgAdd.add(len(a.Add))
@@ -205,6 +225,8 @@ func (hc *HubConnector) sync(hub *rpctype.RPCClient, corpus [][]byte) error {
 		a.Del = nil
 		a.Repros = nil
 		a.NeedRepros = false
+		a.Prios = nil
+		a.NeedPrios = false
 		hc.newRepros = nil
 		if len(r.Inputs)+r.More == 0 {
 			return nil
@@ -1,5 +1,3 @@
-//go:build !profiling
-
 // Copyright 2015 syzkaller project authors. All rights reserved.
 // Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
 
@@ -33,10 +31,13 @@ import (
 	"github.com/google/syzkaller/pkg/log"
 	"github.com/google/syzkaller/pkg/mgrconfig"
 	"github.com/google/syzkaller/pkg/osutil"
+	"github.com/google/syzkaller/pkg/profevent"
 	"github.com/google/syzkaller/pkg/report"
 	crash_pkg "github.com/google/syzkaller/pkg/report/crash"
 	"github.com/google/syzkaller/pkg/repro"
 	"github.com/google/syzkaller/pkg/rpctype"
+	"github.com/google/syzkaller/pkg/signal"
+	"github.com/google/syzkaller/profiler"
 	"github.com/google/syzkaller/prog"
 	"github.com/google/syzkaller/sys/targets"
 	"github.com/google/syzkaller/vm"
@@ -58,12 +59,15 @@ type Manager struct {
 	serv           *RPCServer
 	corpus         *corpus.Corpus
 	corpusDB       *db.DB
-	corpusDBMu     sync.Mutex // for concurrent operations on corpusDB
+	metaDB         *db.DB          // see openMetaDB
+	corpusDBMu     sync.Mutex      // for concurrent operations on corpusDB and metaDB
+	metaDirty      map[string]bool // programs with unsaved metadata, see markMeta
 	startTime      time.Time
 	firstConnect   time.Time
 	fuzzingTime    time.Duration
 	stats          *Stats
-	crashTypes     map[string]bool
+	crashTypes     map[string]int // the number of crashes by title
+	vmStates       *vmStates
 	vmStop         chan bool
 	checkResult    *rpctype.CheckArgs
 	fresh          bool
@@ -85,9 +89,25 @@ type Manager struct {
 	dataRaceFrames   map[string]bool
 	saturatedCalls   map[string]bool
 
+	// Ablation configuration currently pushed to fuzzers, it can be changed via HTTP.
+	// ablationVersion is incremented on every change.
+	ablation        profiler.AblationConfiguration
+	ablationVersion int
+
+	// Call-to-call priorities learned from the corpus and the ones received from syz-hub (see prio.go).
+	prios    *prog.PrioMatrix
+	hubPrios *prog.PrioMatrix
+	// The prior sent to the fuzzers, see prioPriorLocked.
+	compactPrios *prog.CompactPrioMatrix
+
+	// Profiling event stream in the workdir, it includes events forwarded by fuzzers.
+	// Nil if profiling is disabled.
+	profEvents *profevent.Writer
+
 	needMoreRepros     chan chan bool
 	externalReproQueue chan *Crash
 	reproRequest       chan chan map[string]bool
+	reproStop          chan reproStopRequest
 
 	// For checking that files that we are using are not changing under us.
 	// Maps file name to modification time.
@@ -98,6 +118,8 @@ type Manager struct {
 	execCoverFilter     map[uint32]uint32
 	modulesInitialized  bool
 	afterTriageStatSent bool
+	// Serializes coverage filter changes (see setCoverFilter).
+	coverFilterMu sync.Mutex
 
 	assetStorage *asset.Storage
 }
@@ -123,6 +145,7 @@ type Crash struct {
 	vmIndex       int
 	fromHub       bool // this crash was created based on a repro from syz-hub
 	fromDashboard bool // .. or from dashboard
+	manual        bool // .. or its reproduction was requested via the API
 	*report.Report
 	machineInfo []byte
 }
@@ -145,7 +168,11 @@ func main() {
 }
 
 func RunManager(cfg *mgrconfig.Config) {
+	if _, err := corpus.NewSeedScheduler(cfg.SeedSchedule); err != nil {
+		log.Fatalf("%v", err)
+	}
 	var vmPool *vm.Pool
+	vmCount := 0
 	// Type "none" is a special case for debugging/development when manager
 	// does not start any VMs, but instead you start them manually
 	// and start syz-fuzzer there.
@@ -155,6 +182,7 @@ func RunManager(cfg *mgrconfig.Config) {
 		if err != nil {
 			log.Fatalf("%v", err)
 		}
+		vmCount = vmPool.Count()
 	}
 
 	crashdir := filepath.Join(cfg.Workdir, "crashes")
@@ -175,8 +203,9 @@ func RunManager(cfg *mgrconfig.Config) {
 		reporter:           reporter,
 		crashdir:           crashdir,
 		startTime:          time.Now(),
-		stats:              &Stats{haveHub: cfg.HubClient != ""},
-		crashTypes:         make(map[string]bool),
+		stats:              &Stats{haveHub: cfg.HubClient != "", haveValueProfile: cfg.ValueProfile},
+		crashTypes:         make(map[string]int),
+		vmStates:           newVMStates(vmCount),
 		disabledHashes:     make(map[string]struct{}),
 		memoryLeakFrames:   make(map[string]bool),
 		dataRaceFrames:     make(map[string]bool),
@@ -185,15 +214,27 @@ func RunManager(cfg *mgrconfig.Config) {
 		externalReproQueue: make(chan *Crash, 10),
 		needMoreRepros:     make(chan chan bool),
 		reproRequest:       make(chan chan map[string]bool),
+		reproStop:          make(chan reproStopRequest),
 		usedFiles:          make(map[string]time.Time),
 		saturatedCalls:     make(map[string]bool),
+		ablation:           cfg.Ablation,
+	}
+
+	if cfg.Profiling {
+		mgr.profEvents, _, err = profevent.OpenFile(filepath.Join(cfg.Workdir, profevent.FileName))
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
 	}
 
 	mgr.preloadCorpus()
+	mgr.loadPrios()
 	mgr.initStats() // Initializes prometheus variables.
 	mgr.initHTTP()  // Creates HTTP server.
 	mgr.collectUsedFiles()
 	go mgr.saveCorpus(corpusUpdates)
+	go mgr.prioSaveLoop()
+	go mgr.metaFlushLoop()
 
 	// Create RPC server for fuzzers.
 	mgr.serv, err = startRPCServer(mgr)
@@ -233,12 +274,23 @@ func RunManager(cfg *mgrconfig.Config) {
 			corpusSignal := mgr.stats.corpusSignal.get()
 			maxSignal := mgr.stats.maxSignal.get()
 			triageQLen := len(mgr.candidates)
+			corpusLen := mgr.corpus.Len()
 			mgr.mu.Unlock()
 			numReproducing := atomic.LoadUint32(&mgr.numReproducing)
 			numFuzzing := atomic.LoadUint32(&mgr.numFuzzing)
 
 			log.Logf(0, "VMs %v, executed %v, cover %v, signal %v/%v, crashes %v, repro %v, triageQLen %v",
 				numFuzzing, executed, corpusCover, corpusSignal, maxSignal, crashes, numReproducing, triageQLen)
+			if mgr.profEvents != nil {
+				r := mgr.stats.all()
+				r["num fuzzers"] = uint64(numFuzzing)
+				r["corpus size"] = corpusLen
+				r["triage queue"] = uint64(triageQLen)
+				r["num reproducing"] = uint64(numReproducing)
+				if err := mgr.profEvents.Emit(profevent.SourceManager, profevent.KindManagerStats, r); err != nil {
+					log.Logf(0, "failed to write manager stats event: %v", err)
+				}
+			}
 		}
 	}()
 
@@ -350,6 +402,7 @@ func (mgr *Manager) vmLoop() {
 			reproQueue = append(reproQueue, crash)
 		}
 
+		mgr.stats.reproQueue.set(len(reproQueue))
 		log.Logf(1, "loop: phase=%v shutdown=%v instances=%v/%v %+v repro: pending=%v reproducing=%v queued=%v",
 			phase, shutdown == nil, instances.Len(), vmCount, instances.Snapshot(),
 			len(pendingRepro), len(reproducing), len(reproQueue))
@@ -369,10 +422,15 @@ func (mgr *Manager) vmLoop() {
 				crash := reproQueue[last]
 				reproQueue[last] = nil
 				reproQueue = reproQueue[:last]
+				mgr.stats.reproQueue.set(len(reproQueue))
 				atomic.AddUint32(&mgr.numReproducing, 1)
+				mgr.vmStates.set(vmReproducing, vmIndexes...)
 				log.Logf(0, "loop: starting repro of '%v' on instances %+v", crash.Title, vmIndexes)
 				go func() {
-					reproDone <- mgr.runRepro(crash, vmIndexes, instances.Put)
+					reproDone <- mgr.runRepro(crash, vmIndexes, func(idxs ...int) {
+						mgr.vmStates.set(vmIdle, idxs...)
+						instances.Put(idxs...)
+					})
 				}()
 			}
 			for !canRepro() {
@@ -461,8 +519,41 @@ func (mgr *Manager) vmLoop() {
 			}
 			reply <- repros
 			goto wait
+		case req := <-mgr.reproStop:
+			req.reply <- dropRepro(req.title, pendingRepro, reproducing, &reproQueue)
+		}
+	}
+}
+
+// dropRepro removes the crash with the title from the pending and queued reproductions.
+func dropRepro(title string, pendingRepro map[*Crash]bool, reproducing map[string]bool,
+	reproQueue *[]*Crash) error {
+	dropped := false
+	for crash := range pendingRepro {
+		if crash.Title == title {
+			delete(pendingRepro, crash)
+			dropped = true
+		}
+	}
+	if reproducing[title] {
+		queued := false
+		for i, crash := range *reproQueue {
+			if crash.Title == title {
+				*reproQueue = append((*reproQueue)[:i], (*reproQueue)[i+1:]...)
+				queued = true
+				break
+			}
+		}
+		if !queued {
+			return fmt.Errorf("reproduction of '%v' is already running", title)
 		}
+		delete(reproducing, title)
+		dropped = true
 	}
+	if !dropped {
+		return fmt.Errorf("reproduction of '%v' is not queued", title)
+	}
+	return nil
 }
 
 func reportReproError(err error) {
@@ -595,6 +686,7 @@ func (mgr *Manager) preloadCorpus() {
 		log.Errorf("read %v inputs from corpus and got error: %v", len(corpusDB.Records), err)
 	}
 	mgr.corpusDB = corpusDB
+	mgr.openMetaDB()
 
 	if seedDir := filepath.Join(mgr.cfg.Syzkaller, "sys", mgr.cfg.TargetOS, "test"); osutil.IsExist(seedDir) {
 		seeds, err := os.ReadDir(seedDir)
@@ -635,19 +727,30 @@ func (mgr *Manager) loadCorpus() {
 		fallthrough
 	case currentDBVersion:
 	}
+	// Programs with metadata were already triaged with the current database version,
+	// so there is no need to re-minimize/re-smash them.
+	metas := mgr.loadMeta()
+	withMeta := 0
 	broken := 0
 	for key, rec := range mgr.corpusDB.Records {
-		if !mgr.loadProg(rec.Val, minimized, smashed) {
+		meta, hasMeta := metas[key]
+		hasMeta = hasMeta && mgr.metaDB.Version == currentDBVersion
+		if hasMeta {
+			withMeta++
+		}
+		valueProfile := hasMeta && len(meta.ValueProfile.Elems) != 0
+		if !mgr.loadProg(rec.Val, minimized || hasMeta, smashed || hasMeta, valueProfile) {
 			mgr.corpusDB.Delete(key)
 			broken++
 		}
 	}
+	mgr.corpus.RestoreMeta(metas)
 	mgr.fresh = len(mgr.corpusDB.Records) == 0
 	corpusSize := len(mgr.candidates)
-	log.Logf(0, "%-24v: %v (deleted %v broken)", "corpus", corpusSize, broken)
+	log.Logf(0, "%-24v: %v (deleted %v broken, %v with metadata)", "corpus", corpusSize, broken, withMeta)
 
 	for _, seed := range mgr.seeds {
-		mgr.loadProg(seed, true, false)
+		mgr.loadProg(seed, true, false, false)
 	}
 	log.Logf(0, "%-24v: %v/%v", "seeds", len(mgr.candidates)-corpusSize, len(mgr.seeds))
 	mgr.seeds = nil
@@ -668,7 +771,7 @@ func (mgr *Manager) loadCorpus() {
 	mgr.phase = phaseLoadedCorpus
 }
 
-func (mgr *Manager) loadProg(data []byte, minimized, smashed bool) bool {
+func (mgr *Manager) loadProg(data []byte, minimized, smashed, valueProfile bool) bool {
 	_, disabled, bad := parseProgram(mgr.target, mgr.targetEnabledSyscalls, data)
 	if bad != nil {
 		return false
@@ -695,9 +798,10 @@ func (mgr *Manager) loadProg(data []byte, minimized, smashed bool) bool {
 		return true
 	}
 	mgr.candidates = append(mgr.candidates, rpctype.Candidate{
-		Prog:      data,
-		Minimized: minimized,
-		Smashed:   smashed,
+		Prog:         data,
+		Minimized:    minimized,
+		Smashed:      smashed,
+		ValueProfile: valueProfile,
 	})
 	return true
 }
@@ -745,7 +849,9 @@ func (mgr *Manager) runInstance(index int) (*Crash, error) {
 	mgr.checkUsedFiles()
 	instanceName := fmt.Sprintf("vm-%d", index)
 
+	mgr.vmStates.set(vmBooting, index)
 	rep, vmInfo, err := mgr.runInstanceInner(index, instanceName)
+	mgr.vmStates.set(vmIdle, index)
 
 	machineInfo := mgr.serv.shutdownInstance(instanceName)
 	if len(vmInfo) != 0 {
@@ -830,6 +936,7 @@ func (mgr *Manager) runInstanceInner(index int, instanceName string) (*report.Re
 		},
 	}
 	cmd := instance.FuzzerCmd(args)
+	mgr.vmStates.set(vmFuzzing, index)
 	outc, errc, err := inst.Run(mgr.cfg.Timeouts.VMRunningTime, mgr.vmStop, cmd)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to run fuzzer: %w", err)
@@ -897,10 +1004,10 @@ func (mgr *Manager) saveCrash(crash *Crash) bool {
 
 	mgr.stats.crashes.inc()
 	mgr.mu.Lock()
-	if !mgr.crashTypes[crash.Title] {
-		mgr.crashTypes[crash.Title] = true
+	if mgr.crashTypes[crash.Title] == 0 {
 		mgr.stats.crashTypes.inc()
 	}
+	mgr.crashTypes[crash.Title]++
 	mgr.mu.Unlock()
 
 	if mgr.dash != nil {
@@ -991,7 +1098,7 @@ func (mgr *Manager) needLocalRepro(crash *Crash) bool {
 }
 
 func (mgr *Manager) needRepro(crash *Crash) bool {
-	if crash.fromHub || crash.fromDashboard {
+	if crash.fromHub || crash.fromDashboard || crash.manual {
 		return true
 	}
 	if mgr.checkResult == nil || (mgr.checkResult.Features[host.FeatureLeak].Enabled &&
@@ -1206,15 +1313,16 @@ func fullReproLog(stats *repro.Stats) []byte {
 
 func (mgr *Manager) saveCorpus(updates <-chan corpus.NewItemEvent) {
 	for update := range updates {
-		if update.Exists {
-			// We only save new progs into the corpus.db file.
-			continue
-		}
 		mgr.corpusDBMu.Lock()
-		mgr.corpusDB.Save(update.Sig, update.ProgData, 0)
-		if err := mgr.corpusDB.Flush(); err != nil {
-			log.Errorf("failed to save corpus database: %v", err)
+		// We only save new progs into the corpus.db file,
+		// but the metadata of the existing ones can change (e.g. get value profile signal).
+		if !update.Exists {
+			mgr.corpusDB.Save(update.Sig, update.ProgData, 0)
+			if err := mgr.corpusDB.Flush(); err != nil {
+				log.Errorf("failed to save corpus database: %v", err)
+			}
 		}
+		mgr.markMeta(update.Sig, true)
 		mgr.corpusDBMu.Unlock()
 	}
 }
@@ -1235,10 +1343,10 @@ func (mgr *Manager) getMinimizedCorpus() (corpus, repros [][]byte) {
 
 func (mgr *Manager) addNewCandidates(candidates []rpctype.Candidate) {
 	mgr.mu.Lock()
-	defer mgr.mu.Unlock()
 	if mgr.cfg.Experimental.ResetAccState {
 		// Don't accept new candidates -- the execution is already very slow,
 		// syz-hub will just overwhelm us.
+		mgr.mu.Unlock()
 		return
 	}
 
@@ -1246,6 +1354,11 @@ func (mgr *Manager) addNewCandidates(candidates []rpctype.Candidate) {
 	if mgr.phase == phaseTriagedCorpus {
 		mgr.phase = phaseQueriedHub
 	}
+	mgr.mu.Unlock()
+	// Push the candidates to the fuzzers that are waiting for them.
+	if mgr.serv != nil {
+		mgr.serv.wakeFuzzers()
+	}
 }
 
 func (mgr *Manager) minimizeCorpusUnlocked() {
@@ -1253,7 +1366,15 @@ func (mgr *Manager) minimizeCorpusUnlocked() {
 	if mgr.phase < phaseLoadedCorpus || currSize <= mgr.lastMinCorpus*103/100 {
 		return
 	}
-	mgr.corpus.Minimize(mgr.cfg.Cover)
+	if mgr.cfg.Distill.Enabled {
+		mgr.corpus.Distill(signal.DistillConfig{
+			Redundancy: mgr.cfg.Distill.Redundancy,
+			RareLimit:  mgr.cfg.Distill.RareLimit,
+			Budget:     mgr.cfg.Distill.Budget,
+		})
+	} else {
+		mgr.corpus.Minimize(mgr.cfg.Cover)
+	}
 	newSize := mgr.corpus.Stats().Progs
 
 	log.Logf(1, "minimized corpus: %v -> %v", currSize, newSize)
@@ -1306,6 +1427,18 @@ func (mgr *Manager) minimizeCorpusUnlocked() {
 		}
 	}
 	mgr.corpusDB.BumpVersion(currentDBVersion)
+	ancestors := mgr.corpus.Ancestors()
+	for key := range mgr.metaDB.Records {
+		if mgr.corpus.Item(key) != nil {
+			continue
+		}
+		if meta, ok := ancestors[key]; ok {
+			mgr.saveAncestorMeta(key, meta)
+			continue
+		}
+		mgr.metaDB.Delete(key)
+	}
+	mgr.metaDB.BumpVersion(currentDBVersion)
 }
 
 func setGuiltyFiles(crash *dashapi.Crash, report *report.Report) {
@@ -1357,7 +1490,7 @@ func (mgr *Manager) fuzzerConnect(modules []host.KernelModule) (
 	if !mgr.modulesInitialized {
 		var err error
 		mgr.modules = modules
-		mgr.execCoverFilter, mgr.coverFilter, err = mgr.createCoverageFilter()
+		mgr.execCoverFilter, mgr.coverFilter, err = mgr.createCoverageFilter(mgr.cfg.CovFilter)
 		if err != nil {
 			log.Fatalf("failed to create coverage filter: %v", err)
 		}
@@ -1433,6 +1566,20 @@ func (mgr *Manager) rotateCorpus() bool {
 	return mgr.phase == phaseTriagedHub
 }
 
+// profilingEvents writes events forwarded by a fuzzer to the profiling event stream.
+func (mgr *Manager) profilingEvents(name string, events []profevent.Event) {
+	if mgr.profEvents == nil {
+		return
+	}
+	for _, ev := range events {
+		ev.Source = name
+		if err := mgr.profEvents.Write(ev); err != nil {
+			log.Logf(0, "failed to write profiling event: %v", err)
+			return
+		}
+	}
+}
+
 func (mgr *Manager) collectUsedFiles() {
 	if mgr.vmPool == nil {
 		return
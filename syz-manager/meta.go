@@ -0,0 +1,167 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"time"
+
+	"github.com/google/syzkaller/pkg/corpus"
+	"github.com/google/syzkaller/pkg/db"
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/rpctype"
+	"github.com/google/syzkaller/pkg/signal"
+)
+
+// The fuzzing history of the corpus programs (corpus.ItemMeta) is kept in a sidecar
+// database next to corpus.db, the records are JSON-encoded and keyed by the program sig.
+const metaDBName = "corpus.meta.db"
+
+// The metadata changes are accumulated in memory and written out with this period,
+// otherwise every Poll would rewrite the records and the whole database file.
+const metaFlushPeriod = time.Minute
+
+func (mgr *Manager) openMetaDB() {
+	metaDB, err := db.Open(filepath.Join(mgr.cfg.Workdir, metaDBName), true)
+	if err != nil {
+		if metaDB == nil {
+			log.Fatalf("failed to open corpus metadata database: %v", err)
+		}
+		log.Errorf("read %v corpus metadata records and got error: %v", len(metaDB.Records), err)
+	}
+	mgr.metaDB = metaDB
+}
+
+// loadMeta returns the persisted metadata of the corpus programs.
+func (mgr *Manager) loadMeta() map[string]corpus.ItemMeta {
+	metas := make(map[string]corpus.ItemMeta)
+	for key, rec := range mgr.metaDB.Records {
+		var meta corpus.ItemMeta
+		if err := json.Unmarshal(rec.Val, &meta); err != nil {
+			log.Errorf("failed to parse corpus metadata of %v: %v", key, err)
+			mgr.metaDB.Delete(key)
+			continue
+		}
+		metas[key] = meta
+	}
+	return metas
+}
+
+// saveMeta must be called with corpusDBMu held.
+func (mgr *Manager) saveMeta(sig string, meta corpus.ItemMeta, sign, valueProfile signal.Signal) {
+	meta.Signal = sign.Serialize()
+	meta.ValueProfile = valueProfile.Serialize()
+	data, err := json.Marshal(meta)
+	if err != nil {
+		log.Errorf("failed to serialize corpus metadata: %v", err)
+		return
+	}
+	mgr.metaDB.Save(sig, data, 0)
+}
+
+// saveAncestorMeta keeps the lineage of a program that is no longer in the corpus,
+// but is an ancestor of the corpus programs (see corpus.Ancestors), its signal is dropped.
+// saveAncestorMeta must be called with corpusDBMu held.
+func (mgr *Manager) saveAncestorMeta(sig string, meta corpus.ItemMeta) {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		log.Errorf("failed to serialize corpus metadata: %v", err)
+		return
+	}
+	if rec, ok := mgr.metaDB.Records[sig]; ok && bytes.Equal(rec.Val, data) {
+		return
+	}
+	mgr.metaDB.Save(sig, data, 0)
+}
+
+// saveMetaCounters updates the record of the program with the new metadata,
+// but keeps the persisted signal as is: it does not change on counter-only updates,
+// and serializing it again is the expensive part of the record.
+// It returns false if there is no valid record to update.
+// saveMetaCounters must be called with corpusDBMu held.
+func (mgr *Manager) saveMetaCounters(sig string, meta corpus.ItemMeta) bool {
+	rec, ok := mgr.metaDB.Records[sig]
+	if !ok {
+		return false
+	}
+	var old, fields map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Val, &old); err != nil {
+		return false
+	}
+	meta.Signal, meta.ValueProfile = signal.Serial{}, signal.Serial{}
+	data, err := json.Marshal(meta)
+	if err == nil {
+		err = json.Unmarshal(data, &fields)
+	}
+	if err != nil {
+		log.Errorf("failed to serialize corpus metadata: %v", err)
+		return false
+	}
+	for _, key := range []string{"signal", "value_profile"} {
+		if val, ok := old[key]; ok {
+			fields[key] = val
+		}
+	}
+	if data, err = json.Marshal(fields); err != nil {
+		log.Errorf("failed to serialize corpus metadata: %v", err)
+		return false
+	}
+	mgr.metaDB.Save(sig, data, 0)
+	return true
+}
+
+// markMeta schedules the metadata of the program for saving (see flushMeta),
+// withSignal says if its signal has changed as well.
+// markMeta must be called with corpusDBMu held.
+func (mgr *Manager) markMeta(sig string, withSignal bool) {
+	if mgr.metaDirty == nil {
+		mgr.metaDirty = make(map[string]bool)
+	}
+	mgr.metaDirty[sig] = mgr.metaDirty[sig] || withSignal
+}
+
+// updateMeta merges the metadata changes reported by a fuzzer, they are persisted by metaFlushLoop.
+func (mgr *Manager) updateMeta(updates map[string]rpctype.ProgMeta) {
+	if len(updates) == 0 {
+		return
+	}
+	mgr.corpusDBMu.Lock()
+	defer mgr.corpusDBMu.Unlock()
+	for sig, delta := range updates {
+		if item := mgr.corpus.UpdateMeta(sig, delta); item != nil {
+			mgr.markMeta(sig, false)
+		}
+	}
+}
+
+func (mgr *Manager) metaFlushLoop() {
+	for range time.NewTicker(metaFlushPeriod).C {
+		mgr.flushMeta()
+	}
+}
+
+// flushMeta saves the metadata changes accumulated since the previous call.
+func (mgr *Manager) flushMeta() {
+	mgr.corpusDBMu.Lock()
+	defer mgr.corpusDBMu.Unlock()
+	if len(mgr.metaDirty) == 0 {
+		return
+	}
+	for sig, withSignal := range mgr.metaDirty {
+		item := mgr.corpus.Item(sig)
+		if item == nil {
+			// The program has been minimized out of the corpus.
+			continue
+		}
+		if withSignal || !mgr.saveMetaCounters(sig, item.Meta) {
+			mgr.saveMeta(sig, item.Meta, item.Signal, item.ValueProfile)
+		}
+	}
+	mgr.metaDirty = nil
+	if err := mgr.metaDB.Flush(); err != nil {
+		log.Errorf("failed to save corpus metadata database: %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/syzkaller/pkg/corpus"
+	"github.com/google/syzkaller/pkg/db"
+	"github.com/google/syzkaller/pkg/rpctype"
+	"github.com/google/syzkaller/pkg/signal"
+	"github.com/google/syzkaller/prog"
+	"github.com/google/syzkaller/sys/targets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlushMeta(t *testing.T) {
+	target, err := prog.GetTarget(targets.TestOS, targets.TestArch64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metaDB, err := db.Open(filepath.Join(t.TempDir(), metaDBName), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr := &Manager{
+		corpus: corpus.NewCorpus(context.Background()),
+		metaDB: metaDB,
+	}
+	p, err := target.Deserialize([]byte("test$int(0x1, 0x2, 0x3, 0x4, 0x5)\n"), prog.NonStrict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr.corpus.Save(corpus.NewInput{
+		Prog:   p,
+		Call:   0,
+		Signal: signal.FromRaw([]uint32{1, 2, 3}, 0),
+	})
+	sig := mgr.corpus.Items()[0].Sig
+	load := func() corpus.ItemMeta {
+		meta, ok := mgr.loadMeta()[sig]
+		assert.True(t, ok)
+		return meta
+	}
+
+	// Nothing is written until the flush.
+	mgr.corpusDBMu.Lock()
+	mgr.markMeta(sig, true)
+	mgr.corpusDBMu.Unlock()
+	assert.Empty(t, mgr.metaDB.Records)
+	mgr.flushMeta()
+	assert.Equal(t, 3, load().Signal.Deserialize().Len())
+
+	// Counter-only updates keep the persisted signal.
+	mgr.updateMeta(map[string]rpctype.ProgMeta{
+		sig: {Mutated: 2, Mutators: map[string]uint64{"squash": 1}},
+	})
+	mgr.flushMeta()
+	meta := load()
+	assert.Equal(t, uint64(2), meta.Mutated)
+	assert.Equal(t, map[string]uint64{"squash": 1}, meta.Mutators)
+	assert.Equal(t, 3, meta.Signal.Deserialize().Len())
+	assert.Nil(t, mgr.metaDirty)
+}
@@ -0,0 +1,245 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricsCollector exports the manager statistics on /metrics in the Prometheus format.
+// The values are collected on every scrape: the Stats counters are read directly,
+// the rest of the manager state comes from the snapshot callback.
+type metricsCollector struct {
+	stats    *Stats
+	snapshot func() *metricsSnapshot
+}
+
+// metricsSnapshot is the manager state that is not tracked in Stats.
+type metricsSnapshot struct {
+	uptime      time.Duration
+	fuzzingTime time.Duration
+	corpusProgs int
+	triageQueue int
+	reproducing int
+	vmStates    []vmState
+	// The number of crashes by title since the manager start.
+	crashes map[string]int
+	// See RPCServer.mutatorWeights.
+	mutatorWeights map[string]float64
+}
+
+type managerMetric struct {
+	desc    *prometheus.Desc
+	typ     prometheus.ValueType
+	stat    func(stats *Stats) *Stat
+	enabled func(stats *Stats) bool
+}
+
+func newManagerMetric(name, help string, typ prometheus.ValueType, stat func(stats *Stats) *Stat) managerMetric {
+	return managerMetric{
+		desc: prometheus.NewDesc(name, help, nil, nil),
+		typ:  typ,
+		stat: stat,
+	}
+}
+
+func hubMetric(m managerMetric) managerMetric {
+	m.enabled = func(stats *Stats) bool { return stats.haveHub }
+	return m
+}
+
+var managerMetrics = []managerMetric{
+	newManagerMetric("syz_exec_total", "Total executions during current execution of syz-manager",
+		prometheus.CounterValue, func(s *Stats) *Stat { return &s.execTotal }),
+	newManagerMetric("syz_crash_total", "Count of crashes during current execution of syz-manager",
+		prometheus.CounterValue, func(s *Stats) *Stat { return &s.crashes }),
+	newManagerMetric("syz_crash_types", "Number of distinct crash titles",
+		prometheus.GaugeValue, func(s *Stats) *Stat { return &s.crashTypes }),
+	newManagerMetric("syz_crash_suppressed_total", "Count of suppressed crashes",
+		prometheus.CounterValue, func(s *Stats) *Stat { return &s.crashSuppressed }),
+	newManagerMetric("syz_vm_restarts_total", "Count of VM restarts",
+		prometheus.CounterValue, func(s *Stats) *Stat { return &s.vmRestarts }),
+	newManagerMetric("syz_new_inputs_total", "Count of new inputs received from fuzzers",
+		prometheus.CounterValue, func(s *Stats) *Stat { return &s.newInputs }),
+	newManagerMetric("syz_rotated_inputs_total", "Count of inputs sent to fuzzers during corpus rotation",
+		prometheus.CounterValue, func(s *Stats) *Stat { return &s.rotatedInputs }),
+	newManagerMetric("syz_rpc_traffic_bytes_total", "RPC traffic between the manager and fuzzers",
+		prometheus.CounterValue, func(s *Stats) *Stat { return &s.rpcTraffic }),
+	newManagerMetric("syz_corpus_cover", "Corpus coverage during current execution of syz-manager",
+		prometheus.GaugeValue, func(s *Stats) *Stat { return &s.corpusCover }),
+	newManagerMetric("syz_corpus_cover_filtered", "Corpus coverage within the coverage filter",
+		prometheus.GaugeValue, func(s *Stats) *Stat { return &s.corpusCoverFiltered }),
+	newManagerMetric("syz_corpus_signal", "Corpus signal",
+		prometheus.GaugeValue, func(s *Stats) *Stat { return &s.corpusSignal }),
+	newManagerMetric("syz_max_signal", "Maximum signal observed by fuzzers",
+		prometheus.GaugeValue, func(s *Stats) *Stat { return &s.maxSignal }),
+	newManagerMetric("syz_repro_queue_length", "Number of crashes waiting for reproduction",
+		prometheus.GaugeValue, func(s *Stats) *Stat { return &s.reproQueue }),
+	{
+		desc:    prometheus.NewDesc("syz_corpus_value_profile", "Corpus value profile signal", nil, nil),
+		typ:     prometheus.GaugeValue,
+		stat:    func(s *Stats) *Stat { return &s.corpusValueProfile },
+		enabled: func(s *Stats) bool { return s.haveValueProfile },
+	},
+	hubMetric(newManagerMetric("syz_hub_send_prog_add_total", "Programs sent to syz-hub",
+		prometheus.CounterValue, func(s *Stats) *Stat { return &s.hubSendProgAdd })),
+	hubMetric(newManagerMetric("syz_hub_send_prog_del_total", "Program deletions sent to syz-hub",
+		prometheus.CounterValue, func(s *Stats) *Stat { return &s.hubSendProgDel })),
+	hubMetric(newManagerMetric("syz_hub_send_repro_total", "Reproducers sent to syz-hub",
+		prometheus.CounterValue, func(s *Stats) *Stat { return &s.hubSendRepro })),
+	hubMetric(newManagerMetric("syz_hub_recv_prog_total", "Programs received from syz-hub",
+		prometheus.CounterValue, func(s *Stats) *Stat { return &s.hubRecvProg })),
+	hubMetric(newManagerMetric("syz_hub_recv_prog_drop_total", "Programs received from syz-hub and dropped",
+		prometheus.CounterValue, func(s *Stats) *Stat { return &s.hubRecvProgDrop })),
+	hubMetric(newManagerMetric("syz_hub_recv_repro_total", "Reproducers received from syz-hub",
+		prometheus.CounterValue, func(s *Stats) *Stat { return &s.hubRecvRepro })),
+	hubMetric(newManagerMetric("syz_hub_recv_repro_drop_total", "Reproducers received from syz-hub and dropped",
+		prometheus.CounterValue, func(s *Stats) *Stat { return &s.hubRecvReproDrop })),
+}
+
+var (
+	metricUptime = prometheus.NewDesc("syz_uptime_seconds",
+		"Time since syz-manager start", nil, nil)
+	metricFuzzingTime = prometheus.NewDesc("syz_fuzzing_seconds_total",
+		"Total time VMs spent fuzzing", nil, nil)
+	metricCorpusProgs = prometheus.NewDesc("syz_corpus_programs",
+		"Number of programs in the corpus", nil, nil)
+	metricTriageQueue = prometheus.NewDesc("syz_triage_queue_length",
+		"Number of corpus and syz-hub programs waiting for triage", nil, nil)
+	metricReproducing = prometheus.NewDesc("syz_repro_running",
+		"Number of running reproductions", nil, nil)
+	metricVMState = prometheus.NewDesc("syz_vm_state",
+		"State of each VM (1 for the current state, 0 for the others)", []string{"vm", "state"}, nil)
+	metricCrashes = prometheus.NewDesc("syz_crashes_total",
+		"Count of crashes by title", []string{"title"}, nil)
+	metricFuzzerStat = prometheus.NewDesc("syz_fuzzer_stat_total",
+		"Fuzzer statistics summed over all fuzzers", []string{"stat"}, nil)
+	metricMutatorWeight = prometheus.NewDesc("syz_mutator_weight",
+		"Share of the mutator in the adapted mutator weights averaged over fuzzers", []string{"mutator"}, nil)
+)
+
+func newMetricsCollector(stats *Stats, snapshot func() *metricsSnapshot) *metricsCollector {
+	return &metricsCollector{
+		stats:    stats,
+		snapshot: snapshot,
+	}
+}
+
+func (mc *metricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, m := range managerMetrics {
+		ch <- m.desc
+	}
+	ch <- metricUptime
+	ch <- metricFuzzingTime
+	ch <- metricCorpusProgs
+	ch <- metricTriageQueue
+	ch <- metricReproducing
+	ch <- metricVMState
+	ch <- metricCrashes
+	ch <- metricFuzzerStat
+	ch <- metricMutatorWeight
+}
+
+func (mc *metricsCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range managerMetrics {
+		if m.enabled != nil && !m.enabled(mc.stats) {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(m.desc, m.typ, float64(m.stat(mc.stats).get()))
+	}
+	for name, val := range mc.stats.named() {
+		ch <- prometheus.MustNewConstMetric(metricFuzzerStat, prometheus.CounterValue, float64(val), name)
+	}
+	snap := mc.snapshot()
+	ch <- prometheus.MustNewConstMetric(metricUptime, prometheus.GaugeValue, snap.uptime.Seconds())
+	ch <- prometheus.MustNewConstMetric(metricFuzzingTime, prometheus.CounterValue, snap.fuzzingTime.Seconds())
+	ch <- prometheus.MustNewConstMetric(metricCorpusProgs, prometheus.GaugeValue, float64(snap.corpusProgs))
+	ch <- prometheus.MustNewConstMetric(metricTriageQueue, prometheus.GaugeValue, float64(snap.triageQueue))
+	ch <- prometheus.MustNewConstMetric(metricReproducing, prometheus.GaugeValue, float64(snap.reproducing))
+	for idx, state := range snap.vmStates {
+		for s, name := range vmStateNames {
+			val := 0.0
+			if vmState(s) == state {
+				val = 1
+			}
+			ch <- prometheus.MustNewConstMetric(metricVMState, prometheus.GaugeValue, val,
+				fmt.Sprintf("vm-%v", idx), name)
+		}
+	}
+	for title, count := range snap.crashes {
+		ch <- prometheus.MustNewConstMetric(metricCrashes, prometheus.CounterValue, float64(count), title)
+	}
+	for name, share := range snap.mutatorWeights {
+		ch <- prometheus.MustNewConstMetric(metricMutatorWeight, prometheus.GaugeValue, share, name)
+	}
+}
+
+func (mgr *Manager) metricsSnapshot() *metricsSnapshot {
+	var mutatorWeights map[string]float64
+	if mgr.serv != nil {
+		// Must be done before locking mgr.mu, serv.mu is locked first.
+		mutatorWeights = mgr.serv.mutatorWeights()
+	}
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	snap := &metricsSnapshot{
+		uptime:      time.Since(mgr.startTime),
+		fuzzingTime: mgr.fuzzingTime,
+		corpusProgs: mgr.corpus.Stats().Progs,
+		triageQueue: len(mgr.candidates),
+		reproducing: int(atomic.LoadUint32(&mgr.numReproducing)),
+		vmStates:    mgr.vmStates.snapshot(),
+		crashes:     make(map[string]int, len(mgr.crashTypes)),
+	}
+	for title, count := range mgr.crashTypes {
+		snap.crashes[title] = count
+	}
+	snap.mutatorWeights = mutatorWeights
+	return snap
+}
+
+type vmState int
+
+const (
+	vmIdle vmState = iota
+	vmBooting
+	vmFuzzing
+	vmReproducing
+)
+
+var vmStateNames = []string{
+	vmIdle:        "idle",
+	vmBooting:     "booting",
+	vmFuzzing:     "fuzzing",
+	vmReproducing: "reproducing",
+}
+
+// vmStates tracks what each VM of the pool is busy with.
+type vmStates struct {
+	mu     sync.Mutex
+	states []vmState
+}
+
+func newVMStates(count int) *vmStates {
+	return &vmStates{states: make([]vmState, count)}
+}
+
+func (vs *vmStates) set(state vmState, indexes ...int) {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	for _, idx := range indexes {
+		vs.states[idx] = state
+	}
+}
+
+func (vs *vmStates) snapshot() []vmState {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	return append([]vmState{}, vs.states...)
+}
@@ -0,0 +1,95 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func TestMetrics(t *testing.T) {
+	stats := &Stats{haveHub: true}
+	stats.execTotal.add(1000)
+	stats.crashes.add(3)
+	stats.corpusSignal.set(42)
+	stats.hubRecvProg.add(7)
+	stats.mergeNamed(map[string]uint64{
+		"exec total": 24,
+		"exec gen":   5,
+	})
+	snapshot := func() *metricsSnapshot {
+		return &metricsSnapshot{
+			uptime:      time.Minute,
+			corpusProgs: 10,
+			triageQueue: 2,
+			vmStates:    []vmState{vmFuzzing, vmReproducing},
+			crashes: map[string]int{
+				"KASAN: use-after-free Read in foo": 2,
+				`WARNING in "bar"`:                  1,
+			},
+			mutatorWeights: map[string]float64{"splice": 0.25},
+		}
+	}
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(newMetricsCollector(stats, snapshot)); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("scrape failed: %v", resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := make(map[string]bool)
+	for _, line := range strings.Split(string(body), "\n") {
+		lines[line] = true
+	}
+	for _, want := range []string{
+		"# TYPE syz_exec_total counter",
+		"syz_exec_total 1024",
+		"syz_crash_total 3",
+		"# TYPE syz_corpus_signal gauge",
+		"syz_corpus_signal 42",
+		"syz_hub_recv_prog_total 7",
+		"syz_corpus_programs 10",
+		"syz_triage_queue_length 2",
+		"syz_uptime_seconds 60",
+		`syz_fuzzer_stat_total{stat="exec gen"} 5`,
+		`syz_vm_state{state="fuzzing",vm="vm-0"} 1`,
+		`syz_vm_state{state="idle",vm="vm-0"} 0`,
+		`syz_vm_state{state="reproducing",vm="vm-1"} 1`,
+		"# TYPE syz_crashes_total counter",
+		`syz_crashes_total{title="KASAN: use-after-free Read in foo"} 2`,
+		`syz_crashes_total{title="WARNING in \"bar\""} 1`,
+		"# TYPE syz_mutator_weight gauge",
+		`syz_mutator_weight{mutator="splice"} 0.25`,
+	} {
+		if !lines[want] {
+			t.Errorf("no %q in the scraped metrics", want)
+		}
+	}
+	for _, unwanted := range []string{"syz_corpus_value_profile", `stat="exec total"`} {
+		if strings.Contains(string(body), unwanted) {
+			t.Errorf("unexpected %q in the scraped metrics", unwanted)
+		}
+	}
+	if t.Failed() {
+		t.Logf("scraped metrics:\n%s", body)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/osutil"
+	"github.com/google/syzkaller/prog"
+)
+
+// The call-to-call priorities learned from the corpus (prog.PrioMatrix) are periodically saved
+// in the workdir. After restart they serve as the prior for the fuzzer choice tables until
+// the corpus is triaged again. They are also exchanged with other managers via syz-hub.
+const (
+	prioFileName   = "prios.json"
+	prioSavePeriod = 30 * time.Minute
+)
+
+func (mgr *Manager) loadPrios() {
+	data, err := os.ReadFile(filepath.Join(mgr.cfg.Workdir, prioFileName))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Errorf("failed to read call priorities: %v", err)
+		}
+		return
+	}
+	prios := new(prog.PrioMatrix)
+	if err := json.Unmarshal(data, prios); err != nil {
+		log.Errorf("failed to parse call priorities: %v", err)
+		return
+	}
+	log.Logf(0, "loaded call priorities learned from %v programs", prios.Progs)
+	mgr.prios = prios
+}
+
+func (mgr *Manager) prioSaveLoop() {
+	for range time.NewTicker(prioSavePeriod).C {
+		mgr.mu.Lock()
+		prior := mgr.prios
+		mgr.mu.Unlock()
+		// The previously saved priorities stay in the prior until the corpus is as large as it was.
+		prios := mgr.target.LearnPrioMatrix(mgr.corpus.Programs(), prior)
+		data, err := json.Marshal(prios)
+		if err != nil {
+			log.Errorf("failed to serialize call priorities: %v", err)
+			continue
+		}
+		if err := osutil.WriteFile(filepath.Join(mgr.cfg.Workdir, prioFileName), data); err != nil {
+			log.Errorf("failed to save call priorities: %v", err)
+		}
+		mgr.mu.Lock()
+		mgr.prios = prios
+		mgr.compactPrios = nil
+		mgr.mu.Unlock()
+	}
+}
+
+// prioPrior returns the priorities passed to the fuzzers: the own learned ones and the ones
+// received from other managers.
+func (mgr *Manager) prioPrior() *prog.CompactPrioMatrix {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	return mgr.prioPriorLocked()
+}
+
+// prioPriorLocked builds the prior only once the priorities change,
+// it's used for every fuzzer connection.
+func (mgr *Manager) prioPriorLocked() *prog.CompactPrioMatrix {
+	if mgr.compactPrios == nil {
+		prior := new(prog.PrioMatrix)
+		prior.Merge(mgr.prios)
+		prior.Merge(mgr.hubPrios)
+		mgr.compactPrios = mgr.target.CompactPrioMatrix(prior)
+	}
+	return mgr.compactPrios
+}
+
+// learnedPrios returns the own learned priorities for export to syz-hub.
+func (mgr *Manager) learnedPrios() *prog.PrioMatrix {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	return mgr.prios
+}
+
+func (mgr *Manager) importPrios(prios *prog.PrioMatrix) {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	mgr.hubPrios = prios
+	mgr.compactPrios = nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/osutil"
+	"github.com/google/syzkaller/pkg/replay"
+	"github.com/google/syzkaller/pkg/rpctype"
+)
+
+// replayLog is the file the replay records of a single fuzzer process are written to.
+type replayLog struct {
+	file   *os.File
+	writer *replay.Writer
+}
+
+func (serv *RPCServer) initReplay() error {
+	seed := serv.cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	log.Logf(0, "deterministic mode, seed %v", seed)
+	serv.replayRnd = rand.New(rand.NewSource(seed))
+	return osutil.MkdirAll(filepath.Join(serv.cfg.Workdir, replay.Dir))
+}
+
+// connectReplay hands out the seed to a newly connected fuzzer and opens its replay log.
+// Must be called with serv.mu held.
+func (serv *RPCServer) connectReplay(f *Fuzzer, r *rpctype.ConnectRes) error {
+	r.Deterministic = true
+	r.Seed = serv.replayRnd.Int63()
+	serv.replayConns++
+	file := filepath.Join(serv.cfg.Workdir, replay.Dir, fmt.Sprintf("%v-%v.jsonl", f.name, serv.replayConns))
+	out, err := os.Create(file)
+	if err != nil {
+		return fmt.Errorf("failed to create replay log: %w", err)
+	}
+	log.Logf(1, "fuzzer %v got seed %v, replay log %v", f.name, r.Seed, file)
+	f.replay = &replayLog{
+		file:   out,
+		writer: replay.NewWriter(out),
+	}
+	return nil
+}
+
+func (serv *RPCServer) replayRecords(name string, records []replay.Record) {
+	if len(records) == 0 {
+		return
+	}
+	serv.mu.Lock()
+	var rl *replayLog
+	if f := serv.fuzzers[name]; f != nil {
+		rl = f.replay
+	}
+	serv.mu.Unlock()
+	if rl == nil {
+		log.Logf(1, "replay: fuzzer %v is not connected", name)
+		return
+	}
+	if err := rl.writer.Write(records); err != nil {
+		log.Logf(0, "%v", err)
+	}
+}
+
+func (rl *replayLog) close() {
+	if rl != nil {
+		rl.file.Close()
+	}
+}
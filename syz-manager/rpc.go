@@ -1,5 +1,3 @@
-//go:build !profiling
-
 // Copyright 2018 syzkaller project authors. All rights reserved.
 // Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
 
@@ -17,8 +15,10 @@ import (
 	"github.com/google/syzkaller/pkg/host"
 	"github.com/google/syzkaller/pkg/log"
 	"github.com/google/syzkaller/pkg/mgrconfig"
+	"github.com/google/syzkaller/pkg/profevent"
 	"github.com/google/syzkaller/pkg/rpctype"
 	"github.com/google/syzkaller/pkg/signal"
+	"github.com/google/syzkaller/profiler"
 	"github.com/google/syzkaller/prog"
 )
 
@@ -28,7 +28,6 @@ type RPCServer struct {
 	modules               []host.KernelModule
 	port                  int
 	targetEnabledSyscalls map[*prog.Syscall]bool
-	coverFilter           map[uint32]uint32
 	stats                 *Stats
 	batchSize             int
 	canonicalModules      *cover.Canonicalizer
@@ -46,6 +45,17 @@ type RPCServer struct {
 	rotator       *prog.Rotator
 	rnd           *rand.Rand
 	checkFailures int
+	// Value profile signal of the corpus (see signal.ValueProfile).
+	corpusValueProfile signal.Signal
+	// The current coverage filter for statistics and for the executor (see createCoverageFilter).
+	coverFilter     map[uint32]uint32
+	execCoverFilter map[uint32]uint32
+	// All coverage filter epochs, the last one is the current one.
+	coverFilterEpochs []*CoverFilterEpoch
+
+	// Source of the fuzzer seeds in the deterministic mode.
+	replayRnd   *rand.Rand
+	replayConns int
 }
 
 type Fuzzer struct {
@@ -56,6 +66,24 @@ type Fuzzer struct {
 	rotatedSignal signal.Signal
 	machineInfo   []byte
 	instModules   *cover.CanonicalizerInstance
+	// Version of the ablation configuration last sent to the fuzzer.
+	ablationVersion int
+	// The coverage filter epoch last sent to the fuzzer.
+	coverFilterEpoch int
+	// Set only in the deterministic mode.
+	replay *replayLog
+	// The last seed scheduler energies reported by the fuzzer.
+	seedEnergy map[string]float64
+	// The last adapted mutator weights reported by the fuzzer.
+	mutatorWeights map[string]float64
+	// The connection used to push updates to the fuzzer (nil in the deterministic mode).
+	conn *rpctype.StreamConn
+	// Signals pushLoop that there may be something to push.
+	wake chan struct{}
+	// Set once the fuzzer has polled, i.e. it's ready to receive pushes.
+	polled bool
+	// The fuzzer asked for candidates, but there were none at the time.
+	needCandidates bool
 }
 
 type BugFrames struct {
@@ -71,6 +99,10 @@ type RPCManagerView interface {
 	newInput(inp corpus.NewInput) bool
 	candidateBatch(size int) []rpctype.Candidate
 	rotateCorpus() bool
+	currentAblation() (profiler.AblationConfiguration, int)
+	profilingEvents(name string, events []profevent.Event)
+	updateMeta(updates map[string]rpctype.ProgMeta)
+	prioPrior() *prog.CompactPrioMatrix
 }
 
 func startRPCServer(mgr *Manager) (*RPCServer, error) {
@@ -85,7 +117,12 @@ func startRPCServer(mgr *Manager) (*RPCServer, error) {
 	if serv.batchSize < mgr.cfg.Procs {
 		serv.batchSize = mgr.cfg.Procs
 	}
-	s, err := rpctype.NewRPCServer(mgr.cfg.RPC, "Manager", serv)
+	if mgr.cfg.Deterministic {
+		if err := serv.initReplay(); err != nil {
+			return nil, err
+		}
+	}
+	s, err := rpctype.NewStreamServer(mgr.cfg.RPC, "Manager", serv)
 	if err != nil {
 		return nil, err
 	}
@@ -101,7 +138,7 @@ func startRPCServer(mgr *Manager) (*RPCServer, error) {
 	return serv, nil
 }
 
-func (serv *RPCServer) Connect(a *rpctype.ConnectArgs, r *rpctype.ConnectRes) error {
+func (serv *RPCServer) Connect(conn *rpctype.StreamConn, a *rpctype.ConnectArgs, r *rpctype.ConnectRes) error {
 	log.Logf(1, "fuzzer %v connected", a.Name)
 	serv.stats.vmRestarts.inc()
 
@@ -113,26 +150,57 @@ func (serv *RPCServer) Connect(a *rpctype.ConnectArgs, r *rpctype.ConnectRes) er
 	if err != nil {
 		return err
 	}
-	serv.coverFilter = coverFilter
 
 	serv.mu.Lock()
 	defer serv.mu.Unlock()
 
+	if serv.coverFilterEpochs == nil {
+		if _, err := serv.startCoverFilterEpoch(serv.cfg.CovFilter, coverFilter, execCoverFilter); err != nil {
+			return err
+		}
+	}
+
 	f := &Fuzzer{
 		name:        a.Name,
 		machineInfo: a.MachineInfo,
 		instModules: serv.canonicalModules.NewInstance(a.Modules),
 	}
+	if old := serv.fuzzers[a.Name]; old != nil {
+		old.close()
+	}
+	if serv.cfg.Deterministic {
+		if err := serv.connectReplay(f, r); err != nil {
+			return err
+		}
+	} else {
+		// In the deterministic mode the fuzzer must get everything at fixed points, i.e. in polls.
+		f.conn = conn
+		f.wake = make(chan struct{}, 1)
+		go serv.pushLoop(f)
+	}
 	serv.fuzzers[a.Name] = f
 	r.MemoryLeakFrames = bugFrames.memoryLeaks
 	r.DataRaceFrames = bugFrames.dataRaces
 
-	instCoverFilter := f.instModules.DecanonicalizeFilter(execCoverFilter)
+	instCoverFilter := f.instModules.DecanonicalizeFilter(serv.execCoverFilter)
 	r.CoverFilterBitmap = createCoverageBitmap(serv.cfg.SysTarget, instCoverFilter)
+	f.coverFilterEpoch = len(serv.coverFilterEpochs) - 1
+	r.CoverFilterEpoch = f.coverFilterEpoch
 	r.EnabledCalls = serv.cfg.Syscalls
 	r.NoMutateCalls = serv.cfg.NoMutateCalls
 	r.GitRevision = prog.GitRevision
 	r.TargetRevision = serv.cfg.Target.Revision
+	r.Ablation, f.ablationVersion = serv.mgr.currentAblation()
+	r.Profiling = serv.cfg.Profiling
+	r.LogNewPCs = serv.cfg.LogNewPCs
+	r.GenerateProbability = serv.cfg.GenerateProbability
+	r.SeedSchedule = serv.cfg.SeedSchedule
+	r.Scheduling = serv.cfg.Scheduling
+	r.ValueProfile = serv.cfg.ValueProfile
+	if !serv.cfg.Deterministic {
+		// The replay builds the choice tables only from the recorded programs.
+		r.Prios = serv.mgr.prioPrior()
+	}
 	if serv.mgr.rotateCorpus() && serv.rnd.Intn(5) == 0 {
 		// We do rotation every other time because there are no objective
 		// proofs regarding its efficiency either way.
@@ -282,19 +350,27 @@ func (serv *RPCServer) NewInput(a *rpctype.NewInputArgs, r *int) error {
 		a.Cover, a.Signal = f.instModules.Canonicalize(a.Cover, a.Signal)
 	}
 	inputSignal := a.Signal.Deserialize()
+	inputValueProfile := a.ValueProfile.Deserialize()
 
 	inp := corpus.NewInput{
 		Prog:   p,
 		Call:   a.Call,
 		Signal: inputSignal,
 		Cover:  a.Cover,
+		Lineage: corpus.Lineage{
+			Parent:   a.Parent,
+			Mutators: a.Mutators,
+		},
+		ValueProfile: inputValueProfile,
+		ExecTime:     a.Input.ExecTime,
 	}
 
 	log.Logf(4, "new input from %v for syscall %v (signal=%v, cover=%v)",
 		a.Name, inp.StringCall(), inputSignal.Len(), len(a.Cover))
 	// Note: f may be nil if we called shutdownInstance,
 	// but this request is already in-flight.
-	genuine := !serv.corpusSignal.Diff(inputSignal).Empty()
+	genuine := !serv.corpusSignal.Diff(inputSignal).Empty() ||
+		!serv.corpusValueProfile.Diff(inputValueProfile).Empty()
 	rotated := false
 	if !genuine && f != nil && f.rotated {
 		rotated = !f.rotatedSignal.Diff(inputSignal).Empty()
@@ -324,6 +400,11 @@ func (serv *RPCServer) NewInput(a *rpctype.NewInputArgs, r *int) error {
 			}
 		}
 		serv.stats.corpusCoverFiltered.add(filtered)
+		if filtered != 0 {
+			epoch := serv.coverFilterEpochs[len(serv.coverFilterEpochs)-1]
+			epoch.NewCover += filtered
+			epoch.NewInputs++
+		}
 	}
 	serv.stats.newInputs.inc()
 	if rotated {
@@ -333,6 +414,8 @@ func (serv *RPCServer) NewInput(a *rpctype.NewInputArgs, r *int) error {
 	if genuine {
 		serv.corpusSignal.Merge(inputSignal)
 		serv.stats.corpusSignal.set(serv.corpusSignal.Len())
+		serv.corpusValueProfile.Merge(inputValueProfile)
+		serv.stats.corpusValueProfile.set(serv.corpusValueProfile.Len())
 
 		a.Input.Cover = nil // Don't send coverage back to all fuzzers.
 		a.Input.RawCover = nil
@@ -341,6 +424,7 @@ func (serv *RPCServer) NewInput(a *rpctype.NewInputArgs, r *int) error {
 				continue
 			}
 			other.inputs = append(other.inputs, a.Input)
+			other.wakeUp()
 		}
 	}
 	return nil
@@ -348,6 +432,9 @@ func (serv *RPCServer) NewInput(a *rpctype.NewInputArgs, r *int) error {
 
 func (serv *RPCServer) Poll(a *rpctype.PollArgs, r *rpctype.PollRes) error {
 	serv.stats.mergeNamed(a.Stats)
+	serv.mgr.profilingEvents(a.Name, a.ProfilingEvents)
+	serv.replayRecords(a.Name, a.ReplayRecords)
+	serv.mgr.updateMeta(a.ProgMeta)
 
 	serv.mu.Lock()
 	defer serv.mu.Unlock()
@@ -359,6 +446,12 @@ func (serv *RPCServer) Poll(a *rpctype.PollArgs, r *rpctype.PollRes) error {
 		log.Logf(1, "poll: fuzzer %v is not connected", a.Name)
 		return nil
 	}
+	f.polled = true
+	if a.SeedEnergy != nil {
+		f.seedEnergy = a.SeedEnergy
+	}
+	// The weights are not sent once they are no longer adaptive.
+	f.mutatorWeights = a.MutatorWeights
 	newMaxSignal := serv.maxSignal.Diff(a.MaxSignal.Deserialize())
 	if !newMaxSignal.Empty() {
 		serv.maxSignal.Merge(newMaxSignal)
@@ -368,8 +461,14 @@ func (serv *RPCServer) Poll(a *rpctype.PollArgs, r *rpctype.PollRes) error {
 				continue
 			}
 			f1.newMaxSignal.Merge(newMaxSignal)
+			f1.wakeUp()
 		}
 	}
+	if ablation, version := serv.mgr.currentAblation(); version != f.ablationVersion {
+		f.ablationVersion = version
+		r.Ablation = &ablation
+	}
+	r.CoverFilter = serv.coverFilterUpdate(f)
 	if f.rotated {
 		// Let rotated VMs run in isolation, don't send them anything.
 		return nil
@@ -378,6 +477,7 @@ func (serv *RPCServer) Poll(a *rpctype.PollArgs, r *rpctype.PollRes) error {
 	if a.NeedCandidates {
 		r.Candidates = serv.mgr.candidateBatch(serv.batchSize)
 	}
+	f.needCandidates = a.NeedCandidates && len(r.Candidates) == 0
 	if len(r.Candidates) == 0 {
 		batchSize := serv.batchSize
 		// When the fuzzer starts, it pumps the whole corpus.
@@ -403,9 +503,110 @@ func (serv *RPCServer) Poll(a *rpctype.PollArgs, r *rpctype.PollRes) error {
 	}
 	log.Logf(4, "poll from %v: candidates=%v inputs=%v maxsignal=%v",
 		a.Name, len(r.Candidates), len(r.NewInputs), len(r.MaxSignal.Elems))
+	if len(f.inputs) != 0 || !f.newMaxSignal.Empty() {
+		f.wakeUp()
+	}
 	return nil
 }
 
+// pushLoop sends the fuzzer new inputs, max signal, candidates, ablation and coverage filter changes
+// as they appear, so that it does not need to wait for the next poll.
+func (serv *RPCServer) pushLoop(f *Fuzzer) {
+	for {
+		select {
+		case <-f.wake:
+		case <-f.conn.Done():
+			return
+		}
+		args := serv.pushArgs(f)
+		if args == nil {
+			continue
+		}
+		log.Logf(4, "push to %v: candidates=%v inputs=%v maxsignal=%v",
+			f.name, len(args.Candidates), len(args.NewInputs), len(args.MaxSignal.Elems))
+		if err := f.conn.Push("Fuzzer.Push", args); err != nil {
+			log.Logf(1, "failed to push to fuzzer %v: %v", f.name, err)
+			return
+		}
+	}
+}
+
+func (serv *RPCServer) pushArgs(f *Fuzzer) *rpctype.PushArgs {
+	serv.mu.Lock()
+	defer serv.mu.Unlock()
+	if serv.fuzzers[f.name] != f || !f.polled {
+		return nil
+	}
+	args := &rpctype.PushArgs{}
+	empty := true
+	if ablation, version := serv.mgr.currentAblation(); version != f.ablationVersion {
+		f.ablationVersion = version
+		args.Ablation = &ablation
+		empty = false
+	}
+	if args.CoverFilter = serv.coverFilterUpdate(f); args.CoverFilter != nil {
+		empty = false
+	}
+	if f.rotated {
+		// Let rotated VMs run in isolation, don't send them anything.
+		if empty {
+			return nil
+		}
+		return args
+	}
+	args.MaxSignal = f.newMaxSignal.Split(2000).Serialize()
+	if f.needCandidates {
+		args.Candidates = serv.mgr.candidateBatch(serv.batchSize)
+		f.needCandidates = len(args.Candidates) == 0
+	}
+	if len(args.Candidates) == 0 {
+		for i := 0; i < serv.batchSize && len(f.inputs) > 0; i++ {
+			last := len(f.inputs) - 1
+			inp := f.inputs[last]
+			inp.Cover, inp.Signal = f.instModules.Decanonicalize(inp.Cover, inp.Signal)
+			args.NewInputs = append(args.NewInputs, inp)
+			f.inputs[last] = rpctype.Input{}
+			f.inputs = f.inputs[:last]
+		}
+		if len(f.inputs) == 0 {
+			f.inputs = nil
+		}
+	}
+	if len(f.inputs) != 0 || !f.newMaxSignal.Empty() {
+		f.wakeUp()
+	}
+	if empty && len(args.MaxSignal.Elems) == 0 && len(args.Candidates) == 0 && len(args.NewInputs) == 0 {
+		return nil
+	}
+	return args
+}
+
+// wakeFuzzers makes all fuzzers check whether there is something to push to them.
+func (serv *RPCServer) wakeFuzzers() {
+	serv.mu.Lock()
+	defer serv.mu.Unlock()
+	for _, f := range serv.fuzzers {
+		f.wakeUp()
+	}
+}
+
+func (f *Fuzzer) wakeUp() {
+	if f.wake == nil {
+		return
+	}
+	select {
+	case f.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (f *Fuzzer) close() {
+	f.replay.close()
+	if f.conn != nil {
+		f.conn.Close()
+	}
+}
+
 func (serv *RPCServer) shutdownInstance(name string) []byte {
 	serv.mu.Lock()
 	defer serv.mu.Unlock()
@@ -415,6 +616,7 @@ func (serv *RPCServer) shutdownInstance(name string) []byte {
 		return nil
 	}
 	delete(serv.fuzzers, name)
+	fuzzer.close()
 	return fuzzer.machineInfo
 }
 
@@ -422,3 +624,32 @@ func (serv *RPCServer) LogMessage(m *rpctype.LogMessageReq, r *int) error {
 	log.Logf(m.Level, "%s: %s", m.Name, m.Message)
 	return nil
 }
+
+// seedEnergy returns the seed scheduler energies of the corpus programs
+// averaged over the fuzzers that have reported them.
+func (serv *RPCServer) seedEnergy() map[string]float64 {
+	return serv.fuzzersAverage(func(f *Fuzzer) map[string]float64 { return f.seedEnergy })
+}
+
+// mutatorWeights returns the shares of the mutators in the adapted mutator weights
+// averaged over the fuzzers that have reported them.
+func (serv *RPCServer) mutatorWeights() map[string]float64 {
+	return serv.fuzzersAverage(func(f *Fuzzer) map[string]float64 { return f.mutatorWeights })
+}
+
+func (serv *RPCServer) fuzzersAverage(values func(f *Fuzzer) map[string]float64) map[string]float64 {
+	serv.mu.Lock()
+	defer serv.mu.Unlock()
+	sum := make(map[string]float64)
+	count := make(map[string]int)
+	for _, f := range serv.fuzzers {
+		for key, val := range values(f) {
+			sum[key] += val
+			count[key]++
+		}
+	}
+	for key := range sum {
+		sum[key] /= float64(count[key])
+	}
+	return sum
+}
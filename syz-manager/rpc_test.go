@@ -0,0 +1,204 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/pkg/cover"
+	"github.com/google/syzkaller/pkg/cover/backend"
+	"github.com/google/syzkaller/pkg/host"
+	"github.com/google/syzkaller/pkg/mgrconfig"
+	"github.com/google/syzkaller/pkg/rpctype"
+	"github.com/google/syzkaller/pkg/signal"
+	"github.com/google/syzkaller/sys/targets"
+	"github.com/stretchr/testify/assert"
+)
+
+type testPushReceiver struct {
+	pushes chan *rpctype.PushArgs
+}
+
+func (tr *testPushReceiver) Push(a *rpctype.PushArgs, r *int) error {
+	tr.pushes <- a
+	return nil
+}
+
+func TestPush(t *testing.T) {
+	mgr := &Manager{
+		cfg:   &mgrconfig.Config{},
+		phase: phaseTriagedHub,
+	}
+	serv := &RPCServer{
+		mgr:       mgr,
+		cfg:       mgr.cfg,
+		stats:     &Stats{},
+		fuzzers:   make(map[string]*Fuzzer),
+		batchSize: 2,
+	}
+	mgr.serv = serv
+	receiver := &testPushReceiver{pushes: make(chan *rpctype.PushArgs, 16)}
+	serverConn, clientConn, err := rpctype.StreamLoopback("Manager", serv, "Fuzzer", receiver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientConn.Close()
+	f := &Fuzzer{
+		name:         "vm-0",
+		instModules:  cover.NewCanonicalizer(nil, false).NewInstance(nil),
+		conn:         serverConn,
+		wake:         make(chan struct{}, 1),
+		inputs:       []rpctype.Input{{Call: 0}, {Call: 1}, {Call: 2}},
+		newMaxSignal: signal.FromRaw([]uint32{1, 2, 3}, 0),
+	}
+	serv.fuzzers[f.name] = f
+	go serv.pushLoop(f)
+	recv := func() *rpctype.PushArgs {
+		select {
+		case args := <-receiver.pushes:
+			return args
+		case <-time.After(10 * time.Second):
+			t.Fatal("no push")
+			return nil
+		}
+	}
+
+	// Nothing is pushed before the fuzzer polls.
+	f.wakeUp()
+	select {
+	case args := <-receiver.pushes:
+		t.Fatalf("unexpected push before poll: %+v", args)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	serv.mu.Lock()
+	f.polled = true
+	f.wakeUp()
+	serv.mu.Unlock()
+	// The corpus is pushed in batches until it's all sent.
+	args := recv()
+	assert.Equal(t, 3, len(args.MaxSignal.Elems))
+	assert.Equal(t, []rpctype.Input{{Call: 2}, {Call: 1}}, args.NewInputs)
+	args = recv()
+	assert.Equal(t, []rpctype.Input{{Call: 0}}, args.NewInputs)
+
+	// The fuzzer waiting for candidates gets them once they appear.
+	serv.mu.Lock()
+	f.needCandidates = true
+	serv.mu.Unlock()
+	mgr.addNewCandidates([]rpctype.Candidate{{Prog: []byte("prog")}})
+	args = recv()
+	assert.Equal(t, []rpctype.Candidate{{Prog: []byte("prog")}}, args.Candidates)
+
+	// Ablation changes are pushed right away.
+	mgr.mu.Lock()
+	mgr.ablation.DisableModeNgram = true
+	mgr.ablationVersion++
+	mgr.mu.Unlock()
+	serv.wakeFuzzers()
+	args = recv()
+	if assert.NotNil(t, args.Ablation) {
+		assert.True(t, args.Ablation.DisableModeNgram)
+	}
+
+	// Nothing is pushed after the fuzzer is gone.
+	serv.shutdownInstance(f.name)
+	<-clientConn.Done()
+	assert.Empty(t, receiver.pushes)
+}
+
+func TestCoverFilterEpochs(t *testing.T) {
+	rg := &cover.ReportGenerator{
+		Impl: &backend.Impl{
+			RestorePC: func(pc uint32) uint64 { return uint64(pc) },
+		},
+	}
+	oldGetReportGenerator := getReportGenerator
+	getReportGenerator = func(*mgrconfig.Config, []host.KernelModule) (*cover.ReportGenerator, error) {
+		return rg, nil
+	}
+	defer func() { getReportGenerator = oldGetReportGenerator }()
+
+	dir := t.TempDir()
+	pcsFile := filepath.Join(dir, "pcs")
+	if err := os.WriteFile(pcsFile, []byte("0x81000000\n0x81000010\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	emptyFile := filepath.Join(dir, "empty")
+	if err := os.WriteFile(emptyFile, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &mgrconfig.Config{Cover: true}
+	cfg.SysTarget = targets.Get(targets.Linux, targets.AMD64)
+	mgr := &Manager{
+		cfg:                cfg,
+		stats:              &Stats{},
+		modulesInitialized: true,
+	}
+	serv := &RPCServer{
+		mgr:         mgr,
+		cfg:         mgr.cfg,
+		stats:       mgr.stats,
+		fuzzers:     make(map[string]*Fuzzer),
+		corpusCover: cover.Cover{0x81000000: {}, 0x82000000: {}},
+	}
+	mgr.serv = serv
+	f := &Fuzzer{
+		name:        "vm-0",
+		instModules: cover.NewCanonicalizer(nil, false).NewInstance(nil),
+	}
+	serv.fuzzers[f.name] = f
+	serv.mu.Lock()
+	_, err := serv.startCoverFilterEpoch(mgrconfig.CovFilterCfg{}, nil, nil)
+	serv.mu.Unlock()
+	assert.NoError(t, err)
+	update := func() *rpctype.CoverFilterUpdate {
+		serv.mu.Lock()
+		defer serv.mu.Unlock()
+		return serv.coverFilterUpdate(f)
+	}
+	assert.Nil(t, update())
+
+	// The new filter is accounted from the coverage the corpus already has.
+	filter := mgrconfig.CovFilterCfg{RawPCs: []string{pcsFile}}
+	epoch, err := mgr.setCoverFilter(filter)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, epoch.Epoch)
+	assert.Equal(t, filter, epoch.Filter)
+	assert.Equal(t, 2, epoch.PCs)
+	assert.Equal(t, 1, epoch.StartCover)
+	assert.Equal(t, uint64(1), mgr.stats.corpusCoverFiltered.get())
+	assert.Len(t, mgr.coverFilter, 2)
+
+	// The fuzzer gets the new bitmap once.
+	upd := update()
+	if assert.NotNil(t, upd) {
+		assert.Equal(t, 1, upd.Epoch)
+		assert.NotNil(t, upd.Bitmap)
+	}
+	assert.Nil(t, update())
+
+	// A filter that matches nothing is rejected.
+	_, err = mgr.setCoverFilter(mgrconfig.CovFilterCfg{RawPCs: []string{emptyFile}})
+	assert.Error(t, err)
+	assert.Nil(t, update())
+
+	// An empty filter disables filtering.
+	epoch, err = mgr.setCoverFilter(mgrconfig.CovFilterCfg{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, epoch.Epoch)
+	assert.Equal(t, 0, epoch.PCs)
+	assert.Nil(t, mgr.coverFilter)
+	upd = update()
+	if assert.NotNil(t, upd) {
+		assert.Equal(t, 2, upd.Epoch)
+		assert.Nil(t, upd.Bitmap)
+	}
+	history := serv.coverFilterHistory()
+	assert.Len(t, history, 3)
+	assert.Equal(t, 1, history[1].StartCover)
+}
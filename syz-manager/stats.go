@@ -8,7 +8,6 @@ import (
 	"sync/atomic"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
 type Stat uint64
@@ -32,33 +31,19 @@ type Stats struct {
 	corpusCover         Stat
 	corpusCoverFiltered Stat
 	corpusSignal        Stat
+	corpusValueProfile  Stat
 	maxSignal           Stat
+	reproQueue          Stat
 
-	mu         sync.Mutex
-	namedStats map[string]uint64
-	haveHub    bool
+	mu               sync.Mutex
+	namedStats       map[string]uint64
+	haveHub          bool
+	haveValueProfile bool
 }
 
 func (mgr *Manager) initStats() {
 	// Prometheus Instrumentation https://prometheus.io/docs/guides/go-application .
-	prometheus.Register(promauto.NewGaugeFunc(prometheus.GaugeOpts{
-		Name: "syz_exec_total",
-		Help: "Total executions during current execution of syz-manager",
-	},
-		func() float64 { return float64(mgr.stats.execTotal.get()) },
-	))
-	prometheus.Register(promauto.NewGaugeFunc(prometheus.GaugeOpts{
-		Name: "syz_corpus_cover",
-		Help: "Corpus coverage during current execution of syz-manager",
-	},
-		func() float64 { return float64(mgr.stats.corpusCover.get()) },
-	))
-	prometheus.Register(promauto.NewGaugeFunc(prometheus.GaugeOpts{
-		Name: "syz_crash_total",
-		Help: "Count of crashes during current execution of syz-manager",
-	},
-		func() float64 { return float64(mgr.stats.crashes.get()) },
-	))
+	prometheus.MustRegister(newMetricsCollector(mgr.stats, mgr.metricsSnapshot))
 }
 
 func (stats *Stats) all() map[string]uint64 {
@@ -76,6 +61,9 @@ func (stats *Stats) all() map[string]uint64 {
 		"max signal":        stats.maxSignal.get(),
 		"rpc traffic (MB)":  stats.rpcTraffic.get() / 1e6,
 	}
+	if stats.haveValueProfile {
+		m["value profile"] = stats.corpusValueProfile.get()
+	}
 	if stats.haveHub {
 		m["hub: send prog add"] = stats.hubSendProgAdd.get()
 		m["hub: send prog del"] = stats.hubSendProgDel.get()
@@ -93,6 +81,17 @@ func (stats *Stats) all() map[string]uint64 {
 	return m
 }
 
+// named returns the statistics received from fuzzers.
+func (stats *Stats) named() map[string]uint64 {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	m := make(map[string]uint64, len(stats.namedStats))
+	for k, v := range stats.namedStats {
+		m[k] = v
+	}
+	return m
+}
+
 func (stats *Stats) mergeNamed(named map[string]uint64) {
 	stats.mu.Lock()
 	defer stats.mu.Unlock()
@@ -5,6 +5,9 @@
 // First, run syz-manager with -bench=old flag.
 // Then, do experimental modifications and run syz-manager again with -bench=new flag.
 // Then, run syz-benchcmp old new.
+// To compare groups of repeated runs (e.g. several runs of each configuration),
+// run syz-benchcmp base=old/*.txt new=new/*.txt, this produces a report with
+// median and inter-quartile bands, effect sizes and p-values.
 package main
 
 import (
@@ -26,6 +29,8 @@ var (
 	flagOut  = flag.String("out", "", "file to save graphs to; if empty, a random name will be generated")
 	flagOver = flag.String("over", "fuzzing", "the variable that lies on the X axis")
 	flagSkip = flag.Int("skip", -30, "skip that many seconds after start (skip first 20% by default)")
+	flagTTC  = flag.String("ttc", "50%,75%,90%,100%", "in group mode, coverage values to report time to; "+
+		"values with % are relative to the final median coverage of the first group")
 )
 
 type Graph struct {
@@ -43,6 +48,7 @@ func main() {
 	flag.Parse()
 	if len(flag.Args()) == 0 {
 		fmt.Fprintf(os.Stderr, "usage: syz-benchcmp [flags] bench_file0 [bench_file1 [bench_file2]]...\n")
+		fmt.Fprintf(os.Stderr, "       syz-benchcmp [flags] name0=pattern[,pattern...] [name1=pattern...]...\n")
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
@@ -56,6 +62,10 @@ func main() {
 			"crash types": true,
 		}
 	}
+	if isGroupArg(flag.Args()[0]) {
+		compareGroups(flag.Args(), allowedGraphs)
+		return
+	}
 	points := make(map[string][]Point)
 	headers := []string{}
 	for i, fname := range flag.Args() {
@@ -220,19 +230,7 @@ func getAxisTitle() string {
 }
 
 func display(graphs []*Graph) {
-	var outf *os.File
-	var err error
-	if *flagOut == "" {
-		outf, err = os.CreateTemp("", "*.html")
-		if err != nil {
-			tool.Failf("failed to create temp file: %v", err)
-		}
-	} else {
-		outf, err = os.Create(*flagOut)
-		if err != nil {
-			tool.Failf("failed to create file: %v", err)
-		}
-	}
+	outf := createOutputFile()
 	vars := map[string]interface{}{
 		"Graphs":     graphs,
 		"HAxisTitle": getAxisTitle(),
@@ -241,7 +239,11 @@ func display(graphs []*Graph) {
 		tool.Failf("failed to execute template: %v", err)
 	}
 	outf.Close()
-	if err := exec.Command("xdg-open", outf.Name()).Start(); err != nil {
+	openInBrowser(outf.Name())
+}
+
+func openInBrowser(file string) {
+	if err := exec.Command("xdg-open", file).Start(); err != nil {
 		tool.Failf("failed to start browser: %v", err)
 	}
 }
@@ -0,0 +1,465 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/syzkaller/pkg/stats"
+	"github.com/google/syzkaller/pkg/tool"
+)
+
+// Group mode compares groups of repeated runs of several configurations.
+// Each group is given as name=pattern[,pattern...], where patterns are globs of bench files.
+// The first group is the baseline the other groups are compared against.
+
+// RunGroup is a set of bench files produced by repeated runs of the same configuration.
+type RunGroup struct {
+	Name string
+	Runs [][]map[string]uint64
+}
+
+// Band describes the distribution of a variable among the runs of a group over time.
+type Band struct {
+	Group  string
+	Q1     []float64
+	Median []float64
+	Q3     []float64
+}
+
+type FinalStat struct {
+	Group  string
+	Runs   int
+	Median float64
+	Q1     float64
+	Q3     float64
+	// Comparison with the baseline group (not set for the baseline itself).
+	A12       float64
+	Magnitude string
+	PValue    string
+}
+
+type VarReport struct {
+	Name  string
+	Times []float64
+	Bands []Band
+	Final []FinalStat
+	Chart template.HTML
+}
+
+type TimeToCoverage struct {
+	Coverage uint64
+	Groups   []TimeToCoverageGroup
+}
+
+type TimeToCoverageGroup struct {
+	Group   string
+	Reached int
+	Runs    int
+	Median  string
+}
+
+var groupNameRe = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// isGroupArg says whether arg is a group rather than a bench file.
+// Bench file paths may contain '=' too, so the part before the first '=' must be a bare name.
+func isGroupArg(arg string) bool {
+	name, _, ok := strings.Cut(arg, "=")
+	return ok && groupNameRe.MatchString(name)
+}
+
+func parseGroups(args []string) []*RunGroup {
+	var groups []*RunGroup
+	names := map[string]bool{}
+	for _, arg := range args {
+		if !isGroupArg(arg) {
+			tool.Failf("bad group %q, expected name=pattern[,pattern...]"+
+				" where name consists of letters, digits, '_', '.' and '-'", arg)
+		}
+		name, patterns, _ := strings.Cut(arg, "=")
+		if names[name] {
+			tool.Failf("duplicate group %v", name)
+		}
+		names[name] = true
+		group := &RunGroup{Name: name}
+		for _, pattern := range strings.Split(patterns, ",") {
+			files, err := filepath.Glob(pattern)
+			if err != nil {
+				tool.Failf("bad pattern %q: %v", pattern, err)
+			}
+			for _, file := range files {
+				data := readFile(file)
+				sort.Slice(data, func(i, j int) bool {
+					return data[i][*flagOver] < data[j][*flagOver]
+				})
+				if len(data) != 0 {
+					group.Runs = append(group.Runs, data)
+				}
+			}
+		}
+		if len(group.Runs) == 0 {
+			tool.Failf("group %v has no non-empty bench files", name)
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// valueAt returns the value of the variable at the given moment,
+// linearly interpolated between the neighbouring records.
+func valueAt(run []map[string]uint64, key string, at float64) float64 {
+	idx := sort.Search(len(run), func(i int) bool {
+		return float64(run[i][*flagOver]) >= at
+	})
+	if idx == len(run) {
+		return float64(run[len(run)-1][key])
+	}
+	next := run[idx]
+	if idx == 0 || float64(next[*flagOver]) == at {
+		return float64(next[key])
+	}
+	prev := run[idx-1]
+	prevTime, nextTime := float64(prev[*flagOver]), float64(next[*flagOver])
+	prevVal, nextVal := float64(prev[key]), float64(next[key])
+	return prevVal + (nextVal-prevVal)*(at-prevTime)/(nextTime-prevTime)
+}
+
+// commonHorizon returns the duration covered by all runs of all groups.
+func commonHorizon(groups []*RunGroup) float64 {
+	horizon := math.Inf(1)
+	for _, group := range groups {
+		for _, run := range group.Runs {
+			horizon = math.Min(horizon, float64(run[len(run)-1][*flagOver]))
+		}
+	}
+	return horizon
+}
+
+func groupVars(groups []*RunGroup, allowed map[string]bool) []string {
+	keys := map[string]bool{}
+	for _, group := range groups {
+		for _, run := range group.Runs {
+			for key := range run[len(run)-1] {
+				if key != *flagOver && (allowed == nil || allowed[key]) {
+					keys[key] = true
+				}
+			}
+		}
+	}
+	var ret []string
+	for key := range keys {
+		ret = append(ret, key)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func sampleAt(group *RunGroup, key string, at float64) *stats.Sample {
+	sample := &stats.Sample{}
+	for _, run := range group.Runs {
+		sample.Xs = append(sample.Xs, valueAt(run, key, at))
+	}
+	return sample
+}
+
+func analyzeVar(groups []*RunGroup, key string, horizon float64) *VarReport {
+	const points = 200
+	report := &VarReport{Name: key}
+	for i := 0; i <= points; i++ {
+		report.Times = append(report.Times, horizon*float64(i)/points)
+	}
+	var base *stats.Sample
+	for i, group := range groups {
+		band := Band{Group: group.Name}
+		for _, at := range report.Times {
+			sample := sampleAt(group, key, at)
+			band.Q1 = append(band.Q1, sample.Percentile(0.25))
+			band.Median = append(band.Median, sample.Median())
+			band.Q3 = append(band.Q3, sample.Percentile(0.75))
+		}
+		report.Bands = append(report.Bands, band)
+
+		final := sampleAt(group, key, horizon)
+		stat := FinalStat{
+			Group:  group.Name,
+			Runs:   len(group.Runs),
+			Median: final.Median(),
+			Q1:     final.Percentile(0.25),
+			Q3:     final.Percentile(0.75),
+		}
+		if i == 0 {
+			base = final
+		} else {
+			stat.A12 = stats.VarghaDelaneyA12(final, base)
+			stat.Magnitude = stats.A12Magnitude(stat.A12)
+			stat.PValue = "n/a"
+			if pval, err := stats.UTest(base, final); err == nil {
+				stat.PValue = fmt.Sprintf("%.3f", pval)
+			}
+		}
+		report.Final = append(report.Final, stat)
+	}
+	report.Chart = renderChart(report)
+	return report
+}
+
+// parseCoverageTargets parses the -ttc flag. Values with the % suffix are relative
+// to the final median coverage of the baseline group, they are skipped if there is no coverage.
+func parseCoverageTargets(spec string, baseline float64) []uint64 {
+	var ret []uint64
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if percent, ok := strings.CutSuffix(item, "%"); ok {
+			val, err := strconv.ParseFloat(percent, 64)
+			if err != nil {
+				tool.Failf("bad -ttc value %q: %v", item, err)
+			}
+			if baseline != 0 {
+				ret = append(ret, uint64(baseline*val/100))
+			}
+			continue
+		}
+		val, err := strconv.ParseUint(item, 10, 64)
+		if err != nil {
+			tool.Failf("bad -ttc value %q: %v", item, err)
+		}
+		ret = append(ret, val)
+	}
+	return ret
+}
+
+// timeToCoverage returns the first moment the run reached the coverage.
+func timeToCoverage(run []map[string]uint64, coverage uint64) (uint64, bool) {
+	for _, record := range run {
+		if record["coverage"] >= coverage {
+			return record[*flagOver], true
+		}
+	}
+	return 0, false
+}
+
+func analyzeTimeToCoverage(groups []*RunGroup, targets []uint64) []TimeToCoverage {
+	var ret []TimeToCoverage
+	for _, target := range targets {
+		ttc := TimeToCoverage{Coverage: target}
+		for _, group := range groups {
+			sample := &stats.Sample{}
+			for _, run := range group.Runs {
+				if at, ok := timeToCoverage(run, target); ok {
+					sample.Xs = append(sample.Xs, float64(at))
+				}
+			}
+			res := TimeToCoverageGroup{
+				Group:   group.Name,
+				Reached: len(sample.Xs),
+				Runs:    len(group.Runs),
+				Median:  "-",
+			}
+			if len(sample.Xs) != 0 {
+				res.Median = formatOver(sample.Median())
+			}
+			ttc.Groups = append(ttc.Groups, res)
+		}
+		ret = append(ret, ttc)
+	}
+	return ret
+}
+
+func formatOver(val float64) string {
+	if *flagOver == "fuzzing" {
+		return (time.Duration(val) * time.Second).String()
+	}
+	return fmt.Sprintf("%.0f", val)
+}
+
+func compareGroups(args []string, allowed map[string]bool) {
+	groups := parseGroups(args)
+	horizon := commonHorizon(groups)
+	var vars []*VarReport
+	var baseCoverage float64
+	for _, key := range groupVars(groups, allowed) {
+		report := analyzeVar(groups, key, horizon)
+		vars = append(vars, report)
+		if key == "coverage" {
+			baseCoverage = report.Final[0].Median
+		}
+	}
+	ttc := analyzeTimeToCoverage(groups, parseCoverageTargets(*flagTTC, baseCoverage))
+	printGroupStats(vars, ttc)
+
+	outf := createOutputFile()
+	data := map[string]interface{}{
+		"Groups":         groups,
+		"Horizon":        formatOver(horizon),
+		"Vars":           vars,
+		"TimeToCoverage": ttc,
+	}
+	if err := groupsTemplate.Execute(outf, data); err != nil {
+		tool.Failf("failed to execute template: %v", err)
+	}
+	outf.Close()
+	openInBrowser(outf.Name())
+}
+
+func printGroupStats(vars []*VarReport, ttc []TimeToCoverage) {
+	fmt.Printf("%-16v%-16v%6v%12v%24v%8v%12v%10v\n",
+		"", "group", "runs", "median", "IQR", "A12", "effect", "p-value")
+	for _, v := range vars {
+		for _, stat := range v.Final {
+			a12 := ""
+			if stat.Magnitude != "" {
+				a12 = fmt.Sprintf("%.2f", stat.A12)
+			}
+			fmt.Printf("%-16v%-16v%6v%12.0f%24v%8v%12v%10v\n", v.Name, stat.Group, stat.Runs, stat.Median,
+				fmt.Sprintf("%.0f-%.0f", stat.Q1, stat.Q3), a12, stat.Magnitude, stat.PValue)
+		}
+	}
+	fmt.Printf("\n")
+	for _, target := range ttc {
+		for _, group := range target.Groups {
+			fmt.Printf("time to coverage %-10v%-16v%v/%v reached, median %v\n",
+				target.Coverage, group.Group, group.Reached, group.Runs, group.Median)
+		}
+	}
+}
+
+var chartColors = []string{"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd",
+	"#8c564b", "#e377c2", "#7f7f7f", "#bcbd22", "#17becf"}
+
+// renderChart draws the median lines and the inter-quartile bands as an inline SVG,
+// so that the report does not depend on any external resources.
+func renderChart(report *VarReport) template.HTML {
+	const (
+		width  = 640
+		height = 320
+		left   = 70
+		right  = 10
+		top    = 25
+		bottom = 30
+	)
+	maxX := report.Times[len(report.Times)-1]
+	maxY := 0.0
+	for _, band := range report.Bands {
+		for _, val := range band.Q3 {
+			maxY = math.Max(maxY, val)
+		}
+	}
+	if maxX == 0 {
+		maxX = 1
+	}
+	if maxY == 0 {
+		maxY = 1
+	}
+	px := func(x float64) float64 { return left + x/maxX*(width-left-right) }
+	py := func(y float64) float64 { return height - bottom - y/maxY*(height-top-bottom) }
+	buf := new(strings.Builder)
+	fmt.Fprintf(buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%v" height="%v">`, width, height)
+	fmt.Fprintf(buf, `<text x="%v" y="15" font-weight="bold">%v</text>`, left, template.HTMLEscapeString(report.Name))
+	fmt.Fprintf(buf, `<rect x="%v" y="%v" width="%v" height="%v" fill="none" stroke="#999"/>`,
+		left, top, width-left-right, height-top-bottom)
+	fmt.Fprintf(buf, `<text x="%v" y="%v" text-anchor="end" font-size="11">%.0f</text>`, left-4, top+10, maxY)
+	fmt.Fprintf(buf, `<text x="%v" y="%v" text-anchor="end" font-size="11">0</text>`, left-4, height-bottom)
+	fmt.Fprintf(buf, `<text x="%v" y="%v" text-anchor="end" font-size="11">%v</text>`,
+		width-right, height-bottom+15, template.HTMLEscapeString(formatOver(maxX)))
+	for i, band := range report.Bands {
+		color := chartColors[i%len(chartColors)]
+		var area, median []string
+		for j, x := range report.Times {
+			area = append(area, fmt.Sprintf("%.1f,%.1f", px(x), py(band.Q3[j])))
+			median = append(median, fmt.Sprintf("%.1f,%.1f", px(x), py(band.Median[j])))
+		}
+		for j := len(report.Times) - 1; j >= 0; j-- {
+			area = append(area, fmt.Sprintf("%.1f,%.1f", px(report.Times[j]), py(band.Q1[j])))
+		}
+		fmt.Fprintf(buf, `<polygon points="%v" fill="%v" fill-opacity="0.2" stroke="none"/>`,
+			strings.Join(area, " "), color)
+		fmt.Fprintf(buf, `<polyline points="%v" fill="none" stroke="%v" stroke-width="1.5"/>`,
+			strings.Join(median, " "), color)
+		fmt.Fprintf(buf, `<text x="%v" y="%v" fill="%v" font-size="11">%v</text>`,
+			left+8, top+15+i*13, color, template.HTMLEscapeString(band.Group))
+	}
+	buf.WriteString(`</svg>`)
+	// nolint: gosec // all the data is escaped above
+	return template.HTML(buf.String())
+}
+
+var groupsTemplate = template.Must(
+	template.New("").Parse(`
+<!doctype html>
+<html>
+<head>
+	<title>Syzkaller Bench Comparison</title>
+	<style>
+		body { font-family: sans-serif; font-size: 13px; }
+		table { border-collapse: collapse; margin-bottom: 20px; }
+		td, th { border: 1px solid #ccc; padding: 3px 8px; text-align: right; }
+		th { background: #eee; }
+		.chart { display: inline-block; margin: 5px; }
+	</style>
+</head>
+<body>
+	<h2>Groups</h2>
+	<table>
+		<tr><th>Group</th><th>Runs</th></tr>
+		{{range .Groups}}<tr><td>{{.Name}}</td><td>{{len .Runs}}</td></tr>{{end}}
+	</table>
+	<p>
+		Values are compared at {{.Horizon}} (the duration covered by all runs).
+		A12 is the Vargha-Delaney effect size relative to the first group,
+		p-values are given by the Mann-Whitney U test.
+	</p>
+	<h2>Final values</h2>
+	<table>
+		<tr><th>Variable</th><th>Group</th><th>Median</th><th>IQR</th><th>A12</th><th>Effect</th><th>p-value</th></tr>
+		{{range $var := .Vars}}{{range .Final}}
+		<tr>
+			<td>{{$var.Name}}</td><td>{{.Group}}</td><td>{{printf "%.0f" .Median}}</td>
+			<td>{{printf "%.0f" .Q1}} - {{printf "%.0f" .Q3}}</td>
+			<td>{{if .Magnitude}}{{printf "%.2f" .A12}}{{end}}</td><td>{{.Magnitude}}</td><td>{{.PValue}}</td>
+		</tr>
+		{{end}}{{end}}
+	</table>
+	{{if .TimeToCoverage}}
+	<h2>Time to coverage</h2>
+	<table>
+		<tr><th>Coverage</th><th>Group</th><th>Reached</th><th>Median time</th></tr>
+		{{range $ttc := .TimeToCoverage}}{{range .Groups}}
+		<tr>
+			<td>{{$ttc.Coverage}}</td><td>{{.Group}}</td><td>{{.Reached}}/{{.Runs}}</td><td>{{.Median}}</td>
+		</tr>
+		{{end}}{{end}}
+	</table>
+	{{end}}
+	<h2>Median and inter-quartile range over time</h2>
+	{{range .Vars}}<div class="chart">{{.Chart}}</div>{{end}}
+</body>
+</html>
+`))
+
+func createOutputFile() *os.File {
+	if *flagOut == "" {
+		outf, err := os.CreateTemp("", "*.html")
+		if err != nil {
+			tool.Failf("failed to create temp file: %v", err)
+		}
+		return outf
+	}
+	outf, err := os.Create(*flagOut)
+	if err != nil {
+		tool.Failf("failed to create file: %v", err)
+	}
+	return outf
+}
@@ -0,0 +1,109 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func testRun() []map[string]uint64 {
+	return []map[string]uint64{
+		{"fuzzing": 10, "coverage": 100},
+		{"fuzzing": 20, "coverage": 200},
+		{"fuzzing": 40, "coverage": 200},
+		{"fuzzing": 50, "coverage": 500},
+	}
+}
+
+func TestValueAt(t *testing.T) {
+	tests := []struct {
+		at   float64
+		want float64
+	}{
+		{0, 100},
+		{10, 100},
+		{15, 150},
+		{20, 200},
+		{30, 200},
+		{45, 350},
+		{50, 500},
+		{100, 500},
+	}
+	run := testRun()
+	for _, test := range tests {
+		if got := valueAt(run, "coverage", test.at); got != test.want {
+			t.Errorf("valueAt(%v) = %v, want %v", test.at, got, test.want)
+		}
+	}
+}
+
+func TestTimeToCoverage(t *testing.T) {
+	tests := []struct {
+		coverage uint64
+		want     uint64
+		reached  bool
+	}{
+		{0, 10, true},
+		{100, 10, true},
+		{101, 20, true},
+		{200, 20, true},
+		{300, 50, true},
+		{500, 50, true},
+		{501, 0, false},
+	}
+	run := testRun()
+	for _, test := range tests {
+		got, reached := timeToCoverage(run, test.coverage)
+		if got != test.want || reached != test.reached {
+			t.Errorf("timeToCoverage(%v) = %v/%v, want %v/%v",
+				test.coverage, got, reached, test.want, test.reached)
+		}
+	}
+}
+
+func TestParseCoverageTargets(t *testing.T) {
+	tests := []struct {
+		spec     string
+		baseline float64
+		want     []uint64
+	}{
+		{"", 1000, nil},
+		{"100", 0, []uint64{100}},
+		{"100, 200,", 1000, []uint64{100, 200}},
+		{"50%,90%", 1000, []uint64{500, 900}},
+		{"50%,300", 0, []uint64{300}},
+		{"12.5%", 200, []uint64{25}},
+	}
+	for i, test := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			got := parseCoverageTargets(test.spec, test.baseline)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("parseCoverageTargets(%q, %v) = %v, want %v",
+					test.spec, test.baseline, got, test.want)
+			}
+		})
+	}
+}
+
+func TestIsGroupArg(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want bool
+	}{
+		{"base=runs/base-*.json", true},
+		{"value-profile_2.0=a.json,b.json", true},
+		{"bench.json", false},
+		{"runs/seed=1/bench.json", false},
+		{"./seed=1.json", false},
+		{"=bench.json", false},
+		{"a*=bench.json", false},
+	}
+	for _, test := range tests {
+		if got := isGroupArg(test.arg); got != test.want {
+			t.Errorf("isGroupArg(%q) = %v, want %v", test.arg, got, test.want)
+		}
+	}
+}
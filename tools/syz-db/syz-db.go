@@ -4,18 +4,23 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/google/syzkaller/pkg/corpus"
 	"github.com/google/syzkaller/pkg/db"
 	"github.com/google/syzkaller/pkg/hash"
 	"github.com/google/syzkaller/pkg/osutil"
+	"github.com/google/syzkaller/pkg/signal"
 	"github.com/google/syzkaller/pkg/tool"
 	"github.com/google/syzkaller/prog"
 	_ "github.com/google/syzkaller/sys"
@@ -26,7 +31,13 @@ func main() {
 		flagVersion = flag.Uint64("version", 0, "database version")
 		flagOS      = flag.String("os", "", "target OS")
 		flagArch    = flag.String("arch", "", "target arch")
+		flagDistill signal.DistillConfig
 	)
+	flag.IntVar(&flagDistill.Redundancy, "redundancy", signal.DefaultDistillRedundancy,
+		"distill: number of programs kept for each rare signal element")
+	flag.IntVar(&flagDistill.RareLimit, "rare_limit", signal.DefaultDistillRareLimit,
+		"distill: signal elements covered by at most this many programs are rare")
+	flag.IntVar(&flagDistill.Budget, "budget", 0, "distill: maximum number of programs to keep (0 - no limit)")
 	flag.Parse()
 	args := flag.Args()
 	if len(args) == 0 {
@@ -67,6 +78,11 @@ func main() {
 			usage()
 		}
 		merge(args[1], args[2:], target)
+	case "distill":
+		if len(args) != 4 {
+			usage()
+		}
+		distill(args[1], args[2], args[3], target, flagDistill)
 	default:
 		usage()
 	}
@@ -78,6 +94,8 @@ func usage() {
 	fmt.Fprintf(os.Stderr, "  syz-db unpack corpus.db dir\n")
 	fmt.Fprintf(os.Stderr, "  syz-db merge dst-corpus.db add-corpus.db* add-prog*\n")
 	fmt.Fprintf(os.Stderr, "  syz-db bench corpus.db\n")
+	fmt.Fprintf(os.Stderr, "  syz-db [-os OS -arch ARCH] [-redundancy N] [-rare_limit N] [-budget N] distill"+
+		" corpus.db corpus.meta.db dst-corpus.db\n")
 	os.Exit(1)
 }
 
@@ -167,6 +185,74 @@ func merge(file string, adds []string, target *prog.Target) {
 	}
 }
 
+// distill writes the programs of the corpus selected by corpus.DistillItems to dst.
+// The signal and the execution time of the programs come from the corpus metadata
+// database syz-manager keeps next to corpus.db. Programs without metadata are kept as is.
+// Squashed programs can be recognized only if the target is given, otherwise
+// they are not penalized as they are by syz-manager.
+func distill(file, metaFile, dst string, target *prog.Target, cfg signal.DistillConfig) {
+	corpusDB, err := db.Open(file, false)
+	if err != nil {
+		tool.Failf("failed to open database: %v", err)
+	}
+	metaDB, err := db.Open(metaFile, false)
+	if err != nil {
+		tool.Failf("failed to open metadata database: %v", err)
+	}
+	var items []corpus.DistillItem
+	var records []db.Record
+	for key, rec := range corpusDB.Records {
+		metaRec, ok := metaDB.Records[key]
+		if !ok {
+			records = append(records, rec)
+			continue
+		}
+		var meta corpus.ItemMeta
+		if err := json.Unmarshal(metaRec.Val, &meta); err != nil {
+			tool.Failf("failed to parse metadata of %v: %v", key, err)
+		}
+		item := corpus.DistillItem{
+			Signal:   meta.Signal.Deserialize(),
+			Calls:    countCalls(rec.Val),
+			ExecTime: meta.ExecTime,
+			Context:  key,
+		}
+		if target != nil {
+			p, err := target.Deserialize(rec.Val, prog.NonStrict)
+			if err != nil {
+				tool.Failf("failed to deserialize %v: %v", key, err)
+			}
+			item.Calls = len(p.Calls)
+			item.Squashed = p.ContainsAny()
+		}
+		items = append(items, item)
+	}
+	withoutMeta := len(records)
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Context.(string) < items[j].Context.(string)
+	})
+	for _, key := range corpus.DistillItems(items, cfg) {
+		records = append(records, corpusDB.Records[key.(string)])
+	}
+	if err := db.Create(dst, corpusDB.Version, records); err != nil {
+		tool.Fail(err)
+	}
+	fmt.Printf("distilled %v programs to %v (kept %v programs without metadata)\n",
+		len(corpusDB.Records), len(records), withoutMeta)
+}
+
+// countCalls returns the number of calls in the serialized program, each call takes a line.
+func countCalls(data []byte) int {
+	calls := 0
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) != 0 && line[0] != '#' {
+			calls++
+		}
+	}
+	return calls
+}
+
 func bench(target *prog.Target, file string) {
 	start := time.Now()
 	db, err := db.Open(file, false)
@@ -0,0 +1,77 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// syz-lineage exports the derivation graph of the corpus programs recorded by syz-manager
+// in workdir/corpus.meta.db: each program has an edge from the corpus program
+// it was mutated, smashed or hinted from, labeled with the applied mutators.
+// Usage:
+//
+//	syz-lineage [-format dot|json] [-sig sig] workdir/corpus.meta.db
+//
+// With -sig only the ancestry of the given program is printed.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/syzkaller/pkg/corpus"
+	"github.com/google/syzkaller/pkg/db"
+	"github.com/google/syzkaller/pkg/tool"
+)
+
+func main() {
+	var (
+		flagFormat = flag.String("format", "dot", "output format (dot or json)")
+		flagSig    = flag.String("sig", "", "print the ancestry of the program with this sig")
+	)
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "usage: syz-lineage [-format dot|json] [-sig sig] corpus.meta.db\n")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+	metaDB, err := db.Open(flag.Arg(0), false)
+	if err != nil {
+		tool.Failf("failed to open database: %v", err)
+	}
+	graph := corpus.NewLineageGraph()
+	for sig, rec := range metaDB.Records {
+		var meta corpus.ItemMeta
+		if err := json.Unmarshal(rec.Val, &meta); err != nil {
+			tool.Failf("failed to parse the metadata of %v: %v", sig, err)
+		}
+		graph.Add(sig, "", meta.Lineage)
+	}
+	if *flagSig != "" {
+		ancestry := graph.Ancestry(*flagSig)
+		if len(ancestry) == 0 {
+			tool.Failf("no program %v in the database", *flagSig)
+		}
+		for _, node := range ancestry {
+			switch {
+			case node.Missing:
+				fmt.Printf("%v (no longer in the corpus)\n", node.Sig)
+			case node.Parent == "":
+				fmt.Printf("%v (root)\n", node.Sig)
+			default:
+				fmt.Printf("%v <- %v\n", node.Sig, strings.Join(node.Mutators, ","))
+			}
+		}
+		return
+	}
+	switch *flagFormat {
+	case "dot":
+		err = graph.WriteDOT(os.Stdout)
+	case "json":
+		err = graph.WriteJSON(os.Stdout)
+	default:
+		tool.Failf("unknown format %q", *flagFormat)
+	}
+	if err != nil {
+		tool.Fail(err)
+	}
+}
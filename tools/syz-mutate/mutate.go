@@ -95,7 +95,7 @@ func main() {
 			})
 			return
 		} else {
-			p.Mutate(rs, *flagLen, ct, nil, corpus)
+			p.Mutate(rs, *flagLen, ct, nil, corpus, prog.DefaultMutatorWeights)
 		}
 	}
 	fmt.Printf("%s\n", p.Serialize())
@@ -0,0 +1,65 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// syz-ngram prints the call n-grams mined from a corpus: the sequences of calls connected
+// by resources that syz-fuzzer uses as generation templates (see prog.NgramMiner).
+// Usage:
+//
+//	syz-ngram [-os os -arch arch] [-min N] [-top N] [-template] corpus.db
+//
+// With -template the tool also prints the program each n-gram template was cut out of.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/google/syzkaller/pkg/db"
+	"github.com/google/syzkaller/pkg/tool"
+	"github.com/google/syzkaller/prog"
+)
+
+func main() {
+	var (
+		flagOS       = flag.String("os", runtime.GOOS, "target os")
+		flagArch     = flag.String("arch", runtime.GOARCH, "target arch")
+		flagMin      = flag.Int("min", prog.NgramMinCount, "print n-grams that occur in at least that many programs")
+		flagTop      = flag.Int("top", 0, "print only that many most frequent n-grams (0 for all)")
+		flagTemplate = flag.Bool("template", false, "print the n-gram templates")
+	)
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "usage: syz-ngram [-os os -arch arch] [-min N] [-top N] [-template] corpus.db\n")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+	target, err := prog.GetTarget(*flagOS, *flagArch)
+	if err != nil {
+		tool.Fail(err)
+	}
+	corpus, err := db.ReadCorpus(flag.Arg(0), target)
+	if err != nil {
+		tool.Failf("failed to read corpus: %v", err)
+	}
+	miner := prog.NewNgramMiner()
+	for _, p := range corpus {
+		miner.Add(p)
+	}
+	ngrams := miner.Ngrams(*flagMin)
+	if *flagTop > 0 && len(ngrams) > *flagTop {
+		ngrams = ngrams[:*flagTop]
+	}
+	fmt.Printf("mined %v programs, %v n-grams occur in at least %v of them\n",
+		miner.Progs(), len(miner.Ngrams(*flagMin)), *flagMin)
+	for _, ngram := range ngrams {
+		fmt.Printf("%6v %v  %v\n", ngram.Count, len(ngram.Calls), ngram.Key)
+		if !*flagTemplate {
+			continue
+		}
+		if p := ngram.Template(); p != nil {
+			fmt.Printf("%s\n", p.Serialize())
+		}
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// syz-replay reproduces the programs recorded by fuzzers in the deterministic mode
+// (see the "deterministic" manager config parameter) and checks that they match the records.
+// Usage:
+//
+//	syz-replay [-print] workdir/replay/vm-0-1.jsonl...
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/google/syzkaller/pkg/replay"
+	"github.com/google/syzkaller/pkg/tool"
+	"github.com/google/syzkaller/prog"
+	_ "github.com/google/syzkaller/sys"
+)
+
+var flagPrint = flag.Bool("print", false, "print the replayed programs")
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "usage: syz-replay [flags] replay.jsonl...\n")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+	for _, file := range flag.Args() {
+		records, err := replay.ReadFile(file)
+		if err != nil {
+			tool.Fail(err)
+		}
+		count := map[replay.Kind]int{}
+		err = replay.Replay(records, func(rec *replay.Record, p *prog.Prog) {
+			count[rec.Kind]++
+			if *flagPrint {
+				fmt.Printf("# %v seq=%v seed=%v parent=%v mutators=%v\n%s\n",
+					rec.Kind, rec.Seq, rec.Seed, rec.Parent, rec.Mutators, p.Serialize())
+			}
+		})
+		if err != nil {
+			tool.Failf("%v: %v", file, err)
+		}
+		fmt.Fprintf(os.Stderr, "%v: replayed %v generated and %v mutated programs\n",
+			file, count[replay.KindGenerate], count[replay.KindMutate])
+	}
+}
@@ -2,9 +2,15 @@
 // Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
 
 // syz-showprio visualizes the call to call priorities from the prog package.
+// The priorities are calculated from the corpus and/or the priorities saved by syz-manager
+// in workdir/prios.json. With -diff the tool shows how the priorities differ from the ones
+// calculated from another saved matrix, e.g.:
+//
+//	syz-showprio -enable=open,read,write -prios new/prios.json -diff old/prios.json
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
@@ -21,6 +27,8 @@ var (
 	flagArch   = flag.String("arch", runtime.GOARCH, "target arch")
 	flagEnable = flag.String("enable", "", "comma-separated list of enabled syscalls")
 	flagCorpus = flag.String("corpus", "", "name of the corpus file")
+	flagPrios  = flag.String("prios", "", "name of the learned priorities file")
+	flagDiff   = flag.String("diff", "", "show the difference with the priorities from this file")
 )
 
 func main() {
@@ -40,21 +48,51 @@ func main() {
 		fmt.Fprintf(os.Stderr, "failed to parse enabled syscalls: %v\n", err)
 		os.Exit(1)
 	}
-	corpus, err := db.ReadCorpus(*flagCorpus, target)
+	var corpus []*prog.Prog
+	if *flagCorpus != "" {
+		corpus, err = db.ReadCorpus(*flagCorpus, target)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to read corpus: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	prios := target.CalculatePrioritiesWithPrior(corpus, target.CompactPrioMatrix(readPrios(*flagPrios)))
+	var base [][]int32
+	if *flagDiff != "" {
+		base = target.CalculatePrioritiesWithPrior(nil, target.CompactPrioMatrix(readPrios(*flagDiff)))
+	}
+	showPriorities(enabled, prios, base, target)
+}
+
+func readPrios(file string) *prog.PrioMatrix {
+	if file == "" {
+		return nil
+	}
+	data, err := os.ReadFile(file)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to read corpus: %v\n", err)
+		fmt.Fprintf(os.Stderr, "failed to read priorities: %v\n", err)
+		os.Exit(1)
+	}
+	prios := new(prog.PrioMatrix)
+	if err := json.Unmarshal(data, prios); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to parse priorities %v: %v\n", file, err)
 		os.Exit(1)
 	}
-	showPriorities(enabled, target.CalculatePriorities(corpus), target)
+	return prios
 }
 
-func showPriorities(calls []string, prios [][]int32, target *prog.Target) {
+// showPriorities prints the priorities, or their difference with base if it's not nil.
+func showPriorities(calls []string, prios, base [][]int32, target *prog.Target) {
 	printLine(append([]string{"CALLS"}, calls...))
 	for _, callRow := range calls {
 		line := []string{callRow}
 		for _, callCol := range calls {
-			val := prios[target.SyscallMap[callRow].ID][target.SyscallMap[callCol].ID]
-			line = append(line, fmt.Sprintf("%v", val))
+			id0, id1 := target.SyscallMap[callRow].ID, target.SyscallMap[callCol].ID
+			if base != nil {
+				line = append(line, fmt.Sprintf("%+d", prios[id0][id1]-base[id0][id1]))
+			} else {
+				line = append(line, fmt.Sprintf("%v", prios[id0][id1]))
+			}
 		}
 		printLine(line)
 	}
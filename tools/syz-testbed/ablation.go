@@ -0,0 +1,218 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/google/syzkaller/pkg/config"
+	"github.com/google/syzkaller/profiler"
+)
+
+const (
+	ablationTargetName = "syz-manager-ablation"
+	// The variant that runs the ablation config of the base manager config as is.
+	// All other variants are compared against it.
+	ablationBaseline = "baseline"
+)
+
+// Reported by TestbedTarget.NewJob once all the planned runs have been started.
+var errNoMoreJobs = errors.New("all runs have been started")
+
+type AblationCampaignConfig struct {
+	// Explicitly listed variants.
+	Variants []AblationVariantConfig `json:"variants"`
+	// Boolean ablation flags (e.g. "disable_mutator_splice"), a variant is run
+	// for every combination of them.
+	Grid []string `json:"grid"`
+	// How many times each variant is run, 0 means until syz-testbed is stopped.
+	Repetitions int `json:"repetitions"`
+}
+
+type AblationVariantConfig struct {
+	Name string `json:"name"`
+	// A patch to the "ablation" section of the base manager config.
+	Ablation json.RawMessage `json:"ablation"`
+}
+
+// ablationVariants returns the variants the campaign consists of, the baseline goes first.
+func (cfg *AblationCampaignConfig) ablationVariants() []AblationVariantConfig {
+	ret := []AblationVariantConfig{{Name: ablationBaseline}}
+	for _, variant := range cfg.Variants {
+		if variant.Name == ablationBaseline {
+			ret[0] = variant
+			continue
+		}
+		ret = append(ret, variant)
+	}
+	for mask := 1; mask < 1<<len(cfg.Grid); mask++ {
+		var names []string
+		flags := map[string]bool{}
+		for i, flag := range cfg.Grid {
+			if mask&(1<<i) != 0 {
+				names = append(names, flag)
+				flags[flag] = true
+			}
+		}
+		patch, err := json.Marshal(flags)
+		if err != nil {
+			panic(err)
+		}
+		ret = append(ret, AblationVariantConfig{
+			Name:     strings.Join(names, "+"),
+			Ablation: patch,
+		})
+	}
+	return ret
+}
+
+func checkAblationConfig(cfg *AblationCampaignConfig) error {
+	if cfg.Repetitions < 0 {
+		return fmt.Errorf("ablation repetitions cannot be negative")
+	}
+	for _, flag := range cfg.Grid {
+		var parsed profiler.AblationConfiguration
+		if err := config.LoadData([]byte(fmt.Sprintf("{%q: true}", flag)), &parsed); err != nil {
+			return fmt.Errorf("bad ablation grid flag %v: %w", flag, err)
+		}
+	}
+	names := make(map[string]bool)
+	for _, variant := range cfg.ablationVariants() {
+		if names[variant.Name] {
+			return fmt.Errorf("duplicate ablation variant: %v", variant.Name)
+		}
+		names[variant.Name] = true
+		if len(variant.Ablation) == 0 {
+			continue
+		}
+		var parsed profiler.AblationConfiguration
+		if err := config.LoadData(variant.Ablation, &parsed); err != nil {
+			return fmt.Errorf("bad ablation config of variant %v: %w", variant.Name, err)
+		}
+	}
+	if len(names) == 1 {
+		return fmt.Errorf("no ablation variants specified")
+	}
+	return nil
+}
+
+// NewAblationVariants turns the checkout into one checkout per ablation variant.
+// The variants share the build, they only differ in the manager config.
+func (ctx *TestbedContext) NewAblationVariants(checkout *Checkout) ([]*Checkout, error) {
+	var ret []*Checkout
+	for _, variant := range ctx.Config.Ablation.ablationVariants() {
+		mgrCfg := checkout.ManagerConfig
+		if len(variant.Ablation) != 0 {
+			var err error
+			mgrCfg, err = config.MergeJSONs(mgrCfg, []byte(fmt.Sprintf(`{"ablation": %s}`, variant.Ablation)))
+			if err != nil {
+				return nil, fmt.Errorf("failed to apply the ablation config of %v: %w", variant.Name, err)
+			}
+		}
+		log.Printf("[%s] Ablation variant %s: %s", checkout.Name, variant.Name, variant.Ablation)
+		ret = append(ret, &Checkout{
+			Name:          variant.Name,
+			Path:          checkout.Path,
+			ManagerConfig: mgrCfg,
+			Running:       make(map[Instance]bool),
+		})
+	}
+	return ret, nil
+}
+
+// AblationTarget runs syz-managers of the ablation variants of a single checkout,
+// Repetitions times each.
+type AblationTarget struct {
+	SyzManagerTarget
+	started map[*Checkout]int
+	abMu    sync.Mutex
+}
+
+func (t *AblationTarget) NewJob(slotName string, checkouts []*Checkout) (*Checkout, Instance, error) {
+	t.abMu.Lock()
+	// Pick the variant with the fewest runs so that all variants progress evenly.
+	var checkout *Checkout
+	for _, candidate := range checkouts {
+		if checkout == nil || t.started[candidate] < t.started[checkout] {
+			checkout = candidate
+		}
+	}
+	repetitions := t.config.Ablation.Repetitions
+	if repetitions != 0 && t.started[checkout] >= repetitions {
+		t.abMu.Unlock()
+		return nil, nil, errNoMoreJobs
+	}
+	t.started[checkout]++
+	t.abMu.Unlock()
+
+	t.mu.Lock()
+	instanceID := t.nextInstanceID
+	t.nextInstanceID++
+	t.mu.Unlock()
+	uniqName := fmt.Sprintf("%s-%d", checkout.Name, instanceID)
+	instance, err := t.newSyzManagerInstance(slotName, uniqName, checkout)
+	if err != nil {
+		return nil, nil, err
+	}
+	return checkout, instance, nil
+}
+
+func (t *AblationTarget) SaveStatView(view StatView, dir string) error {
+	if err := t.SyzManagerTarget.SaveStatView(view, dir); err != nil {
+		return err
+	}
+	table, err := view.RelativeStatsTable("fuzzing", ablationBaseline)
+	if err != nil {
+		// E.g. no baseline runs have been completed yet.
+		log.Printf("stat generation error: %s", err)
+		return nil
+	}
+	return table.SaveAsCsv(filepath.Join(dir, "ablation_stats.csv"))
+}
+
+// RelativeStatsTable puts next to the statistics of each group its change relative
+// to the base group and the p-value of the Mann-Whitney U test of the two samples.
+func (view StatView) RelativeStatsTable(field, baseGroup string) (*Table, error) {
+	table, err := view.AlignedStatsTable(field)
+	if err != nil {
+		return nil, err
+	}
+	if err := table.SetRelativeValues(baseGroup); err != nil {
+		return nil, err
+	}
+	ret := NewTable("Property", baseGroup)
+	var groups []string
+	for _, group := range view.Groups {
+		if group.Name == baseGroup {
+			continue
+		}
+		groups = append(groups, group.Name)
+		ret.AddColumn(group.Name)
+		ret.AddColumn(group.Name + " change")
+		ret.AddColumn(group.Name + " p-value")
+	}
+	for row := range table.Cells {
+		ret.Set(row, baseGroup, table.Get(row, baseGroup))
+		for _, group := range groups {
+			cell, ok := table.Get(row, group).(*ValueCell)
+			if !ok {
+				continue
+			}
+			ret.Set(row, group, cell)
+			if cell.PercentChange != nil {
+				ret.Set(row, group+" change", fmt.Sprintf("%+.1f%%", *cell.PercentChange))
+			}
+			if cell.PValue != nil {
+				ret.Set(row, group+" p-value", fmt.Sprintf("%.3f", *cell.PValue))
+			}
+		}
+	}
+	return ret, nil
+}
@@ -211,6 +211,9 @@ func (ctx *TestbedContext) httpMainStatsTable(urlPrefix string, view StatView, r
 		return nil, fmt.Errorf("stat table generation failed: %w", err)
 	}
 	baseColumn := r.FormValue("base_column")
+	if baseColumn == "" && ctx.Config.Target == ablationTargetName {
+		baseColumn = ablationBaseline
+	}
 	if baseColumn != "" {
 		err := table.SetRelativeValues(baseColumn)
 		if err != nil {
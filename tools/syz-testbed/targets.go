@@ -37,6 +37,14 @@ var targetConstructors = map[string]func(cfg *TestbedConfig) TestbedTarget{
 			config: cfg,
 		}
 	},
+	ablationTargetName: func(cfg *TestbedConfig) TestbedTarget {
+		return &AblationTarget{
+			SyzManagerTarget: SyzManagerTarget{
+				config: cfg,
+			},
+			started: make(map[*Checkout]int),
+		}
+	},
 	"syz-repro": func(cfg *TestbedConfig) TestbedTarget {
 		inputFiles := []string{}
 		reproConfig := cfg.ReproConfig
@@ -40,6 +40,8 @@ type TestbedConfig struct {
 	ReproConfig   ReproTestConfig  `json:"repro_config"`   // syz-repro benchmarking config
 	ManagerConfig json.RawMessage  `json:"manager_config"` // base manager config
 	Checkouts     []CheckoutConfig `json:"checkouts"`
+	// ablation campaign config (for the syz-manager-ablation target)
+	Ablation AblationCampaignConfig `json:"ablation"`
 }
 
 type DurationConfig struct {
@@ -102,6 +104,12 @@ func main() {
 		}
 		ctx.Checkouts = append(ctx.Checkouts, co)
 	}
+	if cfg.Target == ablationTargetName {
+		ctx.Checkouts, err = ctx.NewAblationVariants(ctx.Checkouts[0])
+		if err != nil {
+			tool.Failf("failed to set up ablation variants: %s", err)
+		}
+	}
 
 	shutdown := make(chan struct{})
 	osutil.HandleInterrupts(shutdown)
@@ -118,6 +126,9 @@ func main() {
 	}()
 
 	ctx.Loop(shutdown)
+	if err := ctx.SaveStats(); err != nil {
+		log.Printf("stats saving error: %s", err)
+	}
 }
 
 func (ctx *TestbedContext) MakeMgrConfig(base, patch json.RawMessage) json.RawMessage {
@@ -204,6 +215,10 @@ func (ctx *TestbedContext) Slot(slotID int, stop chan struct{}, ret chan error)
 	slotName := fmt.Sprintf("%s-%d", ctx.Config.Name, slotID)
 	for {
 		checkout, instance, err := ctx.Target.NewJob(slotName, ctx.Checkouts)
+		if err == errNoMoreJobs {
+			ret <- nil
+			return
+		}
 		if err != nil {
 			ret <- fmt.Errorf("failed to create instance: %w", err)
 			return
@@ -247,12 +262,24 @@ func (ctx *TestbedContext) Loop(stop chan struct{}) {
 	}
 
 	exited := 0
-	select {
-	case <-stop:
-		log.Printf("stopping the experiment")
-	case err := <-errors:
-		exited = 1
-		log.Printf("an instance has failed (%s), stopping everything", err)
+loop:
+	for exited < ctx.Config.MaxInstances {
+		select {
+		case <-stop:
+			log.Printf("stopping the experiment")
+			break loop
+		case err := <-errors:
+			exited++
+			if err == nil {
+				// The slot has nothing more to run.
+				continue
+			}
+			log.Printf("an instance has failed (%s), stopping everything", err)
+			break loop
+		}
+	}
+	if exited == ctx.Config.MaxInstances {
+		log.Printf("all runs have completed")
 	}
 	close(stopAll)
 	for ; exited < ctx.Config.MaxInstances; exited++ {
@@ -321,6 +348,14 @@ func checkConfig(cfg *TestbedConfig) error {
 	if err = checkReproTestConfig(&cfg.ReproConfig); err != nil {
 		return err
 	}
+	if cfg.Target == ablationTargetName {
+		if len(cfg.Checkouts) != 1 {
+			return fmt.Errorf("target %v requires exactly one checkout", cfg.Target)
+		}
+		if err = checkAblationConfig(&cfg.Ablation); err != nil {
+			return err
+		}
+	}
 	cfg.Corpus = osutil.Abs(cfg.Corpus)
 	names := make(map[string]bool)
 	for idx := range cfg.Checkouts {